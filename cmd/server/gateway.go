@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	metrics "todo/internal/metrics"
+	ratelimit "todo/internal/ratelimit"
+	requestid "todo/internal/requestid"
+	tracing "todo/internal/tracing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Options for the grpc-gateway mux
+func gatewayOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithMetadata(metrics.GatewayRoute),
+		runtime.WithMetadata(tracing.GatewayRoute),
+	}
+}
+
+// Forwards HTTP preconditions and request ids to gRPC metadata on top of the default headers
+func incomingHeaderMatcher(key string) (string, bool) {
+	switch strings.ToLower(key) {
+	case "if-match":
+		return "if-match", true
+	case requestid.MetadataKey:
+		return requestid.MetadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// Same as the default error handler, except failed preconditions are answered with 412,
+// and rate limited calls tell when to retry with Retry-After
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if st, ok := status.FromError(err); ok {
+		for _, detail := range st.Details() {
+			if _, ok := detail.(*errdetails.PreconditionFailure); ok {
+				w = &statusOverrideWriter{ResponseWriter: w, code: http.StatusPreconditionFailed}
+				break
+			}
+		}
+		ratelimit.SetRetryAfter(w.Header(), st)
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, m, w, r, err)
+}
+
+type statusOverrideWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusOverrideWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(w.code)
+}
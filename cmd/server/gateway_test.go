@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	ratelimit "todo/internal/ratelimit"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_errorHandler(t *testing.T) {
+	stale, err := status.New(codes.Aborted, "item item1 has changed").WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: "ETAG", Description: `current etag is "2"`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		testName           string
+		inErr              error
+		expectedCode       int
+		expectedRetryAfter string
+	}{
+		{
+			testName:     "Stale etag",
+			inErr:        stale.Err(),
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			testName:     "Aborted without a precondition",
+			inErr:        status.Error(codes.Aborted, "transaction aborted"),
+			expectedCode: http.StatusConflict,
+		},
+		{
+			testName:           "Rate limited",
+			inErr:              ratelimit.Error(1500 * time.Millisecond),
+			expectedCode:       http.StatusTooManyRequests,
+			expectedRetryAfter: "2",
+		},
+		{
+			testName:     "Plain error",
+			inErr:        errors.New("boom"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/v1/todo/item1", nil)
+			errorHandler(context.Background(), runtime.NewServeMux(), &runtime.JSONPb{}, w, r, tc.inErr)
+			if w.Code != tc.expectedCode {
+				tt.Errorf("errorHandler failed, got status %d, want %d", w.Code, tc.expectedCode)
+			}
+			if got := w.Header().Get("Retry-After"); got != tc.expectedRetryAfter {
+				tt.Errorf("errorHandler failed, got Retry-After %q, want %q", got, tc.expectedRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	data "todo/internal/data"
+	health "todo/internal/health"
+
+	"google.golang.org/grpc"
+)
+
+// Everything main starts that has to be stopped on shutdown. Servers are shut down
+// in the reverse order they were started, then the background workers are stopped
+// and the database is closed.
+type lifecycle struct {
+	// background work runs until the servers are shut down
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	workers []worker
+	servers []server
+	// run last, e.g. to flush telemetry
+	closers []server
+
+	// reports servers that stopped serving on their own
+	failed chan error
+}
+
+type worker struct {
+	name string
+	done <-chan struct{}
+}
+
+type server struct {
+	name     string
+	shutdown func(ctx context.Context) error
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{
+		ctx:    ctx,
+		cancel: cancel,
+		failed: make(chan error, 3),
+	}
+}
+
+// Registers a background worker, done must be closed once it stopped after lc.ctx is done
+func (lc *lifecycle) addWorker(name string, done <-chan struct{}) {
+	lc.workers = append(lc.workers, worker{name: name, done: done})
+}
+
+// Registers fn to run once everything else stopped
+func (lc *lifecycle) addCloser(name string, fn func(ctx context.Context) error) {
+	lc.closers = append(lc.closers, server{name: name, shutdown: fn})
+}
+
+// Runs serve in the background and registers how to shut the server down
+func (lc *lifecycle) serve(name string, serve func() error, shutdown func(ctx context.Context) error) {
+	lc.servers = append(lc.servers, server{name: name, shutdown: shutdown})
+
+	go func() {
+		err := serve()
+		if err == nil || errors.Is(err, http.ErrServerClosed) || errors.Is(err, grpc.ErrServerStopped) {
+			return
+		}
+		lc.failed <- errors.New(name + ": " + err.Error())
+	}()
+}
+
+// Blocks until ctx is done, e.g. on a signal, or a server fails. Returns the failure.
+func (lc *lifecycle) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-lc.failed:
+		return err
+	}
+}
+
+// Stops everything within timeout, returns whatever couldn't be stopped cleanly.
+// The server keeps serving for delay after reporting not ready, until load balancers
+// stopped sending it requests.
+func (lc *lifecycle) shutdown(delay time.Duration, timeout time.Duration) error {
+	health.SetServing(false, "shutting down")
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(lc.servers) - 1; i >= 0; i-- {
+		server := lc.servers[i]
+		if err := server.shutdown(ctx); err != nil {
+			errs = append(errs, errors.New("shutting down "+server.name+": "+err.Error()))
+			continue
+		}
+		slog.Info("stopped " + server.name)
+	}
+
+	lc.cancel()
+	for _, worker := range lc.workers {
+		select {
+		case <-worker.done:
+		case <-ctx.Done():
+			errs = append(errs, errors.New("stopping "+worker.name+": "+ctx.Err().Error()))
+		}
+	}
+
+	// workers that didn't stop in time fail their queries from here on
+	if err := data.Close(); err != nil {
+		errs = append(errs, errors.New("closing database: "+err.Error()))
+	}
+
+	for _, closer := range lc.closers {
+		if err := closer.shutdown(ctx); err != nil {
+			errs = append(errs, errors.New("closing "+closer.name+": "+err.Error()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shuts an HTTP server down, closing the connections still open at the deadline
+func shutdownHTTP(s *http.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		err := s.Shutdown(ctx)
+		if err != nil {
+			s.Close()
+		}
+		return err
+	}
+}
+
+// Stops a gRPC server once its calls are done, cancelling those still running at the deadline
+func shutdownGRPC(s *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			s.Stop()
+			return ctx.Err()
+		}
+	}
+}
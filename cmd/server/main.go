@@ -3,16 +3,34 @@ package main
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	business "todo/internal/business"
+	caldav "todo/internal/caldav"
+	certs "todo/internal/certs"
 	data "todo/internal/data"
+	events "todo/internal/events"
 	google "todo/internal/google"
+	health "todo/internal/health"
+	metrics "todo/internal/metrics"
+	multiplex "todo/internal/multiplex"
+	outbox "todo/internal/outbox"
+	ratelimit "todo/internal/ratelimit"
+	live "todo/internal/live"
+	logging "todo/internal/logging"
+	requestid "todo/internal/requestid"
+	tracing "todo/internal/tracing"
 	service "todo/internal/service"
+	upload "todo/internal/upload"
+	webhook "todo/internal/webhook"
 	pb "todo/proto/todo"
 
 	_ "github.com/lib/pq"
@@ -20,6 +38,7 @@ import (
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -30,131 +49,666 @@ func startViper() {
 	viper.AutomaticEnv()
 	viper.SetConfigType("yaml")
 	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("Error reading config file, %s", err)
+		slog.Warn("error reading config file", "error", err)
+	}
+}
+
+// Logs as configured, before anything else is started
+func startLogging() {
+	config := logging.DefaultConfig
+	if viper.IsSet("log.level") {
+		config.Level = viper.GetString("log.level")
+	}
+	if viper.IsSet("log.format") {
+		config.Format = viper.GetString("log.format")
+	}
+	if viper.IsSet("log.addSource") {
+		config.AddSource = viper.GetBool("log.addSource")
+	}
+	if viper.IsSet("log.accessLog") {
+		config.AccessLog = viper.GetBool("log.accessLog")
+	}
+
+	if err := logging.Setup(os.Stderr, config); err != nil {
+		logging.Fatal("invalid log config", "error", err)
 	}
 }
 
 func CheckDatabase(ctx context.Context) error {
 	query := `SELECT schema_name FROM information_schema.schemata WHERE schema_name='main'`
-	row := data.DB.QueryRow(query)
+	row := data.DB.QueryRowContext(ctx, query)
 
 	var result string 
 	err := row.Scan(&result);
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// run first time db setup (create schema/tables etc)
-			fmt.Println("Running first time setup for db...")
+			slog.Info("running first time setup for db")
 			sqlScript, err := os.ReadFile("postgresql/1_first_time_up.sql")
 			if err != nil {
 				return err
 			}
 			query := string(sqlScript)
-			if _, err := data.DB.Exec(query); err != nil {
+			if _, err := data.DB.ExecContext(ctx, query); err != nil {
 				return err
 			}
-			fmt.Println("Done")
+			slog.Info("first time setup done")
 		} else {
 			return err
 		}
 	}
 
-	return nil
+	return data.Migrate(ctx, "postgresql")
 }
 
-func startDB(ctx context.Context)  {
+// Connects to the database, retrying until it is up or ctx is done
+func startDB(ctx context.Context, lc *lifecycle) {
 	var err error
 
-	psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", 
-		viper.GetString("database.host"),
-		viper.GetInt("database.port"),
-		viper.GetString("database.user"),
-		viper.GetString("database.password"),
-		viper.GetString("database.name"),
-	)
-         
+	var primary databaseConfig
+	if err := viper.UnmarshalKey("database", &primary); err != nil {
+		logging.Fatal("invalid database config", "error", err)
+	}
+	psqlconn, err := databaseDSN(primary)
+	if err != nil {
+		logging.Fatal("invalid database config", "error", err)
+	}
+
     // open database
     data.DB, err = sql.Open("postgres", psqlconn)
     if err != nil {
-		log.Fatalln("Failed to open database:", err)
+		logging.Fatal("failed to open database", "error", err)
+	}
+	configurePool(data.DB, "database.pool")
+	metrics.RegisterDB("primary", data.DB)
+
+	// transaction settings used by data.WithTx
+	isolation, err := data.ParseIsolation(viper.GetString("database.transaction.isolation"))
+	if err != nil {
+		logging.Fatal("invalid transaction isolation", "error", err)
+	}
+	if isolation != sql.LevelDefault {
+		data.TxSettings.Isolation = isolation
+	}
+	if viper.IsSet("database.transaction.maxRetries") {
+		data.TxSettings.MaxRetries = viper.GetInt("database.transaction.maxRetries")
+	}
+	if viper.IsSet("database.transaction.retryBackoff") {
+		data.TxSettings.RetryBackoff = viper.GetDuration("database.transaction.retryBackoff")
+	}
+
+	// query timeouts used by every data function
+	if viper.IsSet("database.timeouts.default") {
+		data.DefaultQueryTimeout = viper.GetDuration("database.timeouts.default")
+	}
+	for op := range viper.GetStringMap("database.timeouts.operations") {
+		data.QueryTimeouts[op] = viper.GetDuration("database.timeouts.operations." + op)
 	}
 
 	err = CheckDatabase(ctx)
 	for err != nil {
-		time.Sleep(2*time.Second)
-		fmt.Println(err.Error() + " retrying connection to database...")
+		slog.Warn("database unavailable, retrying connection", "error", err)
+		select {
+		case <-ctx.Done():
+			data.Close()
+			logging.Fatal("stopped while connecting to database")
+		case <-time.After(2 * time.Second):
+		}
 		err = CheckDatabase(ctx)
 	}
-	
-	fmt.Println("Serving database on port " + strconv.Itoa(viper.GetInt("database.port")))
+
+	slog.Info("connected to database", "port", viper.GetInt("database.port"))
+
+	// keep checking the database so the server stops accepting calls while it is unreachable
+	interval := viper.GetDuration("database.healthCheck.interval")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	timeout := viper.GetDuration("database.healthCheck.timeout")
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	lc.addWorker("database health check", data.StartHealthCheck(lc.ctx, interval, timeout))
+
+	// change notifications for WatchTodos
+	done, err := events.Start(lc.ctx, psqlconn)
+	if err != nil {
+		logging.Fatal("failed to listen for item events", "error", err)
+	}
+	lc.addWorker("item events listener", done)
+
+	startReplicas(lc)
+}
+
+// Opens the read replicas, reads are routed to them by the data layer while they keep up
+func startReplicas(lc *lifecycle) {
+	var replicas []databaseConfig
+	if err := viper.UnmarshalKey("database.replicas", &replicas); err != nil {
+		logging.Fatal("invalid database.replicas config", "error", err)
+	}
+	if len(replicas) == 0 {
+		return
+	}
+
+	if viper.IsSet("database.replication.maxLag") {
+		data.MaxReplicaLag = viper.GetDuration("database.replication.maxLag")
+	}
+	if viper.IsSet("database.replication.readYourWritesWindow") {
+		data.ReadYourWritesWindow = viper.GetDuration("database.replication.readYourWritesWindow")
+	}
+
+	for i, replica := range replicas {
+		name := replica.Host + ":" + strconv.Itoa(replica.Port)
+		psqlconn, err := databaseDSN(replica)
+		if err != nil {
+			logging.Fatal("invalid database.replicas["+strconv.Itoa(i)+"] config", "error", err)
+		}
+
+		db, err := sql.Open("postgres", psqlconn)
+		if err != nil {
+			logging.Fatal("failed to open replica", "replica", name, "error", err)
+		}
+		configurePool(db, "database.pool")
+		metrics.RegisterDB(name, db)
+
+		data.AddReplica(name, db)
+	}
+
+	interval := viper.GetDuration("database.replication.checkInterval")
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	lc.addWorker("replica monitor", data.StartReplicaMonitor(lc.ctx, interval))
+
+	slog.Info("routing reads to replicas", "replicas", len(replicas))
+}
+
+// Connection settings of a postgres server, as found under database and each of database.replicas
+type databaseConfig struct {
+	Name        string
+	Host        string
+	Port        int
+	User        string
+	Password    string
+	SSLMode     string `mapstructure:"sslmode"`
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+}
+
+// Builds a lib/pq connection string from the database settings
+func databaseDSN(config databaseConfig) (string, error) {
+	sslmode := config.SSLMode
+	switch sslmode {
+	case "":
+		sslmode = "disable"
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return "", errors.New("unknown sslmode " + sslmode)
+	}
+
+	params := []string{
+		"host=" + quoteDSN(config.Host),
+		"port=" + strconv.Itoa(config.Port),
+		"user=" + quoteDSN(config.User),
+		"password=" + quoteDSN(config.Password),
+		"dbname=" + quoteDSN(config.Name),
+		"sslmode=" + sslmode,
+	}
+
+	// CA used to verify the server certificate, required by verify-ca and verify-full
+	if config.SSLRootCert == "" && (sslmode == "verify-ca" || sslmode == "verify-full") {
+		return "", errors.New("sslmode " + sslmode + " requires sslrootcert")
+	}
+	if config.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(config.SSLRootCert))
+	}
+
+	// optional client certificate
+	if config.SSLCert != "" {
+		params = append(params, "sslcert="+quoteDSN(config.SSLCert), "sslkey="+quoteDSN(config.SSLKey))
+	}
+
+	return strings.Join(params, " "), nil
+}
+
+// Quotes a connection string value so spaces and quotes survive
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// Applies the pool settings under key, zero values keep the database/sql defaults
+func configurePool(db *sql.DB, key string) {
+	if viper.IsSet(key + ".maxOpenConns") {
+		db.SetMaxOpenConns(viper.GetInt(key + ".maxOpenConns"))
+	}
+	if viper.IsSet(key + ".maxIdleConns") {
+		db.SetMaxIdleConns(viper.GetInt(key + ".maxIdleConns"))
+	}
+	if viper.IsSet(key + ".connMaxLifetime") {
+		db.SetConnMaxLifetime(viper.GetDuration(key + ".connMaxLifetime"))
+	}
+	if viper.IsSet(key + ".connMaxIdleTime") {
+		db.SetConnMaxIdleTime(viper.GetDuration(key + ".connMaxIdleTime"))
+	}
+}
+
+// Applies the business rules settings
+func configureBusiness() {
+	if viper.IsSet("undo.window") {
+		business.UndoWindow = viper.GetDuration("undo.window")
+	}
+	if viper.IsSet("undo.maxOperations") {
+		business.MaxUndo = viper.GetInt("undo.maxOperations")
+	}
+	if viper.IsSet("import.maxRows") {
+		business.MaxImportRows = viper.GetInt("import.maxRows")
+	}
+	if viper.IsSet("import.maxBytes") {
+		business.MaxImportBytes = viper.GetInt("import.maxBytes")
+	}
+	if viper.IsSet("quota.maxItemsPerList") {
+		business.MaxItemsPerList = viper.GetInt("quota.maxItemsPerList")
+	}
+	if viper.IsSet("metrics.activeUserWindow") {
+		metrics.ActiveUserWindow = viper.GetDuration("metrics.activeUserWindow")
+	}
+}
+
+// Limits the calls of each user as configured
+func configureRateLimit() {
+	if viper.IsSet("rateLimit.enabled") && !viper.GetBool("rateLimit.enabled") {
+		return
+	}
+
+	config := ratelimit.DefaultConfig
+	config.Default = rateLimit("rateLimit", config.Default)
+	if viper.IsSet("rateLimit.idleTimeout") {
+		config.IdleTimeout = viper.GetDuration("rateLimit.idleTimeout")
+	}
+	config.Methods = map[string]ratelimit.Limit{}
+	for method := range viper.GetStringMap("rateLimit.methods") {
+		config.Methods[method] = rateLimit("rateLimit.methods."+method, config.Default)
+	}
+
+	ratelimit.Configure(config)
+}
+
+// Reads the rate and burst under key, the ones that aren't set are taken from limit
+func rateLimit(key string, limit ratelimit.Limit) ratelimit.Limit {
+	if viper.IsSet(key + ".rate") {
+		limit.Rate = viper.GetFloat64(key + ".rate")
+	}
+	if viper.IsSet(key + ".burst") {
+		limit.Burst = viper.GetInt(key + ".burst")
+	}
+	return limit
+}
+
+// Exports traces as configured, flushing them on shutdown
+func startTracing(lc *lifecycle) {
+	config := tracing.DefaultConfig
+	if viper.IsSet("tracing.exporter") {
+		config.Exporter = viper.GetString("tracing.exporter")
+	}
+	if viper.IsSet("tracing.serviceName") {
+		config.ServiceName = viper.GetString("tracing.serviceName")
+	}
+	if viper.IsSet("tracing.sampleRatio") {
+		config.SampleRatio = viper.GetFloat64("tracing.sampleRatio")
+	}
+	if viper.IsSet("tracing.otlp.endpoint") {
+		config.Endpoint = viper.GetString("tracing.otlp.endpoint")
+	}
+	if viper.IsSet("tracing.otlp.insecure") {
+		config.Insecure = viper.GetBool("tracing.otlp.insecure")
+	}
+
+	shutdown, err := tracing.Start(lc.ctx, config)
+	if err != nil {
+		logging.Fatal("failed to start tracing", "error", err)
+	}
+	lc.addCloser("tracing", shutdown)
+}
+
+// Starts sending queued webhook deliveries
+func startWebhooks(lc *lifecycle) {
+	config := webhook.DefaultConfig
+	if viper.IsSet("webhooks.pollInterval") {
+		config.PollInterval = viper.GetDuration("webhooks.pollInterval")
+	}
+	if viper.IsSet("webhooks.batchSize") {
+		config.BatchSize = viper.GetInt("webhooks.batchSize")
+	}
+	if viper.IsSet("webhooks.timeout") {
+		config.Timeout = viper.GetDuration("webhooks.timeout")
+	}
+	if viper.IsSet("webhooks.maxAttempts") {
+		config.MaxAttempts = viper.GetInt("webhooks.maxAttempts")
+	}
+	if viper.IsSet("webhooks.backoff") {
+		config.Backoff = viper.GetDuration("webhooks.backoff")
+	}
+	if viper.IsSet("webhooks.maxBackoff") {
+		config.MaxBackoff = viper.GetDuration("webhooks.maxBackoff")
+	}
+	if viper.IsSet("webhooks.allowPrivateDestinations") {
+		webhook.AllowPrivateDestinations = viper.GetBool("webhooks.allowPrivateDestinations")
+	}
+
+	lc.addWorker("webhook deliveries", webhook.Start(lc.ctx, config))
+}
+
+// Starts relaying outbox events to the configured sinks
+func startOutbox(lc *lifecycle) {
+	config := outbox.DefaultConfig
+	if viper.IsSet("outbox.pollInterval") {
+		config.PollInterval = viper.GetDuration("outbox.pollInterval")
+	}
+	if viper.IsSet("outbox.batchSize") {
+		config.BatchSize = viper.GetInt("outbox.batchSize")
+	}
+	if viper.IsSet("outbox.lease") {
+		config.Lease = viper.GetDuration("outbox.lease")
+	}
+	if viper.IsSet("outbox.backoff") {
+		config.Backoff = viper.GetDuration("outbox.backoff")
+	}
+	if viper.IsSet("outbox.maxBackoff") {
+		config.MaxBackoff = viper.GetDuration("outbox.maxBackoff")
+	}
+
+	var sinks []outbox.Sink
+	if viper.GetBool("outbox.sinks.log") {
+		sinks = append(sinks, outbox.LogSink{})
+	}
+	if url := viper.GetString("outbox.sinks.webhook.url"); url != "" {
+		timeout := viper.GetDuration("outbox.sinks.webhook.timeout")
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		sinks = append(sinks, &outbox.WebhookSink{
+			Url:    url,
+			Secret: viper.GetString("outbox.sinks.webhook.secret"),
+			Client: &http.Client{Timeout: timeout},
+		})
+	}
+	if url := viper.GetString("outbox.sinks.nats.url"); url != "" {
+		subject := viper.GetString("outbox.sinks.nats.subject")
+		if subject == "" {
+			subject = "todo.events"
+		}
+		sink := &outbox.NATSSink{
+			Url:             url,
+			Subject:         subject,
+			Timeout:         viper.GetDuration("outbox.sinks.nats.timeout"),
+			CredentialsFile: viper.GetString("outbox.sinks.nats.credentialsFile"),
+			NkeySeedFile:    viper.GetString("outbox.sinks.nats.nkeySeedFile"),
+			CAFile:          viper.GetString("outbox.sinks.nats.caFile"),
+			CertFile:        viper.GetString("outbox.sinks.nats.certFile"),
+			KeyFile:         viper.GetString("outbox.sinks.nats.keyFile"),
+		}
+		sinks = append(sinks, sink)
+		// after the relay stopped, flushes what it published last
+		lc.addCloser("nats sink", func(context.Context) error { return sink.Close() })
+	}
+
+	// without sinks events stay in the outbox until one is configured
+	if len(sinks) == 0 {
+		return
+	}
+	lc.addWorker("outbox relay", outbox.Start(lc.ctx, config, sinks))
 }
 
-func startGRPC(ctx context.Context) {
+// ctx ends the WatchTodos streams, which would otherwise hold up GracefulStop
+func startGRPC(ctx context.Context, lc *lifecycle) {
 	grpcPort := viper.GetString("server.grpcPort")
 
 	lis, err := net.Listen("tcp", grpcPort)
 	if err != nil {
-		log.Fatalln("Failed to listen:", err)
+		logging.Fatal("failed to listen", "error", err)
 	}
 
-	s := grpc.NewServer()
+	tlsConfig := listenerTLS("grpc")
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	s := newGRPCServer(ctx, grpc.Creds(creds))
+	slog.Info("serving gRPC on " + scheme(tlsConfig) + "://0.0.0.0" + grpcPort)
+	lc.serve("gRPC server", func() error { return s.Serve(lis) }, shutdownGRPC(s))
+}
+
+// The gRPC server with its interceptors and services
+func newGRPCServer(ctx context.Context, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		tracing.ServerOption(),
+		grpc.ChainUnaryInterceptor(
+			requestid.UnaryServerInterceptor,
+			logging.UnaryServerInterceptor,
+			metrics.UnaryServerInterceptor,
+			certs.UnaryServerInterceptor,
+			service.ReadinessInterceptor,
+			service.RateLimitInterceptor,
+			service.CallerInterceptor,
+			service.ErrorInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			requestid.StreamServerInterceptor,
+			logging.StreamServerInterceptor,
+			metrics.StreamServerInterceptor,
+			certs.StreamServerInterceptor,
+			service.ReadinessStreamInterceptor,
+			service.RateLimitStreamInterceptor,
+			service.ErrorStreamInterceptor,
+		),
+	)
+	s := grpc.NewServer(opts...)
 	pb.RegisterTodoServer(s, service.NewTodoServer(ctx))
-	log.Println("Serving gRPC on http://0.0.0.0" + grpcPort)
-	go func() {
-		log.Fatalln(s.Serve(lis))
-	}()
+	health.RegisterGRPC(s, pb.Todo_ServiceDesc.ServiceName)
+	return s
 }
 
-func startHTTP() {
+func startHTTP(lc *lifecycle) {
 	grpcPort := viper.GetString("server.grpcPort")
 	httpPort := viper.GetString("server.httpPort")
 
-	conn, err := grpc.DialContext(
-		context.Background(),
-		"0.0.0.0" + grpcPort,
-		grpc.WithBlock(),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	conn := dialGateway("0.0.0.0"+grpcPort, grpc.WithBlock())
+
+	gwServer := &http.Server{
+		Addr:      httpPort,
+		Handler:   instrumentHTTP("gateway", gatewayMux(conn)),
+		TLSConfig: listenerTLS("http"),
+	}
+
+	slog.Info("serving HTTP on " + scheme(gwServer.TLSConfig) + "://0.0.0.0" + httpPort)
+	lc.serve("HTTP server", listenAndServe(gwServer), func(ctx context.Context) error {
+		// the gRPC server goes down next, after the gateway's calls are done
+		defer conn.Close()
+		return shutdownHTTP(gwServer)(ctx)
+	})
+}
+
+// Connects the gateway to the gRPC server at addr
+func dialGateway(addr string, opts ...grpc.DialOption) *grpc.ClientConn {
+	opts = append(opts,
+		grpc.WithTransportCredentials(gatewayCredentials()),
+		// the trace of each HTTP request continues in the gRPC server
+		tracing.DialOption(),
 	)
+	conn, err := grpc.DialContext(context.Background(), addr, opts...)
 	if err != nil {
-		log.Fatalln("Failed to dial server:", err)
+		logging.Fatal("failed to dial server", "error", err)
 	}
+	return conn
+}
 
-	gwmux := runtime.NewServeMux()
-	err = pb.RegisterTodoHandler(context.Background(), gwmux, conn)
+// The REST routes of the gateway, next to the SSE, WebSocket, upload, health and metrics endpoints
+func gatewayMux(conn *grpc.ClientConn) *http.ServeMux {
+	gwmux := runtime.NewServeMux(gatewayOptions()...)
+	err := pb.RegisterTodoHandler(context.Background(), gwmux, conn)
 	if err != nil {
-		log.Fatalln("Failed to register gateway:", err)
+		logging.Fatal("failed to register gateway", "error", err)
 	}
 
-	gwServer := &http.Server{
-		Addr:    httpPort,
-		Handler: gwmux,
+	// browsers can't consume gRPC streams, WatchTodos is also served as SSE and WebSocket
+	liveConfig := live.DefaultConfig
+	if viper.IsSet("server.live.heartbeat") {
+		liveConfig.Heartbeat = viper.GetDuration("server.live.heartbeat")
+	}
+	if viper.IsSet("server.live.bufferSize") {
+		liveConfig.BufferSize = viper.GetInt("server.live.bufferSize")
+	}
+	if viper.IsSet("server.live.writeTimeout") {
+		liveConfig.WriteTimeout = viper.GetDuration("server.live.writeTimeout")
 	}
 
-	log.Println("Serving HTTP on http://0.0.0.0" + httpPort)
-	go func() {
-		log.Fatalln(gwServer.ListenAndServe())
-	}()
+	client := pb.NewTodoClient(conn)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/todo/events", live.SSEHandler(client, liveConfig))
+	mux.Handle("/v1/todo/ws", live.WebSocketHandler(client, liveConfig))
+	mux.Handle("/v1/todo/import/upload", upload.ImportHandler(client, int64(business.MaxImportBytes)))
+	mux.Handle("/v1/todo/export", upload.ExportHandler(client))
+	mux.Handle("/healthz", health.LivenessHandler())
+	mux.Handle("/readyz", health.ReadinessHandler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", gwmux)
+	return mux
 }
 
-func startFrontend() {
+func startFrontend(lc *lifecycle) {
 	frontPort := viper.GetString("server.frontPort")
+	if frontPort == "" {
+		frontPort = ":8081"
+	}
 
+	frontServer := &http.Server{
+		Addr:      frontPort,
+		Handler:   instrumentHTTP("frontend", frontendMux()),
+		TLSConfig: listenerTLS("frontend"),
+	}
+
+	slog.Info("serving Frontend on " + scheme(frontServer.TLSConfig) + "://0.0.0.0" + frontPort)
+	lc.serve("Frontend server", listenAndServe(frontServer), shutdownHTTP(frontServer))
+}
+
+// Google login and CalDAV
+func frontendMux() *http.ServeMux {
 	google.InitializeOAuthGoogle()
 
     http.HandleFunc("/", google.HandleMain)
     http.HandleFunc("/auth/google/login", google.HandleGoogleLogin)
     http.HandleFunc("/auth/google/callback", google.CallBackFromGoogle)
     http.HandleFunc("/auth/google/authenticated", google.HandleAuthenticated)
+	// app tokens are checked on every CalDAV request, the limit also slows down guessing them
+	http.Handle(caldav.Prefix, ratelimit.Middleware("caldav", caldav.Handler()))
+	http.Handle("/.well-known/caldav", caldav.WellKnownHandler())
+	http.Handle("/healthz", health.LivenessHandler())
+	http.Handle("/readyz", health.ReadinessHandler())
+	return http.DefaultServeMux
+}
 
-	log.Println("Serving Frontend on http://0.0.0.0" + frontPort)
-    log.Fatal(http.ListenAndServe(":8081", nil))
+// Serves gRPC, the REST gateway and the frontend on server.port instead of their own
+// ports. gRPC calls are told apart by their content type, the gateway serves /v1/ and
+// /metrics and the frontend everything else. ctx ends the WatchTodos streams.
+func startMultiplexed(ctx context.Context, lc *lifecycle) {
+	port := viper.GetString("server.port")
+	// gRPC clients are the ones presenting certificates, the tls.grpc settings apply
+	tlsConfig := listenerTLS("grpc")
+
+	// the gateway calls the gRPC server through the same port, once it's serving
+	conn := dialGateway("0.0.0.0" + port)
+	gateway := instrumentHTTP("gateway", gatewayMux(conn))
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gateway)
+	mux.Handle("/metrics", gateway)
+	mux.Handle("/", instrumentHTTP("frontend", frontendMux()))
+
+	// TLS is terminated by the HTTP server, for gRPC calls too
+	handler := multiplex.NewHandler(newGRPCServer(ctx), mux)
+	server := &http.Server{
+		Addr:      port,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	if err := multiplex.EnableHTTP2(server); err != nil {
+		logging.Fatal("failed to enable HTTP/2", "error", err)
+	}
+
+	slog.Info("serving gRPC, HTTP and Frontend on " + scheme(tlsConfig) + "://0.0.0.0" + port)
+	lc.serve("server", listenAndServe(server), func(ctx context.Context) error {
+		// HTTP requests first, then the gateway's connection, then the remaining gRPC calls
+		err := shutdownHTTP(server)(ctx)
+		conn.Close()
+		return errors.Join(err, handler.Shutdown(ctx))
+	})
+}
+
+// Traces, correlates, logs and measures the requests of an HTTP server serving mux
+func instrumentHTTP(server string, mux *http.ServeMux) http.Handler {
+	handler := metrics.Instrument(server, mux)
+	handler = logging.AccessLog(server, handler)
+	handler = requestid.Middleware(handler)
+	return tracing.Instrument(server, mux, handler)
 }
 
 func main() {
-	ctx := context.Background()
+	// SIGINT or SIGTERM starts a graceful shutdown, a second one kills the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
 	startViper()
-	startDB(ctx)
-	startGRPC(ctx)
-	startHTTP()
-	startFrontend()
-}
\ No newline at end of file
+	startLogging()
+	configureBusiness()
+	configureRateLimit()
+
+	lc := newLifecycle()
+	startTracing(lc)
+	startTLS(lc)
+	startDB(ctx, lc)
+	startWebhooks(lc)
+	startOutbox(lc)
+	if viper.GetString("server.port") != "" {
+		startMultiplexed(ctx, lc)
+	} else {
+		startGRPC(ctx, lc)
+		startHTTP(lc)
+		startFrontend(lc)
+	}
+
+	// probes report ready once everything is up, and startupDelay passed
+	select {
+	case <-ctx.Done():
+	case <-time.After(viper.GetDuration("health.startupDelay")):
+		health.SetServing(true, "")
+	}
+
+	code := 0
+	if err := lc.wait(ctx); err != nil {
+		slog.Error("server failed, shutting down", "error", err)
+		code = 1
+	} else {
+		slog.Info("shutting down")
+	}
+	stop()
+
+	timeout := viper.GetDuration("server.shutdownTimeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	delay := viper.GetDuration("health.shutdownDelay")
+	if code != 0 {
+		// a failed server can't wait for load balancers
+		delay = 0
+	}
+	if err := lc.shutdown(delay, timeout); err != nil {
+		slog.Error("shutdown incomplete", "error", err)
+		code = 1
+	}
+
+	slog.Info("server stopped")
+	os.Exit(code)
+}
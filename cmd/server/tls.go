@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+	certs "todo/internal/certs"
+	logging "todo/internal/logging"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Maps client certificates to principals, and reloads renewed certificates
+func startTLS(lc *lifecycle) {
+	if !viper.GetBool("tls.enabled") {
+		return
+	}
+
+	var principals []struct {
+		Identity string
+		Email    string
+	}
+	if err := viper.UnmarshalKey("tls.principals", &principals); err != nil {
+		logging.Fatal("invalid tls.principals config", "error", err)
+	}
+	for _, p := range principals {
+		certs.Principals[p.Identity] = p.Email
+	}
+
+	interval := viper.GetDuration("tls.reloadInterval")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	lc.addWorker("certificate reload", certs.Watch(lc.ctx, interval))
+}
+
+// TLS configuration of a listener (grpc, http or frontend), nil when TLS is disabled.
+// Settings under tls.<listener> override the ones under tls.
+func listenerTLS(listener string) *tls.Config {
+	if !viper.GetBool("tls.enabled") {
+		return nil
+	}
+
+	config := certs.Config{
+		CertFile:     viper.GetString("tls.certFile"),
+		KeyFile:      viper.GetString("tls.keyFile"),
+		ClientAuth:   viper.GetString("tls." + listener + ".clientAuth"),
+		ClientCAFile: viper.GetString("tls." + listener + ".clientCAFile"),
+	}
+	if viper.IsSet("tls." + listener + ".certFile") {
+		config.CertFile = viper.GetString("tls." + listener + ".certFile")
+		config.KeyFile = viper.GetString("tls." + listener + ".keyFile")
+	}
+
+	tlsConfig, err := certs.ServerTLSConfig(config)
+	if err != nil {
+		logging.Fatal("invalid tls config", "listener", listener, "error", err)
+	}
+	return tlsConfig
+}
+
+// Credentials of the gateway's connection to the gRPC server
+func gatewayCredentials() credentials.TransportCredentials {
+	if !viper.GetBool("tls.enabled") {
+		return insecure.NewCredentials()
+	}
+
+	config := certs.ClientConfig{
+		CAFile:     viper.GetString("tls.gateway.caFile"),
+		ServerName: viper.GetString("tls.gateway.serverName"),
+		CertFile:   viper.GetString("tls.gateway.certFile"),
+		KeyFile:    viper.GetString("tls.gateway.keyFile"),
+	}
+	if config.ServerName == "" {
+		config.ServerName = "localhost"
+	}
+
+	tlsConfig, err := certs.ClientTLSConfig(config)
+	if err != nil {
+		logging.Fatal("invalid tls.gateway config", "error", err)
+	}
+	return credentials.NewTLS(tlsConfig)
+}
+
+// Serves s over TLS when it has a TLS configuration
+func listenAndServe(s *http.Server) func() error {
+	if s.TLSConfig == nil {
+		return s.ListenAndServe
+	}
+	// the certificate comes from TLSConfig.GetCertificate
+	return func() error { return s.ListenAndServeTLS("", "") }
+}
+
+func scheme(tlsConfig *tls.Config) string {
+	if tlsConfig == nil {
+		return "http"
+	}
+	return "https"
+}
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// app token actions, also audited
+const (
+	actionAppTokenCreated = "appToken.created"
+	actionAppTokenDeleted = "appToken.deleted"
+)
+
+// same as the size of main.appToken.name
+const maxAppTokenNameLength = 64
+
+// Returned when an app logs in with an unknown, revoked or someone else's token
+var errInvalidAppToken = status.Error(codes.Unauthenticated, "invalid email or app token")
+
+// Creates a token an app can log in with as the logged in user. The token is only
+// returned here.
+func CreateAppToken(ctx context.Context, email string, in *pb.CreateAppTokenRequest) (*pb.AppToken, error) {
+	// validation
+	if email == "" {
+		return &pb.AppToken{}, errors.New("missing email")
+	}
+
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		return &pb.AppToken{}, errors.New("missing name")
+	}
+	if utf8.RuneCountInString(name) > maxAppTokenNameLength {
+		return &pb.AppToken{}, errors.New("name is too long")
+	}
+	// end validation
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return &pb.AppToken{}, err
+	}
+
+	var token data.AppToken
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		token = data.AppToken{
+			Id:        uuid.New(),
+			UserId:    user.Id,
+			Name:      name,
+			TokenHash: hashToken(secret),
+			Active:    true,
+			CreatedOn: time.Now(),
+		}
+		if err := data.AddAppToken(ctx, token); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionAppTokenCreated,
+			EntityType: "appToken",
+			EntityId:   token.Id.String(),
+			TodoListId: user.TodoListId,
+		}, nil, token)
+	})
+	if err != nil {
+		return &pb.AppToken{}, err
+	}
+
+	res := toAppToken(token)
+	res.Token = secret
+	return res, nil
+}
+
+// Lists the active app tokens of the logged in user, without the tokens themselves
+func ListAppTokens(ctx context.Context, email string) (*pb.ListAppTokensReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ListAppTokensReply{}, errors.New("missing email")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListAppTokensReply{}, err
+	}
+
+	tokens, err := data.ListAppTokens(ctx, user.Id)
+	if err != nil {
+		return &pb.ListAppTokensReply{}, err
+	}
+
+	var res pb.ListAppTokensReply
+	for _, token := range tokens {
+		res.AppTokens = append(res.AppTokens, toAppToken(token))
+	}
+
+	return &res, nil
+}
+
+// Revokes an app token, apps using it can't log in anymore
+func DeleteAppToken(ctx context.Context, email string, in *pb.DeleteAppTokenRequest) (*pb.EmptyReply, error) {
+	// validation
+	if email == "" {
+		return &pb.EmptyReply{}, errors.New("missing email")
+	}
+
+	tokenId, err := uuid.Parse(in.AppTokenId)
+	if err != nil {
+		return &pb.EmptyReply{}, errors.New("missing or invalid appTokenId")
+	}
+	// end validation
+
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		revoked, err := data.RevokeAppToken(ctx, user.Id, tokenId)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return errors.New("app token do not exist")
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionAppTokenDeleted,
+			EntityType: "appToken",
+			EntityId:   tokenId.String(),
+			TodoListId: user.TodoListId,
+		}, nil, nil)
+	})
+	if err != nil {
+		return &pb.EmptyReply{}, err
+	}
+
+	return &pb.EmptyReply{}, nil
+}
+
+// Checks the credentials of an app logging in as email, returning the user
+func AuthenticateAppToken(ctx context.Context, email string, token string) (data.User, error) {
+	if email == "" || token == "" {
+		return data.User{}, errInvalidAppToken
+	}
+
+	user, err := data.GetUser(ctx, email)
+	if err == sql.ErrNoRows {
+		return data.User{}, errInvalidAppToken
+	}
+	if err != nil {
+		return data.User{}, err
+	}
+
+	appToken, err := data.UseAppToken(ctx, hashToken(token))
+	if err == sql.ErrNoRows {
+		return data.User{}, errInvalidAppToken
+	}
+	if err != nil {
+		return data.User{}, err
+	}
+	if appToken.UserId != user.Id {
+		return data.User{}, errInvalidAppToken
+	}
+
+	return user, nil
+}
+
+func toAppToken(token data.AppToken) *pb.AppToken {
+	res := &pb.AppToken{
+		AppTokenId: token.Id.String(),
+		Name:       token.Name,
+		CreatedOn:  token.CreatedOn.Format(time.RFC3339),
+	}
+	if token.LastUsedOn != nil {
+		res.LastUsedOn = token.LastUsedOn.Format(time.RFC3339)
+	}
+	return res
+}
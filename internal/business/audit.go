@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	data "todo/internal/data"
+	requestid "todo/internal/requestid"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// audited actions
+const (
+	actionItemAdded           = "item.added"
+	actionItemDeleted         = "item.deleted"
+	actionItemMarked          = "item.marked"
+	actionItemReverted        = "item.reverted"
+	actionItemUndone          = "item.undone"
+	actionItemUpdated         = "item.updated"
+	actionListSettingsUpdated = "list.settings_updated"
+	actionUserProvisioned     = "user.provisioned"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Appends a change made by actorId to the audit trail, run it in the same
+// transaction as the change itself. before/after are nil when the entity didn't exist.
+func recordAudit(ctx context.Context, event data.AuditEvent, before any, after any) error {
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	event.RequestId = requestid.FromContext(ctx)
+
+	return data.AddAuditEvent(ctx, event)
+}
+
+// Records a change to an item of the actor's list
+func auditItem(ctx context.Context, actorId uuid.UUID, action string, before *data.Item, after *data.Item) error {
+	item := after
+	if item == nil {
+		item = before
+	}
+
+	event := data.AuditEvent{
+		ActorId:    actorId,
+		Action:     action,
+		EntityType: "item",
+		EntityId:   item.Id.String(),
+		TodoListId: item.TodoListId,
+		ItemId:     item.Id,
+	}
+	// avoid typed nil pointers ending up as JSON null
+	var b, a any
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	return recordAudit(ctx, event, b, a)
+}
+
+// Lists the audit trail of the logged in user's list, newest first
+func ListAuditEvents(ctx context.Context, email string, in *pb.ListAuditEventsRequest) (*pb.ListAuditEventsReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ListAuditEventsReply{}, errors.New("missing email")
+	}
+
+	var filter data.AuditEventFilter
+	var err error
+	if in.ItemId != "" {
+		if filter.ItemId, err = uuid.Parse(in.ItemId); err != nil {
+			return &pb.ListAuditEventsReply{}, errors.New("invalid itemId")
+		}
+	}
+	if in.ActorId != "" {
+		if filter.ActorId, err = uuid.Parse(in.ActorId); err != nil {
+			return &pb.ListAuditEventsReply{}, errors.New("invalid actorId")
+		}
+	}
+	if in.From != "" {
+		if filter.From, err = time.Parse(time.RFC3339, in.From); err != nil {
+			return &pb.ListAuditEventsReply{}, errors.New("invalid from, expecting RFC 3339")
+		}
+	}
+	if in.To != "" {
+		if filter.To, err = time.Parse(time.RFC3339, in.To); err != nil {
+			return &pb.ListAuditEventsReply{}, errors.New("invalid to, expecting RFC 3339")
+		}
+	}
+	if in.Limit < 0 {
+		return &pb.ListAuditEventsReply{}, errors.New("invalid limit")
+	}
+	filter.Limit = int(in.Limit)
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListAuditEventsReply{}, err
+	}
+
+	// users only see the trail of their own list
+	if in.TodoListId != "" && in.TodoListId != user.TodoListId.String() {
+		return &pb.ListAuditEventsReply{}, status.Error(codes.PermissionDenied, "todoListId does not belong to the logged in user")
+	}
+	filter.TodoListId = user.TodoListId
+
+	events, err := data.ListAuditEvents(ctx, filter)
+	if err != nil {
+		return &pb.ListAuditEventsReply{}, err
+	}
+
+	var res pb.ListAuditEventsReply
+	res.Count = int32(len(events))
+	for _, event := range events {
+		res.Events = append(res.Events, toAuditEvent(event))
+	}
+
+	return &res, nil
+}
+
+func toAuditEvent(event data.AuditEvent) *pb.AuditEvent {
+	res := &pb.AuditEvent{
+		Id:         event.Id.String(),
+		Action:     event.Action,
+		EntityType: event.EntityType,
+		EntityId:   event.EntityId,
+		Before:     string(event.Before),
+		After:      string(event.After),
+		RequestId:  event.RequestId,
+		CreatedOn:  event.CreatedOn.Format(time.RFC3339Nano),
+	}
+	if event.ActorId != uuid.Nil {
+		res.ActorId = event.ActorId.String()
+	}
+	if event.TodoListId != uuid.Nil {
+		res.TodoListId = event.TodoListId.String()
+	}
+	if event.ItemId != uuid.Nil {
+		res.ItemId = event.ItemId.String()
+	}
+	return res
+}
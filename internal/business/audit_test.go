@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+func Test_ListAuditEvents(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		inEmail       string
+		inReq         *pb.ListAuditEventsRequest
+		expectedCount int32
+		wantErr       bool
+		expectedErr   error
+		mockFunc      func()
+	}{
+		{
+			testName:    "Fail - missing email",
+			inEmail:     "",
+			inReq:       &pb.ListAuditEventsRequest{},
+			wantErr:     true,
+			expectedErr: errors.New("missing email"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - invalid itemId",
+			inEmail:  "test@email.com",
+			inReq: &pb.ListAuditEventsRequest{
+				ItemId: "not-a-uuid",
+			},
+			wantErr:     true,
+			expectedErr: errors.New("invalid itemId"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - list of another user",
+			inEmail:  "test@email.com",
+			inReq: &pb.ListAuditEventsRequest{
+				TodoListId: uuid.NewString(),
+			},
+			wantErr:     true,
+			expectedErr: nil,
+			mockFunc: func() {
+				data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+					return data.User{
+						Id:         testUserId,
+						TodoListId: testTodoListId,
+					}, nil
+				}
+			},
+		},
+		{
+			testName: "Success",
+			inEmail:  "test@email.com",
+			inReq: &pb.ListAuditEventsRequest{
+				ItemId: testItemId.String(),
+			},
+			expectedCount: 1,
+			wantErr:       false,
+			expectedErr:   nil,
+			mockFunc: func() {
+				data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+					return data.User{
+						Id:         testUserId,
+						TodoListId: testTodoListId,
+					}, nil
+				}
+				data.ListAuditEvents = func(ctx context.Context, filter data.AuditEventFilter) ([]data.AuditEvent, error) {
+					if filter.TodoListId != testTodoListId || filter.ItemId != testItemId || filter.Limit != defaultAuditLimit {
+						return nil, errors.New("unexpected filter")
+					}
+					return []data.AuditEvent{
+						{
+							Id:         uuid.New(),
+							ActorId:    testUserId,
+							Action:     actionItemMarked,
+							TodoListId: testTodoListId,
+							ItemId:     testItemId,
+						},
+					}, nil
+				}
+			},
+		},
+	}
+
+	// preserve original function
+	oriGetUser := data.GetUser
+	oriListAuditEvents := data.ListAuditEvents
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			tc.mockFunc()
+			out, err := ListAuditEvents(context.Background(), tc.inEmail, tc.inReq)
+			if tc.wantErr && errors.Is(err, tc.expectedErr) {
+				tt.Errorf("ListAuditEvents failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("ListAuditEvents failed, not expecting err: %v", err)
+			}
+			if out.Count != tc.expectedCount {
+				tt.Errorf("ListAuditEvents failed, got count: %v, want count: %v", out.Count, tc.expectedCount)
+			}
+		})
+	}
+
+	// reset
+	data.GetUser = oriGetUser
+	data.ListAuditEvents = oriListAuditEvents
+}
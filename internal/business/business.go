@@ -3,48 +3,96 @@ package internal
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 	data "todo/internal/data"
+	metrics "todo/internal/metrics"
 	pb "todo/proto/todo"
 
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// Adds a new record into items table, related to the logged in user
-func AddTodo(ctx context.Context, email string, in *pb.AddTodoRequest) (*pb.EmptyReply, error) {
+// Adds a new record into items table, related to the logged in user.
+// Duplicate names are handled according to the list's duplicate policy.
+func AddTodo(ctx context.Context, email string, in *pb.AddTodoRequest) (*pb.TodoItem, error) {
 	// validation
 	if email == "" {
-		return &pb.EmptyReply{}, errors.New("missing email")
+		return &pb.TodoItem{}, errors.New("missing email")
 	}
 
 	if in.ItemName == "" {
-		return &pb.EmptyReply{}, errors.New("missing itemName")
+		return &pb.TodoItem{}, errors.New("missing itemName")
 	}
 
 	if in.ItemDescription == "" {
-		return &pb.EmptyReply{}, errors.New("missing itemDescription")
+		return &pb.TodoItem{}, errors.New("missing itemDescription")
 	}
-	// end validation
 
-	user, err := data.GetUser(ctx, email)
+	due, err := parseDue(in.Due)
 	if err != nil {
-		return &pb.EmptyReply{}, err
+		return &pb.TodoItem{}, err
 	}
-
-	// get todoListId
-	todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
+	categories, err := validatePlanning(int(in.Priority), in.Categories)
 	if err != nil {
-		return &pb.EmptyReply{}, err
+		return &pb.TodoItem{}, err
 	}
+	// end validation
+
+	var item data.Item
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		// get todoListId
+		todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+
+		if err := checkItemQuota(ctx, todoListId); err != nil {
+			return err
+		}
+
+		itemName, err := resolveItemName(ctx, todoListId, in.ItemName)
+		if err != nil {
+			return err
+		}
+
+		// add item
+		itemId, err := data.AddItem(ctx, user.Id, todoListId, itemName, in.ItemDescription)
+		if err == data.ErrDuplicateName {
+			return duplicateItemError(ctx, todoListId, itemName)
+		}
+		if err == data.ErrTodoListNotFound {
+			return status.Error(codes.NotFound, err.Error())
+		}
+		if err != nil {
+			return err
+		}
 
-	// add item
-	_, err = data.AddItem(ctx, user.Id, todoListId, in.ItemName, in.ItemDescription)
+		item = data.Item{
+			Id:          itemId,
+			TodoListId:  todoListId,
+			Name:        itemName,
+			Description: in.ItemDescription,
+			Active:      true,
+			Version:     1,
+		}
+		if err := setItemPlanning(ctx, &item, due, int(in.Priority), categories); err != nil {
+			return err
+		}
+		return recordItemChange(ctx, user.Id, actionItemAdded, data.OperationAdd, nil, &item)
+	})
 	if err != nil {
-		return &pb.EmptyReply{}, err
+		return &pb.TodoItem{}, err
 	}
 
-	return &pb.EmptyReply{}, nil
+	return toTodoItem(item), nil
 }
 
 // Soft delete an existing record into items table, related to the logged in user
@@ -59,31 +107,50 @@ func DeleteTodo(ctx context.Context, email string, in *pb.UpdateTodoRequest) (*p
 	}
 	// end validation
 
-	user, err := data.GetUser(ctx, email)
-	if err != nil {
-		return &pb.EmptyReply{}, err
-	}
+	// read and update the item in one transaction so concurrent calls can't interleave
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
 
-	// get todoListId
-	todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
-	if err != nil {
-		return &pb.EmptyReply{}, err
-	}
+		// get todoListId
+		todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
+		if err != nil {
+			return err
+		}
 
-	// get item
-	item, err := data.GetItemByItemName(ctx, todoListId, in.ItemName)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return &pb.EmptyReply{}, errors.New("item do not exist")
+		// get item
+		item, err := data.GetItemByItemName(ctx, todoListId, in.ItemName)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("item do not exist")
+			}
+			return err
+		}
+
+		// reject stale writes
+		if !etagMatches(in.Etag, item.Version) {
+			return staleItemError(item)
 		}
-		return &pb.EmptyReply{}, err
-	}
 
-	// only update "active" column
-	item.Active = false
+		before := item
 
-	// update item (soft delete)
-	_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		// only update "active" column
+		item.Active = false
+
+		// update item (soft delete)
+		_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		if err == data.ErrVersionConflict {
+			return staleItemError(item)
+		}
+		if err != nil {
+			return err
+		}
+		item.Version++
+
+		return recordItemChange(ctx, user.Id, actionItemDeleted, data.OperationDelete, &before, &item)
+	})
 	if err != nil {
 		return &pb.EmptyReply{}, err
 	}
@@ -114,21 +181,32 @@ func ListTodo(ctx context.Context, email string) (*pb.ListTodoReply, error) {
 		return &pb.ListTodoReply{}, err
 	}
 
-	// format into json for reply
 	var res pb.ListTodoReply
 	res.Count = int32(len(items))
-	j, err := json.Marshal(items)
-	if err != nil {
-		return &pb.ListTodoReply{}, err
-	}
-	err = json.Unmarshal(j, &res.Items)
-	if err != nil {
-		return &pb.ListTodoReply{}, err
+	for _, item := range items {
+		res.Items = append(res.Items, toTodoItem(item))
 	}
 
 	return &res, nil
 }
 
+// Formats a stored item for replies
+func toTodoItem(item data.Item) *pb.TodoItem {
+	res := &pb.TodoItem{
+		ItemName:        item.Name,
+		ItemDescription: item.Description,
+		Done:            item.MarkDone,
+		Etag:            ETag(item.Version),
+		ItemId:          item.Id.String(),
+		Priority:        int32(item.Priority),
+		Categories:      item.Categories,
+	}
+	if item.Due != nil {
+		res.Due = item.Due.UTC().Format(time.RFC3339)
+	}
+	return res
+}
+
 func MarkTodo(ctx context.Context, email string, in *pb.UpdateTodoRequest) (*pb.EmptyReply, error) {
 	// validation
 	if email == "" {
@@ -140,32 +218,51 @@ func MarkTodo(ctx context.Context, email string, in *pb.UpdateTodoRequest) (*pb.
 	}
 	// end validation
 
-	user, err := data.GetUser(ctx, email)
-	if err != nil {
-		return &pb.EmptyReply{}, err
-	}
+	// read and update the item in one transaction so concurrent calls can't interleave
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
 
-	// get todoListId
-	todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
-	if err != nil {
-		return &pb.EmptyReply{}, err
-	}
+		// get todoListId
+		todoListId, err := data.GetTodoListIdByUserId(ctx, user.Id)
+		if err != nil {
+			return err
+		}
 
-	// get item
-	item, err := data.GetItemByItemName(ctx, todoListId, in.ItemName)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return &pb.EmptyReply{}, errors.New("item do not exist")
+		// get item
+		item, err := data.GetItemByItemName(ctx, todoListId, in.ItemName)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("item do not exist")
+			}
+			return err
 		}
-		return &pb.EmptyReply{}, err
-	}
 
-	// update value
-	item.MarkDone = true
-	item.Active = true
+		// reject stale writes
+		if !etagMatches(in.Etag, item.Version) {
+			return staleItemError(item)
+		}
+
+		before := item
+
+		// update value
+		item.MarkDone = true
+		item.Active = true
+
+		// update item
+		_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		if err == data.ErrVersionConflict {
+			return staleItemError(item)
+		}
+		if err != nil {
+			return err
+		}
+		item.Version++
 
-	// update item
-	_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		return recordItemChange(ctx, user.Id, actionItemMarked, data.OperationMark, &before, &item)
+	})
 	if err != nil {
 		return &pb.EmptyReply{}, err
 	}
@@ -185,16 +282,39 @@ func AddNewUser(ctx context.Context, email string) (uuid.UUID, error) {
 	}
 	// end validation
 
-	// add a new todolist for the new user
-	todoListId, err := data.AddTodoList(ctx)
-	if err != nil {
-		return uuid.Nil, errors.New("AddTodoList failed: " + err.Error())
-	}
+	// todolist and user are created together, so a failure never leaves an orphan list
+	var userId uuid.UUID
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		// add a new todolist for the new user
+		todoListId, err := data.AddTodoList(ctx)
+		if err != nil {
+			return fmt.Errorf("AddTodoList failed: %w", err)
+		}
+
+		// add a new user
+		userId, err = data.AddUser(ctx, email, todoListId)
+		if err != nil {
+			return fmt.Errorf("AddUser failed: %w", err)
+		}
+
+		provisioned := map[string]string{"userId": userId.String(), "email": email, "todoListId": todoListId.String()}
+		err = recordAudit(ctx, data.AuditEvent{
+			ActorId:    userId,
+			Action:     actionUserProvisioned,
+			EntityType: "user",
+			EntityId:   userId.String(),
+			TodoListId: todoListId,
+		}, nil, provisioned)
+		if err != nil {
+			return err
+		}
+
+		data.AfterCommit(ctx, metrics.UserProvisioned)
 
-	// add a new user
-	userId, err := data.AddUser(ctx, email, todoListId)
+		return publishEvent(ctx, eventUserProvisioned, "user", userId.String(), todoListId, provisioned)
+	})
 	if err != nil {
-		return uuid.Nil, errors.New("AddUser failed: " + err.Error())
+		return uuid.Nil, err
 	}
 
 	return userId, nil
@@ -210,7 +330,7 @@ func CheckUserExists(ctx context.Context, email string) (bool, error) {
 
 	_, err := data.GetUser(ctx, email)
 	if err != nil && err != sql.ErrNoRows {
-		return false, errors.New("GetUser failed: " + err.Error())
+		return false, fmt.Errorf("GetUser failed: %w", err)
 	}
 	if err == sql.ErrNoRows {
 		return false, nil
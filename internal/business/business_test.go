@@ -10,6 +10,9 @@ import (
 	pb "todo/proto/todo"
 
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -50,9 +53,23 @@ func Test_AddNewUser(t *testing.T) {
 	}
 
 	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
 	oriAddTodoList := data.AddTodoList
 	oriAddUser := data.AddUser
 
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(tt *testing.T) {
 			tc.mockFunc()
@@ -67,6 +84,9 @@ func Test_AddNewUser(t *testing.T) {
 	}
 
 	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
 	data.AddTodoList = oriAddTodoList
 	data.AddUser = oriAddUser
 }
@@ -143,12 +163,16 @@ func Test_CheckUserExists(t *testing.T) {
 
 func Test_AddTodo(t *testing.T) {
 	testCases := []struct {
-		testName    string
-		inEmail     string
-		inReq       *pb.AddTodoRequest
-		wantErr     bool
-		expectedErr error
-		mockFunc    func()
+		testName     string
+		inEmail      string
+		inReq        *pb.AddTodoRequest
+		expectedName string
+		expectedCode codes.Code
+		// id of the existing item reported in the ResourceInfo detail
+		expectedConflictId uuid.UUID
+		wantErr            bool
+		expectedErr        error
+		mockFunc           func()
 	}{
 		{
 			testName: "Fail - missing email",
@@ -183,6 +207,30 @@ func Test_AddTodo(t *testing.T) {
 			expectedErr: errors.New("missing itemDescription"),
 			mockFunc:    func() {},
 		},
+		{
+			testName: "Fail - invalid due",
+			inEmail:  "test@email.com",
+			inReq: &pb.AddTodoRequest{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+				Due:             "tomorrow",
+			},
+			wantErr:     true,
+			expectedErr: errors.New("invalid due tomorrow, expecting an RFC 3339 timestamp or a date"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - invalid priority",
+			inEmail:  "test@email.com",
+			inReq: &pb.AddTodoRequest{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+				Priority:        10,
+			},
+			wantErr:     true,
+			expectedErr: errors.New("invalid priority 10, expecting 0 to 9"),
+			mockFunc:    func() {},
+		},
 		{
 			testName: "Fail - user do not exist",
 			inEmail:  "test2@email.com",
@@ -218,45 +266,158 @@ func Test_AddTodo(t *testing.T) {
 				data.GetTodoListIdByUserId = func(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
 					return testTodoListId, nil
 				}
+				data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+					return data.TodoList{
+						Id:              testTodoListId,
+						DuplicatePolicy: data.DuplicatePolicyReject,
+					}, nil
+				}
+				data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+					return data.Item{}, sql.ErrNoRows
+				}
 				data.AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
 					return uuid.New(), nil
 				}
 			},
 		},
+		{
+			testName: "Fail - duplicate name rejected",
+			inEmail:  "test@email.com",
+			inReq: &pb.AddTodoRequest{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+			},
+			wantErr:            true,
+			expectedErr:        nil,
+			expectedCode:       codes.AlreadyExists,
+			expectedConflictId: testItemId,
+			mockFunc: func() {
+				data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+					return data.TodoList{
+						Id:              testTodoListId,
+						DuplicatePolicy: data.DuplicatePolicyReject,
+					}, nil
+				}
+				data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+					return data.Item{
+						Id:   testItemId,
+						Name: "Item1",
+					}, nil
+				}
+			},
+		},
+		{
+			testName: "Success - duplicate name auto suffixed",
+			inEmail:  "test@email.com",
+			inReq: &pb.AddTodoRequest{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+			},
+			expectedName: "item1 (3)",
+			wantErr:      false,
+			expectedErr:  nil,
+			mockFunc: func() {
+				data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+					return data.TodoList{
+						Id:              testTodoListId,
+						DuplicatePolicy: data.DuplicatePolicyAutoSuffix,
+					}, nil
+				}
+				data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+					if itemName == "item1" || itemName == "item1 (2)" {
+						return data.Item{Id: testItemId, Name: itemName}, nil
+					}
+					return data.Item{}, sql.ErrNoRows
+				}
+			},
+		},
+		{
+			testName: "Fail - todo list not found",
+			inEmail:  "test@email.com",
+			inReq: &pb.AddTodoRequest{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+			},
+			wantErr:      true,
+			expectedErr:  nil,
+			expectedCode: codes.NotFound,
+			mockFunc: func() {
+				data.AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
+					return uuid.Nil, data.ErrTodoListNotFound
+				}
+			},
+		},
 	}
 
 	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriAddOperation := data.AddOperation
 	oriGetUser := data.GetUser
 	oriGetTodoListIdByUserId := data.GetTodoListIdByUserId
 	oriAddTodo := data.AddItem
+	oriGetTodoList := data.GetTodoList
+	oriGetItemByItemNameFold := data.GetItemByItemNameFold
+
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
 
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(tt *testing.T) {
 			tc.mockFunc()
-			_, err := AddTodo(context.Background(), tc.inEmail, tc.inReq)
+			out, err := AddTodo(context.Background(), tc.inEmail, tc.inReq)
 			if tc.wantErr && errors.Is(err, tc.expectedErr) {
 				tt.Errorf("AddTodo failed, got err: %v, want err: %v", err, tc.expectedErr)
 			}
 			if !tc.wantErr && err != nil {
 				tt.Errorf("AddTodo failed, not expecting err: %v", err)
 			}
+			if tc.expectedCode != codes.OK && status.Code(err) != tc.expectedCode {
+				tt.Errorf("AddTodo failed, got code: %v, want code: %v", status.Code(err), tc.expectedCode)
+			}
+			if tc.expectedConflictId != uuid.Nil && conflictId(err) != tc.expectedConflictId.String() {
+				tt.Errorf("AddTodo failed, got conflicting itemId: %v, want itemId: %v", conflictId(err), tc.expectedConflictId)
+			}
+			if tc.expectedName != "" && out.ItemName != tc.expectedName {
+				tt.Errorf("AddTodo failed, got itemName: %v, want itemName: %v", out.ItemName, tc.expectedName)
+			}
 		})
 	}
 
 	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.AddOperation = oriAddOperation
 	data.GetUser = oriGetUser
 	data.GetTodoListIdByUserId = oriGetTodoListIdByUserId
 	data.AddItem = oriAddTodo
+	data.GetTodoList = oriGetTodoList
+	data.GetItemByItemNameFold = oriGetItemByItemNameFold
 }
 
 func Test_MarkTodo(t *testing.T) {
 	testCases := []struct {
-		testName    string
-		inEmail     string
-		inReq       *pb.UpdateTodoRequest
-		wantErr     bool
-		expectedErr error
-		mockFunc    func()
+		testName             string
+		inEmail              string
+		inReq                *pb.UpdateTodoRequest
+		wantErr              bool
+		expectedErr          error
+		expectedCode         codes.Code
+		expectedPrecondition bool
+		mockFunc             func()
 	}{
 		{
 			testName: "Fail - missing email",
@@ -294,6 +455,34 @@ func Test_MarkTodo(t *testing.T) {
 				}
 			},
 		},
+		{
+			testName: "Fail - stale etag",
+			inEmail:  "test@email.com",
+			inReq: &pb.UpdateTodoRequest{
+				ItemName: "item1",
+				Etag:     `"1"`,
+			},
+			wantErr:              true,
+			expectedErr:          nil,
+			expectedCode:         codes.Aborted,
+			expectedPrecondition: true,
+			mockFunc: func() {
+				data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+					return data.User{
+						Id: testUserId,
+					}, nil
+				}
+				data.GetTodoListIdByUserId = func(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+					return testTodoListId, nil
+				}
+				data.GetItemByItemName = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+					return data.Item{
+						Id:      testItemId,
+						Version: 2,
+					}, nil
+				}
+			},
+		},
 		{
 			testName: "Success",
 			inEmail:  "test@email.com",
@@ -324,11 +513,29 @@ func Test_MarkTodo(t *testing.T) {
 	}
 
 	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriAddOperation := data.AddOperation
 	oriGetUser := data.GetUser
 	oriGetTodoListIdByUserId := data.GetTodoListIdByUserId
 	oriGetItemByItemName := data.GetItemByItemName
 	oriUpdateItem := data.UpdateItem
 
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(tt *testing.T) {
 			tc.mockFunc()
@@ -339,10 +546,20 @@ func Test_MarkTodo(t *testing.T) {
 			if !tc.wantErr && err != nil {
 				tt.Errorf("MarkTodo failed, not expecting err: %v", err)
 			}
+			if tc.expectedCode != codes.OK && status.Code(err) != tc.expectedCode {
+				tt.Errorf("MarkTodo failed, got code: %v, want code: %v", status.Code(err), tc.expectedCode)
+			}
+			if tc.expectedPrecondition && !hasPreconditionFailure(err) {
+				tt.Errorf("MarkTodo failed, expecting a PreconditionFailure detail in %v", err)
+			}
 		})
 	}
 
 	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.AddOperation = oriAddOperation
 	data.GetUser = oriGetUser
 	data.GetTodoListIdByUserId = oriGetTodoListIdByUserId
 	data.GetItemByItemName = oriGetItemByItemName
@@ -351,12 +568,14 @@ func Test_MarkTodo(t *testing.T) {
 
 func Test_DeleteTodo(t *testing.T) {
 	testCases := []struct {
-		testName    string
-		inEmail     string
-		inReq       *pb.UpdateTodoRequest
-		wantErr     bool
-		expectedErr error
-		mockFunc    func()
+		testName             string
+		inEmail              string
+		inReq                *pb.UpdateTodoRequest
+		wantErr              bool
+		expectedErr          error
+		expectedCode         codes.Code
+		expectedPrecondition bool
+		mockFunc             func()
 	}{
 		{
 			testName: "Fail - missing email",
@@ -394,6 +613,34 @@ func Test_DeleteTodo(t *testing.T) {
 				}
 			},
 		},
+		{
+			testName: "Fail - stale etag",
+			inEmail:  "test@email.com",
+			inReq: &pb.UpdateTodoRequest{
+				ItemName: "item1",
+				Etag:     `"1"`,
+			},
+			wantErr:              true,
+			expectedErr:          nil,
+			expectedCode:         codes.Aborted,
+			expectedPrecondition: true,
+			mockFunc: func() {
+				data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+					return data.User{
+						Id: testUserId,
+					}, nil
+				}
+				data.GetTodoListIdByUserId = func(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+					return testTodoListId, nil
+				}
+				data.GetItemByItemName = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+					return data.Item{
+						Id:      testItemId,
+						Version: 2,
+					}, nil
+				}
+			},
+		},
 		{
 			testName: "Success",
 			inEmail:  "test@email.com",
@@ -424,11 +671,29 @@ func Test_DeleteTodo(t *testing.T) {
 	}
 
 	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriAddOperation := data.AddOperation
 	oriGetUser := data.GetUser
 	oriGetTodoListIdByUserId := data.GetTodoListIdByUserId
 	oriGetItemByItemName := data.GetItemByItemName
 	oriUpdateItem := data.UpdateItem
 
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+
 	for _, tc := range testCases {
 		t.Run(tc.testName, func(tt *testing.T) {
 			tc.mockFunc()
@@ -439,10 +704,20 @@ func Test_DeleteTodo(t *testing.T) {
 			if !tc.wantErr && err != nil {
 				tt.Errorf("DeleteTodo failed, not expecting err: %v", err)
 			}
+			if tc.expectedCode != codes.OK && status.Code(err) != tc.expectedCode {
+				tt.Errorf("DeleteTodo failed, got code: %v, want code: %v", status.Code(err), tc.expectedCode)
+			}
+			if tc.expectedPrecondition && !hasPreconditionFailure(err) {
+				tt.Errorf("DeleteTodo failed, expecting a PreconditionFailure detail in %v", err)
+			}
 		})
 	}
 
 	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.AddOperation = oriAddOperation
 	data.GetUser = oriGetUser
 	data.GetTodoListIdByUserId = oriGetTodoListIdByUserId
 	data.GetItemByItemName = oriGetItemByItemName
@@ -490,6 +765,8 @@ func Test_ListTodo(t *testing.T) {
 						ItemName:        "test1",
 						ItemDescription: "desc1",
 						Done:            false,
+						Etag:            `"1"`,
+						ItemId:          testItemId.String(),
 					},
 				},
 			},
@@ -507,10 +784,11 @@ func Test_ListTodo(t *testing.T) {
 				data.ListItem = func(ctx context.Context, todoListId uuid.UUID) ([]data.Item, error) {
 					return []data.Item{
 						{
-							Id:          uuid.New(),
+							Id:          testItemId,
 							Name:        "test1",
 							Description: "desc1",
 							MarkDone:    false,
+							Version:     1,
 						},
 					}, nil
 				}
@@ -544,3 +822,13 @@ func Test_ListTodo(t *testing.T) {
 	data.GetTodoListIdByUserId = oriGetTodoListIdByUserId
 	data.ListItem = oriListItem
 }
+
+// Returns the item id of the ResourceInfo detail of a name conflict
+func conflictId(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ResourceInfo); ok {
+			return info.ResourceName
+		}
+	}
+	return ""
+}
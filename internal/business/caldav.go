@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	data "todo/internal/data"
+	ical "todo/internal/ical"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Use cases of the CalDAV server, where every item of a list is a VTODO resource named
+// by its CalDAV resource name. Unlike the other use cases they return items as stored,
+// the CalDAV server renders them.
+
+// Lists the active items of the user's list, oldest first
+func ListCalendarItems(ctx context.Context, email string) ([]data.Item, error) {
+	// validation
+	if email == "" {
+		return nil, errors.New("missing email")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []data.Item
+	var after data.Item
+	for {
+		page, err := data.ListItemPage(ctx, user.TodoListId, after, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		if len(page) < exportPageSize {
+			break
+		}
+		after = page[len(page)-1]
+	}
+
+	return items, nil
+}
+
+// Returns the active item with the given resource name
+func GetCalendarItem(ctx context.Context, email string, name string) (data.Item, error) {
+	// validation
+	if email == "" {
+		return data.Item{}, errors.New("missing email")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return data.Item{}, err
+	}
+
+	return getCalendarItem(ctx, user.TodoListId, name)
+}
+
+// Creates or replaces the item with the given resource name from an iCalendar object
+// holding one VTODO. ifMatch and ifNoneMatch are the HTTP preconditions of the PUT.
+// Returns the stored item and whether it was created.
+func PutCalendarItem(ctx context.Context, email string, name string, ifMatch string, ifNoneMatch string, content string) (data.Item, bool, error) {
+	// validation
+	if email == "" {
+		return data.Item{}, false, errors.New("missing email")
+	}
+
+	if name == "" {
+		return data.Item{}, false, status.Error(codes.InvalidArgument, "missing resource name")
+	}
+
+	todos, err := ical.Parse(content)
+	if err != nil {
+		return data.Item{}, false, status.Error(codes.InvalidArgument, "invalid iCalendar: "+err.Error())
+	}
+	if len(todos) != 1 {
+		return data.Item{}, false, status.Error(codes.InvalidArgument, "expecting exactly one VTODO")
+	}
+	todo := todos[0]
+
+	// the same rules as imports
+	row := fromVTodo(1, todo)
+	validateImportRow(row)
+	if len(row.errors) > 0 {
+		var messages []string
+		for _, rowErr := range row.errors {
+			messages = append(messages, rowErr.Message)
+		}
+		return data.Item{}, false, status.Error(codes.InvalidArgument, strings.Join(messages, ", "))
+	}
+	// end validation
+
+	var item data.Item
+	var created bool
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		existing, err := getCalendarItem(ctx, user.TodoListId, name)
+		if status.Code(err) == codes.NotFound {
+			if ifMatch != "" {
+				return status.Error(codes.FailedPrecondition, "resource "+name+" do not exist")
+			}
+
+			if err := checkItemQuota(ctx, user.TodoListId); err != nil {
+				return err
+			}
+
+			created = true
+			added, err := importItem(ctx, user.Id, user.TodoListId, row)
+			if err != nil {
+				return err
+			}
+			if added == nil {
+				return status.Error(codes.AlreadyExists, row.errors[0].Message)
+			}
+			item = *added
+
+			if err := data.SetItemCalendarName(ctx, item.Id, todo.UID, name); err != nil {
+				return err
+			}
+			item.CalendarUid, item.CalendarName = todo.UID, name
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// reject stale writes
+		if strings.TrimSpace(ifNoneMatch) == "*" || !etagMatches(ifMatch, existing.Version) {
+			return staleItemError(existing)
+		}
+
+		item, err = updateCalendarItem(ctx, user, existing, row)
+		return err
+	})
+	if err != nil {
+		return data.Item{}, false, err
+	}
+
+	return item, created, nil
+}
+
+// Applies the fields of a VTODO to an existing item
+func updateCalendarItem(ctx context.Context, user data.User, item data.Item, row *importRow) (data.Item, error) {
+	before := item
+
+	item.Name = row.name
+	item.Description = row.description
+	item.MarkDone = row.done
+
+	// clients send the whole VTODO, a change of only the status is marking the item
+	action, kind := actionItemUpdated, data.OperationEdit
+	if item.Name == before.Name && item.Description == before.Description {
+		if item.MarkDone == before.MarkDone && planningEqual(before, row) {
+			return item, nil
+		}
+		if item.MarkDone != before.MarkDone && planningEqual(before, row) {
+			action, kind = actionItemMarked, data.OperationMark
+		}
+	}
+
+	_, err := data.UpdateItem(ctx, item.Id.String(), item)
+	if err == data.ErrVersionConflict {
+		return data.Item{}, staleItemError(before)
+	}
+	if err == data.ErrDuplicateName {
+		return data.Item{}, duplicateItemError(ctx, item.TodoListId, item.Name)
+	}
+	if err != nil {
+		return data.Item{}, err
+	}
+	item.Version++
+
+	if err := data.SetItemPlanning(ctx, item.Id, row.due, row.priority, row.categories); err != nil {
+		return data.Item{}, err
+	}
+	item.Due, item.Priority, item.Categories = row.due, row.priority, row.categories
+
+	return item, recordItemChange(ctx, user.Id, action, kind, &before, &item)
+}
+
+func planningEqual(item data.Item, row *importRow) bool {
+	sameDue := (item.Due == nil && row.due == nil) || (item.Due != nil && row.due != nil && item.Due.Equal(*row.due))
+	return sameDue && item.Priority == row.priority && slices.Equal(item.Categories, row.categories)
+}
+
+// Soft deletes the item with the given resource name, ifMatch is the HTTP precondition
+func DeleteCalendarItem(ctx context.Context, email string, name string, ifMatch string) error {
+	// validation
+	if email == "" {
+		return errors.New("missing email")
+	}
+	// end validation
+
+	return data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		item, err := getCalendarItem(ctx, user.TodoListId, name)
+		if err != nil {
+			return err
+		}
+
+		// reject stale writes
+		if !etagMatches(ifMatch, item.Version) {
+			return staleItemError(item)
+		}
+
+		before := item
+		item.Active = false
+
+		_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		if err == data.ErrVersionConflict {
+			return staleItemError(before)
+		}
+		if err != nil {
+			return err
+		}
+		item.Version++
+
+		return recordItemChange(ctx, user.Id, actionItemDeleted, data.OperationDelete, &before, &item)
+	})
+}
+
+// Name of the CalDAV resource of an item
+func CalendarResourceName(item data.Item) string {
+	if item.CalendarName != "" {
+		return item.CalendarName
+	}
+	return item.Id.String() + ".ics"
+}
+
+// The iCalendar object of an item's CalDAV resource
+func CalendarObject(item data.Item) []byte {
+	return ical.Marshal("", []ical.Todo{toVTodo(item)})
+}
+
+func getCalendarItem(ctx context.Context, todoListId uuid.UUID, name string) (data.Item, error) {
+	item, err := data.GetItemByCalendarName(ctx, todoListId, name)
+	if err == sql.ErrNoRows {
+		return data.Item{}, status.Error(codes.NotFound, "resource "+name+" do not exist")
+	}
+	return item, err
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	data "todo/internal/data"
+	ical "todo/internal/ical"
+	pb "todo/proto/todo"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// calendar feed actions, also audited
+const (
+	actionCalendarFeedCreated = "calendarFeed.created"
+	actionCalendarFeedDeleted = "calendarFeed.deleted"
+)
+
+const maxItemCategories = 20
+
+// Creates the .ics feed of the logged in user's list, or replaces its token so the
+// previous URL stops working. The token is only returned here.
+func CreateCalendarFeed(ctx context.Context, email string) (*pb.CalendarFeed, error) {
+	// validation
+	if email == "" {
+		return &pb.CalendarFeed{}, errors.New("missing email")
+	}
+	// end validation
+
+	// same strength as the webhook secrets
+	token, err := newWebhookSecret()
+	if err != nil {
+		return &pb.CalendarFeed{}, err
+	}
+
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := data.UpdateCalendarTokenHash(ctx, user.TodoListId, hashToken(token)); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionCalendarFeedCreated,
+			EntityType: "calendarFeed",
+			EntityId:   user.TodoListId.String(),
+			TodoListId: user.TodoListId,
+		}, nil, nil)
+	})
+	if err != nil {
+		return &pb.CalendarFeed{}, err
+	}
+
+	return &pb.CalendarFeed{Token: token, Path: "/v1/todo/calendar/" + token + ".ics"}, nil
+}
+
+// Removes the .ics feed of the logged in user's list
+func DeleteCalendarFeed(ctx context.Context, email string) (*pb.EmptyReply, error) {
+	// validation
+	if email == "" {
+		return &pb.EmptyReply{}, errors.New("missing email")
+	}
+	// end validation
+
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := data.UpdateCalendarTokenHash(ctx, user.TodoListId, ""); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionCalendarFeedDeleted,
+			EntityType: "calendarFeed",
+			EntityId:   user.TodoListId.String(),
+			TodoListId: user.TodoListId,
+		}, nil, nil)
+	})
+	if err != nil {
+		return &pb.EmptyReply{}, err
+	}
+
+	return &pb.EmptyReply{}, nil
+}
+
+// Serves the active items of the list the token belongs to as VTODOs. The token is the
+// only credential, so unknown tokens are reported as not found.
+func GetCalendarFeed(ctx context.Context, in *pb.GetCalendarFeedRequest) (*httpbody.HttpBody, error) {
+	// validation
+	token := strings.TrimSuffix(in.Token, ".ics")
+	if token == "" {
+		return &httpbody.HttpBody{}, errors.New("missing token")
+	}
+	// end validation
+
+	todoList, err := data.GetTodoListByCalendarTokenHash(ctx, hashToken(token))
+	if err == sql.ErrNoRows {
+		return &httpbody.HttpBody{}, status.Error(codes.NotFound, "calendar feed not found")
+	}
+	if err != nil {
+		return &httpbody.HttpBody{}, err
+	}
+
+	var todos []ical.Todo
+	var after data.Item
+	for {
+		items, err := data.ListItemPage(ctx, todoList.Id, after, exportPageSize)
+		if err != nil {
+			return &httpbody.HttpBody{}, err
+		}
+		for _, item := range items {
+			todos = append(todos, toVTodo(item))
+		}
+
+		if len(items) < exportPageSize {
+			break
+		}
+		after = items[len(items)-1]
+	}
+
+	return &httpbody.HttpBody{ContentType: ical.ContentType, Data: ical.Marshal("Todo list", todos)}, nil
+}
+
+// Only hashes of feed and app tokens are stored, a leaked database doesn't expose them
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Converts an item to a VTODO. The UID is the one given by the CalDAV client that
+// created the item, or else the item id.
+func toVTodo(item data.Item) ical.Todo {
+	uid := item.CalendarUid
+	if uid == "" {
+		uid = item.Id.String()
+	}
+
+	return ical.Todo{
+		UID:          uid,
+		Summary:      item.Name,
+		Description:  item.Description,
+		Completed:    item.MarkDone,
+		Due:          item.Due,
+		Priority:     item.Priority,
+		Categories:   item.Categories,
+		Created:      item.CreatedOn,
+		LastModified: item.UpdatedOn,
+	}
+}
+
+// Converts a VTODO to an import row, the summary doubles as the description when
+// the VTODO has none
+func fromVTodo(row int, todo ical.Todo) *importRow {
+	r := &importRow{
+		row:         row,
+		name:        todo.Summary,
+		description: todo.Description,
+		done:        todo.Completed,
+		due:         todo.Due,
+		priority:    todo.Priority,
+		categories:  todo.Categories,
+	}
+	if r.description == "" {
+		r.description = r.name
+	}
+	for _, err := range todo.Errors {
+		r.fail(strings.ToLower(err.Property), err.Message)
+	}
+	return r
+}
+
+// Reads a due date given as an RFC 3339 timestamp or a date, empty means none
+func parseDue(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if due, err := time.Parse(time.RFC3339, value); err == nil {
+		return &due, nil
+	}
+	if due, err := time.Parse(time.DateOnly, value); err == nil {
+		return &due, nil
+	}
+	return nil, errors.New("invalid due " + value + ", expecting an RFC 3339 timestamp or a date")
+}
+
+// Checks the calendar fields of an item, returning the categories trimmed and without
+// duplicates
+func validatePlanning(priority int, categories []string) ([]string, error) {
+	if priority < 0 || priority > 9 {
+		return nil, errors.New("invalid priority " + strconv.Itoa(priority) + ", expecting 0 to 9")
+	}
+
+	var cleaned []string
+	seen := map[string]bool{}
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category == "" || seen[strings.ToLower(category)] {
+			continue
+		}
+		seen[strings.ToLower(category)] = true
+		cleaned = append(cleaned, category)
+	}
+	if len(cleaned) > maxItemCategories {
+		return nil, errors.New("more than " + strconv.Itoa(maxItemCategories) + " categories")
+	}
+
+	return cleaned, nil
+}
+
+// Saves the calendar fields of an item that was just added, if it has any
+func setItemPlanning(ctx context.Context, item *data.Item, due *time.Time, priority int, categories []string) error {
+	if due == nil && priority == 0 && len(categories) == 0 {
+		return nil
+	}
+	if err := data.SetItemPlanning(ctx, item.Id, due, priority, categories); err != nil {
+		return err
+	}
+
+	item.Due = due
+	item.Priority = priority
+	item.Categories = categories
+	return nil
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_CalendarFeed(t *testing.T) {
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriGetUser := data.GetUser
+	oriUpdateCalendarTokenHash := data.UpdateCalendarTokenHash
+	oriGetTodoListByCalendarTokenHash := data.GetTodoListByCalendarTokenHash
+	oriListItemPage := data.ListItemPage
+
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	tokenHashes := map[uuid.UUID]string{}
+	data.UpdateCalendarTokenHash = func(ctx context.Context, todoListId uuid.UUID, tokenHash string) error {
+		tokenHashes[todoListId] = tokenHash
+		return nil
+	}
+	data.GetTodoListByCalendarTokenHash = func(ctx context.Context, tokenHash string) (data.TodoList, error) {
+		for todoListId, hash := range tokenHashes {
+			if hash != "" && hash == tokenHash {
+				return data.TodoList{Id: todoListId}, nil
+			}
+		}
+		return data.TodoList{}, sql.ErrNoRows
+	}
+	due := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	data.ListItemPage = func(ctx context.Context, todoListId uuid.UUID, after data.Item, limit int) ([]data.Item, error) {
+		return []data.Item{{Id: testItemId, Name: "item1", Description: "desc1", Due: &due, Priority: 2, Categories: []string{"home"}}}, nil
+	}
+
+	feed, err := CreateCalendarFeed(context.Background(), "test@email.com")
+	if err != nil {
+		t.Fatalf("CreateCalendarFeed failed, not expecting err: %v", err)
+	}
+	if len(feed.Token) != 64 || feed.Path != "/v1/todo/calendar/"+feed.Token+".ics" {
+		t.Errorf("CreateCalendarFeed failed, got %v", feed)
+	}
+	if tokenHashes[testTodoListId] == feed.Token {
+		t.Errorf("CreateCalendarFeed failed, stored the token instead of its hash")
+	}
+
+	res, err := GetCalendarFeed(context.Background(), &pb.GetCalendarFeedRequest{Token: feed.Token + ".ics"})
+	if err != nil {
+		t.Fatalf("GetCalendarFeed failed, not expecting err: %v", err)
+	}
+	body := string(res.Data)
+	for _, expected := range []string{"UID:" + testItemId.String(), "SUMMARY:item1", "DUE:20240201T090000Z", "PRIORITY:2", "CATEGORIES:home"} {
+		if !strings.Contains(body, expected+"\r\n") {
+			t.Errorf("GetCalendarFeed failed, missing %q in %q", expected, body)
+		}
+	}
+
+	if _, err := DeleteCalendarFeed(context.Background(), "test@email.com"); err != nil {
+		t.Fatalf("DeleteCalendarFeed failed, not expecting err: %v", err)
+	}
+	_, err = GetCalendarFeed(context.Background(), &pb.GetCalendarFeedRequest{Token: feed.Token})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetCalendarFeed failed, got err: %v, want NotFound", err)
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.GetUser = oriGetUser
+	data.UpdateCalendarTokenHash = oriUpdateCalendarTokenHash
+	data.GetTodoListByCalendarTokenHash = oriGetTodoListByCalendarTokenHash
+	data.ListItemPage = oriListItemPage
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// same as the size of main.item.name
+const maxItemNameLength = 64
+
+// gives up looking for a free "name (n)" after this many tries
+const maxAutoSuffix = 100
+
+var duplicatePolicies = map[pb.DuplicatePolicy]string{
+	pb.DuplicatePolicy_DUPLICATE_POLICY_REJECT:      data.DuplicatePolicyReject,
+	pb.DuplicatePolicy_DUPLICATE_POLICY_ALLOW:       data.DuplicatePolicyAllow,
+	pb.DuplicatePolicy_DUPLICATE_POLICY_AUTO_SUFFIX: data.DuplicatePolicyAutoSuffix,
+}
+
+// Returns the duplicate policy of the logged in user's list
+func GetListSettings(ctx context.Context, email string) (*pb.ListSettings, error) {
+	// validation
+	if email == "" {
+		return &pb.ListSettings{}, errors.New("missing email")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListSettings{}, err
+	}
+
+	todoList, err := data.GetTodoList(ctx, user.TodoListId)
+	if err != nil {
+		return &pb.ListSettings{}, err
+	}
+
+	return toListSettings(todoList), nil
+}
+
+// Changes the duplicate policy of the logged in user's list
+func UpdateListSettings(ctx context.Context, email string, in *pb.ListSettings) (*pb.ListSettings, error) {
+	// validation
+	if email == "" {
+		return &pb.ListSettings{}, errors.New("missing email")
+	}
+
+	policy, ok := duplicatePolicies[in.DuplicatePolicy]
+	if !ok {
+		return &pb.ListSettings{}, errors.New("invalid duplicatePolicy")
+	}
+	// end validation
+
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		todoList, err := data.GetTodoList(ctx, user.TodoListId)
+		if err != nil {
+			return err
+		}
+
+		err = data.UpdateDuplicatePolicy(ctx, user.TodoListId, policy)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionListSettingsUpdated,
+			EntityType: "todoList",
+			EntityId:   user.TodoListId.String(),
+			TodoListId: user.TodoListId,
+		}, map[string]string{"duplicatePolicy": todoList.DuplicatePolicy}, map[string]string{"duplicatePolicy": policy})
+	})
+	if err != nil {
+		return &pb.ListSettings{}, err
+	}
+
+	return &pb.ListSettings{DuplicatePolicy: in.DuplicatePolicy}, nil
+}
+
+func toListSettings(todoList data.TodoList) *pb.ListSettings {
+	for policy, name := range duplicatePolicies {
+		if name == todoList.DuplicatePolicy {
+			return &pb.ListSettings{DuplicatePolicy: policy}
+		}
+	}
+	return &pb.ListSettings{}
+}
+
+// Picks the name a new item is stored under, following the list's duplicate policy
+func resolveItemName(ctx context.Context, todoListId uuid.UUID, itemName string) (string, error) {
+	todoList, err := data.GetTodoList(ctx, todoListId)
+	if err != nil {
+		return "", err
+	}
+	if todoList.DuplicatePolicy == data.DuplicatePolicyAllow {
+		return itemName, nil
+	}
+
+	_, err = data.GetItemByItemNameFold(ctx, todoListId, itemName)
+	if err == sql.ErrNoRows {
+		return itemName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if todoList.DuplicatePolicy != data.DuplicatePolicyAutoSuffix {
+		return "", duplicateItemError(ctx, todoListId, itemName)
+	}
+
+	for n := 2; n <= maxAutoSuffix; n++ {
+		candidate := suffixName(itemName, n)
+		_, err := data.GetItemByItemNameFold(ctx, todoListId, candidate)
+		if err == sql.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", duplicateItemError(ctx, todoListId, itemName)
+}
+
+// Appends " (n)" to name, trimming name so the result still fits in the column
+func suffixName(name string, n int) string {
+	suffix := fmt.Sprintf(" (%d)", n)
+	for utf8.RuneCountInString(name)+len(suffix) > maxItemNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + suffix
+}
+
+// Builds the ALREADY_EXISTS error pointing at the active item that holds itemName
+func duplicateItemError(ctx context.Context, todoListId uuid.UUID, itemName string) error {
+	existing, err := data.GetItemByItemNameFold(ctx, todoListId, itemName)
+	if err != nil {
+		// the lookup is best effort, e.g. the transaction may already be aborted
+		return status.Error(codes.AlreadyExists, "item "+itemName+" already exists")
+	}
+
+	st := status.New(codes.AlreadyExists, "item "+itemName+" already exists with itemId "+existing.Id.String())
+	st, err = st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "item",
+		ResourceName: existing.Id.String(),
+		Description:  "conflicting item " + existing.Name,
+	})
+	if err != nil {
+		return status.Error(codes.AlreadyExists, "item "+itemName+" already exists with itemId "+existing.Id.String())
+	}
+	return st.Err()
+}
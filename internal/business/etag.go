@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	data "todo/internal/data"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Formats an item version as a strong HTTP entity tag, e.g. "3"
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// Checks an If-Match style precondition against the item's current version.
+// An empty precondition or "*" always matches. If-Match uses the strong comparison,
+// weak tags such as W/"3" never match, and empty list elements are ignored.
+func etagMatches(etag string, version int64) bool {
+	if strings.TrimSpace(etag) == "" {
+		return true
+	}
+	for _, tag := range strings.Split(etag, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if tag == "*" {
+			return true
+		}
+		if unquoted, err := strconv.Unquote(tag); err == nil {
+			tag = unquoted
+		}
+		if tag == strconv.FormatInt(version, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejects a stale write with codes.Aborted. The PreconditionFailure detail lets the
+// HTTP gateway answer with 412 Precondition Failed.
+func staleItemError(item data.Item) error {
+	st := status.New(codes.Aborted, "item "+item.Name+" has changed, current etag is "+ETag(item.Version))
+	st, err := st.WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "ETAG",
+			Subject:     item.Id.String(),
+			Description: "current etag is " + ETag(item.Version),
+		}},
+	})
+	if err != nil {
+		return status.Error(codes.Aborted, "item "+item.Name+" has changed")
+	}
+	return st.Err()
+}
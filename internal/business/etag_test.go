@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Tells whether err carries the detail the gateway answers with 412
+func hasPreconditionFailure(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if _, ok := detail.(*errdetails.PreconditionFailure); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_etagMatches(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		inEtag      string
+		inVersion   int64
+		expectedOut bool
+	}{
+		{
+			testName:    "Success - no precondition",
+			inEtag:      "",
+			inVersion:   3,
+			expectedOut: true,
+		},
+		{
+			testName:    "Success - any version",
+			inEtag:      "*",
+			inVersion:   3,
+			expectedOut: true,
+		},
+		{
+			testName:    "Success - current version",
+			inEtag:      `"3"`,
+			inVersion:   3,
+			expectedOut: true,
+		},
+		{
+			testName:    "Success - unquoted current version",
+			inEtag:      "3",
+			inVersion:   3,
+			expectedOut: true,
+		},
+		{
+			testName:    "Success - current version in a list",
+			inEtag:      `"2", "3"`,
+			inVersion:   3,
+			expectedOut: true,
+		},
+		{
+			testName:    "Fail - stale version",
+			inEtag:      `"2"`,
+			inVersion:   3,
+			expectedOut: false,
+		},
+		{
+			testName:    "Fail - empty list element",
+			inEtag:      `"2",`,
+			inVersion:   3,
+			expectedOut: false,
+		},
+		{
+			testName:    "Fail - empty list",
+			inEtag:      " , ",
+			inVersion:   3,
+			expectedOut: false,
+		},
+		{
+			testName:    "Fail - weak tag",
+			inEtag:      `W/"3"`,
+			inVersion:   3,
+			expectedOut: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			if got := etagMatches(tc.inEtag, tc.inVersion); got != tc.expectedOut {
+				tt.Errorf("etagMatches(%q, %v) failed, got %v, want %v", tc.inEtag, tc.inVersion, got, tc.expectedOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+)
+
+const (
+	// items read from the database at a time
+	exportPageSize = 500
+	// a chunk is sent once this much is buffered
+	exportChunkSize = 32 << 10
+)
+
+// Writes items in one file format. begin and end may be nil.
+type exporter struct {
+	contentType string
+	extension   string
+	begin       func(w *bytes.Buffer)
+	item        func(w *bytes.Buffer, n int, item data.Item)
+	end         func(w *bytes.Buffer, count int)
+}
+
+var exporters = map[string]exporter{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		extension:   "csv",
+		begin: func(w *bytes.Buffer) {
+			writeCSV(w, []string{"itemId", "itemName", "itemDescription", "done", "createdOn", "updatedOn"})
+		},
+		item: func(w *bytes.Buffer, n int, item data.Item) {
+			writeCSV(w, []string{
+				item.Id.String(),
+				item.Name,
+				item.Description,
+				strconv.FormatBool(item.MarkDone),
+				item.CreatedOn.UTC().Format(time.RFC3339),
+				item.UpdatedOn.UTC().Format(time.RFC3339),
+			})
+		},
+	},
+	"json": {
+		contentType: "application/json",
+		extension:   "json",
+		begin: func(w *bytes.Buffer) {
+			w.WriteString("[")
+		},
+		item: func(w *bytes.Buffer, n int, item data.Item) {
+			if n > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n  ")
+			body, _ := json.Marshal(exportItem{
+				ItemId:          item.Id.String(),
+				ItemName:        item.Name,
+				ItemDescription: item.Description,
+				Done:            item.MarkDone,
+				CreatedOn:       item.CreatedOn.UTC(),
+				UpdatedOn:       item.UpdatedOn.UTC(),
+			})
+			w.Write(body)
+		},
+		end: func(w *bytes.Buffer, count int) {
+			if count > 0 {
+				w.WriteString("\n")
+			}
+			w.WriteString("]\n")
+		},
+	},
+	"markdown": {
+		contentType: "text/markdown; charset=utf-8",
+		extension:   "md",
+		begin: func(w *bytes.Buffer) {
+			w.WriteString("# Todo list\n\n")
+		},
+		item: func(w *bytes.Buffer, n int, item data.Item) {
+			check := " "
+			if item.MarkDone {
+				check = "x"
+			}
+			w.WriteString("- [" + check + "] " + oneLine(item.Name))
+			if item.Description != "" {
+				w.WriteString(" — " + oneLine(item.Description))
+			}
+			w.WriteString(" _(created " + item.CreatedOn.UTC().Format(time.RFC3339) + ", updated " + item.UpdatedOn.UTC().Format(time.RFC3339) + ")_\n")
+		},
+		end: func(w *bytes.Buffer, count int) {
+			if count == 0 {
+				w.WriteString("_No items._\n")
+			}
+		},
+	},
+	// completion and creation dates as in the todo.txt format, the description in a
+	// description: tag with spaces written as underscores, which ImportTodos reads back
+	"todotxt": {
+		contentType: "text/plain; charset=utf-8",
+		extension:   "txt",
+		item: func(w *bytes.Buffer, n int, item data.Item) {
+			if item.MarkDone {
+				w.WriteString("x " + item.UpdatedOn.UTC().Format(time.DateOnly) + " ")
+			}
+			w.WriteString(item.CreatedOn.UTC().Format(time.DateOnly) + " " + oneLine(item.Name))
+			if item.Description != "" {
+				w.WriteString(" description:" + strings.Join(strings.Fields(item.Description), "_"))
+			}
+			w.WriteString("\n")
+		},
+	},
+}
+
+// An item as exported to JSON, the keys match what ImportTodos recognizes
+type exportItem struct {
+	ItemId          string    `json:"itemId"`
+	ItemName        string    `json:"itemName"`
+	ItemDescription string    `json:"itemDescription"`
+	Done            bool      `json:"done"`
+	CreatedOn       time.Time `json:"createdOn"`
+	UpdatedOn       time.Time `json:"updatedOn"`
+}
+
+func writeCSV(w *bytes.Buffer, record []string) {
+	writer := csv.NewWriter(w)
+	writer.Write(record)
+	writer.Flush()
+}
+
+// Keeps a value on its line in line based formats
+func oneLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// Streams the active items of the logged in user's list in the requested format,
+// oldest first. start is called with the suggested file name before the first chunk.
+func ExportTodos(ctx context.Context, email string, in *pb.ExportTodosRequest, start func(filename string) error, send func(*httpbody.HttpBody) error) error {
+	// validation
+	if email == "" {
+		return errors.New("missing email")
+	}
+
+	format := strings.ToLower(in.Format)
+	if format == "" {
+		format = "csv"
+	}
+	exporter, ok := exporters[format]
+	if !ok {
+		return errors.New("invalid format, expecting csv, json, markdown or todotxt")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if err := start("todo-" + time.Now().UTC().Format(time.DateOnly) + "." + exporter.extension); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		chunk := &httpbody.HttpBody{ContentType: exporter.contentType, Data: bytes.Clone(buf.Bytes())}
+		buf.Reset()
+		return send(chunk)
+	}
+
+	if exporter.begin != nil {
+		exporter.begin(&buf)
+	}
+
+	count := 0
+	var after data.Item
+	for {
+		items, err := data.ListItemPage(ctx, user.TodoListId, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			exporter.item(&buf, count, item)
+			count++
+
+			if buf.Len() >= exportChunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(items) < exportPageSize {
+			break
+		}
+		after = items[len(items)-1]
+	}
+
+	if exporter.end != nil {
+		exporter.end(&buf, count)
+	}
+	return flush()
+}
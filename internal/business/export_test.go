@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+)
+
+func Test_ExportTodos(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC)
+	items := []data.Item{
+		{Id: testItemId, Name: "item1", Description: "desc, one", MarkDone: true, CreatedOn: created, UpdatedOn: updated},
+		{Id: testItemId, Name: "item2", Description: "desc\ntwo", CreatedOn: created, UpdatedOn: created},
+	}
+	id := testItemId.String()
+
+	testCases := []struct {
+		testName            string
+		inReq               *pb.ExportTodosRequest
+		items               []data.Item
+		expectedOut         string
+		expectedContentType string
+		expectedExtension   string
+		wantErr             bool
+		expectedErr         error
+	}{
+		{
+			testName:    "Fail - unknown format",
+			inReq:       &pb.ExportTodosRequest{Format: "xlsx"},
+			wantErr:     true,
+			expectedErr: errors.New("invalid format, expecting csv, json, markdown or todotxt"),
+		},
+		{
+			testName: "Success - CSV by default",
+			inReq:    &pb.ExportTodosRequest{},
+			items:    items,
+			expectedOut: "itemId,itemName,itemDescription,done,createdOn,updatedOn\n" +
+				id + ",item1,\"desc, one\",true,2024-01-02T03:04:05Z,2024-01-03T03:04:05Z\n" +
+				id + ",item2,\"desc\ntwo\",false,2024-01-02T03:04:05Z,2024-01-02T03:04:05Z\n",
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedExtension:   ".csv",
+		},
+		{
+			testName: "Success - JSON",
+			inReq:    &pb.ExportTodosRequest{Format: "JSON"},
+			items:    items[:1],
+			expectedOut: "[\n" +
+				`  {"itemId":"` + id + `","itemName":"item1","itemDescription":"desc, one","done":true,"createdOn":"2024-01-02T03:04:05Z","updatedOn":"2024-01-03T03:04:05Z"}` +
+				"\n]\n",
+			expectedContentType: "application/json",
+			expectedExtension:   ".json",
+		},
+		{
+			testName:            "Success - JSON without items",
+			inReq:               &pb.ExportTodosRequest{Format: "json"},
+			expectedOut:         "[]\n",
+			expectedContentType: "application/json",
+			expectedExtension:   ".json",
+		},
+		{
+			testName: "Success - Markdown",
+			inReq:    &pb.ExportTodosRequest{Format: "markdown"},
+			items:    items,
+			expectedOut: "# Todo list\n\n" +
+				"- [x] item1 — desc, one _(created 2024-01-02T03:04:05Z, updated 2024-01-03T03:04:05Z)_\n" +
+				"- [ ] item2 — desc two _(created 2024-01-02T03:04:05Z, updated 2024-01-02T03:04:05Z)_\n",
+			expectedContentType: "text/markdown; charset=utf-8",
+			expectedExtension:   ".md",
+		},
+		{
+			testName: "Success - todo.txt",
+			inReq:    &pb.ExportTodosRequest{Format: "todotxt"},
+			items:    items,
+			expectedOut: "x 2024-01-03 2024-01-02 item1 description:desc,_one\n" +
+				"2024-01-02 item2 description:desc_two\n",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedExtension:   ".txt",
+		},
+	}
+
+	// preserve original function
+	oriGetUser := data.GetUser
+	oriListItemPage := data.ListItemPage
+
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			data.ListItemPage = func(ctx context.Context, todoListId uuid.UUID, after data.Item, limit int) ([]data.Item, error) {
+				return tc.items, nil
+			}
+
+			var filename string
+			start := func(name string) error {
+				filename = name
+				return nil
+			}
+			var out strings.Builder
+			var contentTypes []string
+			send := func(chunk *httpbody.HttpBody) error {
+				contentTypes = append(contentTypes, chunk.ContentType)
+				out.Write(chunk.Data)
+				return nil
+			}
+
+			err := ExportTodos(context.Background(), "test@email.com", tc.inReq, start, send)
+			if tc.wantErr {
+				if err == nil || err.Error() != tc.expectedErr.Error() {
+					tt.Errorf("ExportTodos failed, got err: %v, want err: %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("ExportTodos failed, not expecting err: %v", err)
+			}
+
+			if out.String() != tc.expectedOut {
+				tt.Errorf("ExportTodos failed, got out: %q, want out: %q", out.String(), tc.expectedOut)
+			}
+			if len(contentTypes) == 0 || contentTypes[0] != tc.expectedContentType {
+				tt.Errorf("ExportTodos failed, got content types: %v, want: %s", contentTypes, tc.expectedContentType)
+			}
+			if !strings.HasSuffix(filename, tc.expectedExtension) {
+				tt.Errorf("ExportTodos failed, got filename: %s, want extension: %s", filename, tc.expectedExtension)
+			}
+		})
+	}
+
+	// reset
+	data.GetUser = oriGetUser
+	data.ListItemPage = oriListItemPage
+}
@@ -0,0 +1,453 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	data "todo/internal/data"
+	ical "todo/internal/ical"
+	pb "todo/proto/todo"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits of a single import, overridden from config.yaml at startup
+var (
+	MaxImportRows  = 1000
+	MaxImportBytes = 1 << 20
+)
+
+// same as the size of main.item.description
+const maxItemDescriptionLength = 128
+
+// TodoItem fields an import can fill, with the column names recognized when not mapped
+var importFields = map[string][]string{
+	"itemName":        {"itemname", "name", "title", "task", "item"},
+	"itemDescription": {"itemdescription", "description", "desc", "notes", "details"},
+	"done":            {"done", "completed", "complete", "markdone", "status"},
+}
+
+// returned by the import transaction to roll a dry run back
+var errDryRun = errors.New("dry run")
+
+// One row of an import, row is where it was found in the file
+type importRow struct {
+	row         int
+	name        string
+	description string
+	done        bool
+	due         *time.Time
+	priority    int
+	categories  []string
+	errors      []*pb.ImportRowError
+}
+
+func (r *importRow) fail(field string, message string) {
+	r.errors = append(r.errors, &pb.ImportRowError{Row: int32(r.row), Field: field, Message: message})
+}
+
+// Adds the items of a CSV, JSON, todo.txt or iCalendar file to the logged in user's list. Rows that
+// can't be imported are reported and skipped, the others are added in one transaction
+// and undone together. A dry run reports the same without saving anything.
+func ImportTodos(ctx context.Context, email string, in *pb.ImportTodosRequest) (*pb.ImportTodosReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ImportTodosReply{}, errors.New("missing email")
+	}
+
+	if in.Content == "" {
+		return &pb.ImportTodosReply{}, errors.New("missing content")
+	}
+	if len(in.Content) > MaxImportBytes {
+		return &pb.ImportTodosReply{}, errors.New("content is larger than " + strconv.Itoa(MaxImportBytes) + " bytes")
+	}
+
+	for field := range in.Columns {
+		if _, ok := importFields[field]; !ok {
+			return &pb.ImportTodosReply{}, errors.New("unknown field " + field + " in columns")
+		}
+	}
+	// end validation
+
+	var rows []*importRow
+	var err error
+	switch in.Format {
+	case pb.ImportFormat_IMPORT_FORMAT_CSV:
+		rows, err = parseCSV(in.Content, in.Columns)
+	case pb.ImportFormat_IMPORT_FORMAT_JSON:
+		rows, err = parseJSON(in.Content, in.Columns)
+	case pb.ImportFormat_IMPORT_FORMAT_TODOTXT:
+		rows, err = parseTodoTxt(in.Content)
+	case pb.ImportFormat_IMPORT_FORMAT_ICS:
+		rows, err = parseICS(in.Content)
+	default:
+		return &pb.ImportTodosReply{}, errors.New("missing or invalid format")
+	}
+	if err != nil {
+		return &pb.ImportTodosReply{}, err
+	}
+	if len(rows) > MaxImportRows {
+		return &pb.ImportTodosReply{}, errors.New("more than " + strconv.Itoa(MaxImportRows) + " rows")
+	}
+
+	for _, row := range rows {
+		validateImportRow(row)
+	}
+
+	var res pb.ImportTodosReply
+	err = data.WithTx(withOperationGroup(ctx), func(ctx context.Context) error {
+		res = pb.ImportTodosReply{Total: int32(len(rows)), DryRun: in.DryRun}
+
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		// rows that don't fit in the list anymore are rejected like invalid ones
+		left, err := itemsLeft(ctx, user.TodoListId)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if len(row.errors) == 0 && left == 0 {
+				row.fail("", itemQuotaMessage())
+			}
+			if len(row.errors) == 0 {
+				item, err := importItem(ctx, user.Id, user.TodoListId, row)
+				if err != nil {
+					return err
+				}
+				if item != nil {
+					res.Items = append(res.Items, toTodoItem(*item))
+					if left > 0 {
+						left--
+					}
+				}
+			}
+
+			if len(row.errors) > 0 {
+				res.Failed++
+				res.Errors = append(res.Errors, row.errors...)
+			}
+		}
+		res.Imported = int32(len(res.Items))
+
+		if in.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return &pb.ImportTodosReply{}, err
+	}
+
+	return &res, nil
+}
+
+// Adds the item of a valid row. Returns nil when the row was rejected, e.g. because of
+// a duplicate name, with the reason recorded on the row.
+func importItem(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, row *importRow) (*data.Item, error) {
+	itemName, err := resolveItemName(ctx, todoListId, row.name)
+	if status.Code(err) == codes.AlreadyExists {
+		row.fail("itemName", status.Convert(err).Message())
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	itemId, err := data.AddItem(ctx, userId, todoListId, itemName, row.description)
+	if err == data.ErrDuplicateName {
+		row.fail("itemName", "item "+itemName+" already exists")
+		return nil, nil
+	}
+	if err == data.ErrTodoListNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item := data.Item{
+		Id:          itemId,
+		TodoListId:  todoListId,
+		Name:        itemName,
+		Description: row.description,
+		Active:      true,
+		Version:     1,
+	}
+	if err := setItemPlanning(ctx, &item, row.due, row.priority, row.categories); err != nil {
+		return nil, err
+	}
+	if err := recordItemChange(ctx, userId, actionItemAdded, data.OperationAdd, nil, &item); err != nil {
+		return nil, err
+	}
+	if !row.done {
+		return &item, nil
+	}
+
+	before := item
+	item.MarkDone = true
+	if _, err := data.UpdateItem(ctx, item.Id.String(), item); err != nil {
+		return nil, err
+	}
+	item.Version++
+
+	return &item, recordItemChange(ctx, userId, actionItemMarked, data.OperationMark, &before, &item)
+}
+
+// Applies the same rules as AddTodo and the sizes of the item columns
+func validateImportRow(row *importRow) {
+	row.name = strings.TrimSpace(row.name)
+	row.description = strings.TrimSpace(row.description)
+
+	if row.name == "" {
+		row.fail("itemName", "missing itemName")
+	} else if utf8.RuneCountInString(row.name) > maxItemNameLength {
+		row.fail("itemName", "itemName is longer than "+strconv.Itoa(maxItemNameLength)+" characters")
+	}
+
+	if row.description == "" {
+		row.fail("itemDescription", "missing itemDescription")
+	} else if utf8.RuneCountInString(row.description) > maxItemDescriptionLength {
+		row.fail("itemDescription", "itemDescription is longer than "+strconv.Itoa(maxItemDescriptionLength)+" characters")
+	}
+
+	categories, err := validatePlanning(row.priority, row.categories)
+	if err != nil {
+		row.fail("categories", err.Error())
+	}
+	row.categories = categories
+}
+
+// Finds the column of each field, explicit mappings first, then the recognized names
+func mapColumns(headers []string, columns map[string]string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, header := range headers {
+		key := strings.ToLower(strings.TrimSpace(header))
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+
+	mapped := map[string]int{}
+	for field, aliases := range importFields {
+		if column, ok := columns[field]; ok {
+			i, ok := index[strings.ToLower(strings.TrimSpace(column))]
+			if !ok {
+				return nil, errors.New("column " + column + " mapped to " + field + " not found")
+			}
+			mapped[field] = i
+			continue
+		}
+
+		for _, alias := range aliases {
+			if i, ok := index[alias]; ok {
+				mapped[field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := mapped["itemName"]; !ok {
+		return nil, errors.New("no column found for itemName, map one with columns")
+	}
+	return mapped, nil
+}
+
+// Reads "done" values such as true, yes, x or completed
+func parseDone(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "n", "0", "todo", "open", "pending":
+		return false, true
+	case "true", "yes", "y", "1", "x", "done", "completed", "complete":
+		return true, true
+	}
+	return false, false
+}
+
+// The first record holds the headers, rows are numbered by line
+func parseCSV(content string, columns map[string]string) ([]*importRow, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, "\ufeff")))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing CSV header")
+	}
+	if err != nil {
+		return nil, errors.New("invalid CSV: " + err.Error())
+	}
+
+	mapped, err := mapColumns(headers, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("invalid CSV: " + err.Error())
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := &importRow{row: line}
+		value := func(field string) string {
+			if i, ok := mapped[field]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		row.name = value("itemName")
+		row.description = value("itemDescription")
+
+		var ok bool
+		if row.done, ok = parseDone(value("done")); !ok {
+			row.fail("done", "invalid done value "+value("done"))
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// An array of objects, keys are matched like CSV headers
+func parseJSON(content string, columns map[string]string) ([]*importRow, error) {
+	var objects []map[string]any
+	if err := json.Unmarshal([]byte(content), &objects); err != nil {
+		return nil, errors.New("invalid JSON, expecting an array of objects: " + err.Error())
+	}
+
+	var rows []*importRow
+	for i, object := range objects {
+		row := &importRow{row: i + 1}
+
+		keys := make([]string, 0, len(object))
+		values := make([]any, 0, len(object))
+		for key, value := range object {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		mapped, err := mapColumns(keys, columns)
+		if err != nil {
+			row.fail("itemName", err.Error())
+			rows = append(rows, row)
+			continue
+		}
+
+		value := func(field string) any {
+			if i, ok := mapped[field]; ok {
+				return values[i]
+			}
+			return nil
+		}
+
+		var ok bool
+		if row.name, ok = jsonString(value("itemName")); !ok {
+			row.fail("itemName", "itemName must be a string")
+		}
+		if row.description, ok = jsonString(value("itemDescription")); !ok {
+			row.fail("itemDescription", "itemDescription must be a string")
+		}
+
+		switch done := value("done").(type) {
+		case nil:
+		case bool:
+			row.done = done
+		case string:
+			if row.done, ok = parseDone(done); !ok {
+				row.fail("done", "invalid done value "+done)
+			}
+		default:
+			row.fail("done", "done must be a boolean")
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func jsonString(value any) (string, bool) {
+	switch value := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return value, true
+	}
+	return "", false
+}
+
+// "x 2024-01-02 (A) 2024-01-01 text" per todo.txt, where everything but text is optional
+var todoTxtLine = regexp.MustCompile(`^(x\s+)?(?:\d{4}-\d{2}-\d{2}\s+)?(?:\([A-Z]\)\s+)?(?:\d{4}-\d{2}-\d{2}\s+)?(.*)$`)
+
+// One task per line. The task text is the item name, its description comes from a
+// description: (or desc:) tag and falls back to the task text.
+func parseTodoTxt(content string) ([]*importRow, error) {
+	var rows []*importRow
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxImportBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		match := todoTxtLine.FindStringSubmatch(text)
+		row := &importRow{row: line, done: match[1] != ""}
+
+		var words []string
+		for _, word := range strings.Fields(match[2]) {
+			key, value, ok := strings.Cut(word, ":")
+			if ok && (key == "description" || key == "desc") {
+				// tag values can't hold spaces, todo.txt clients write them as underscores
+				row.description = strings.ReplaceAll(value, "_", " ")
+				continue
+			}
+			words = append(words, word)
+		}
+		row.name = strings.Join(words, " ")
+		if row.description == "" {
+			row.description = row.name
+		}
+
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("invalid todo.txt: " + err.Error())
+	}
+
+	return rows, nil
+}
+
+// The VTODOs of an iCalendar file, rows are numbered by VTODO
+func parseICS(content string) ([]*importRow, error) {
+	todos, err := ical.Parse(content)
+	if err != nil {
+		return nil, errors.New("invalid iCalendar: " + err.Error())
+	}
+
+	rows := make([]*importRow, len(todos))
+	for i, todo := range todos {
+		rows[i] = fromVTodo(i+1, todo)
+	}
+	return rows, nil
+}
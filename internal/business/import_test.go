@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+func Test_parseImport(t *testing.T) {
+	type row struct {
+		row         int
+		name        string
+		description string
+		done        bool
+		errors      int
+	}
+
+	testCases := []struct {
+		testName    string
+		parse       func() ([]*importRow, error)
+		expectedOut []row
+		wantErr     bool
+	}{
+		{
+			testName: "CSV - recognized headers",
+			parse: func() ([]*importRow, error) {
+				return parseCSV("Title,Notes,Completed\nitem1,desc1,yes\n\"item, 2\",desc2,\n", nil)
+			},
+			expectedOut: []row{
+				{row: 2, name: "item1", description: "desc1", done: true},
+				{row: 3, name: "item, 2", description: "desc2"},
+			},
+		},
+		{
+			testName: "CSV - mapped columns and invalid done",
+			parse: func() ([]*importRow, error) {
+				return parseCSV("What,Why,State\nitem1,desc1,maybe\n", map[string]string{"itemName": "what", "itemDescription": "Why", "done": "State"})
+			},
+			expectedOut: []row{
+				{row: 2, name: "item1", description: "desc1", errors: 1},
+			},
+		},
+		{
+			testName: "CSV - no name column",
+			parse: func() ([]*importRow, error) {
+				return parseCSV("a,b\n1,2\n", nil)
+			},
+			wantErr: true,
+		},
+		{
+			testName: "JSON",
+			parse: func() ([]*importRow, error) {
+				return parseJSON(`[{"itemName":"item1","itemDescription":"desc1","done":true},{"title":"item2","notes":"desc2","done":"no"},{"name":3}]`, nil)
+			},
+			expectedOut: []row{
+				{row: 1, name: "item1", description: "desc1", done: true},
+				{row: 2, name: "item2", description: "desc2"},
+				{row: 3, errors: 1},
+			},
+		},
+		{
+			testName: "JSON - not an array",
+			parse: func() ([]*importRow, error) {
+				return parseJSON(`{"itemName":"item1"}`, nil)
+			},
+			wantErr: true,
+		},
+		{
+			testName: "todo.txt",
+			parse: func() ([]*importRow, error) {
+				return parseTodoTxt("(A) 2024-01-01 call mom +family description:about_the_trip\n\nx 2024-01-03 2024-01-02 pay rent @home\n")
+			},
+			expectedOut: []row{
+				{row: 1, name: "call mom +family", description: "about the trip"},
+				{row: 3, name: "pay rent @home", description: "pay rent @home", done: true},
+			},
+		},
+		{
+			testName: "iCalendar",
+			parse: func() ([]*importRow, error) {
+				return parseICS("BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:call mom\r\nSTATUS:COMPLETED\r\nEND:VTODO\r\n" +
+					"BEGIN:VTODO\r\nSUMMARY:pay rent\r\nDESCRIPTION:before the 5th\r\nPRIORITY:11\r\nEND:VTODO\r\nEND:VCALENDAR\r\n")
+			},
+			expectedOut: []row{
+				{row: 1, name: "call mom", description: "call mom", done: true},
+				{row: 2, name: "pay rent", description: "before the 5th", errors: 1},
+			},
+		},
+		{
+			testName: "iCalendar - malformed",
+			parse: func() ([]*importRow, error) {
+				return parseICS("BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:call mom\r\n")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			out, err := tc.parse()
+			if tc.wantErr {
+				if err == nil {
+					tt.Errorf("parse failed, expecting an error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("parse failed, not expecting err: %v", err)
+			}
+			if len(out) != len(tc.expectedOut) {
+				tt.Fatalf("parse failed, got %d rows, want %d", len(out), len(tc.expectedOut))
+			}
+			for i, expected := range tc.expectedOut {
+				got := row{out[i].row, out[i].name, out[i].description, out[i].done, len(out[i].errors)}
+				if got != expected {
+					tt.Errorf("parse failed, got row %+v, want %+v", got, expected)
+				}
+			}
+		})
+	}
+}
+
+func Test_ImportTodos(t *testing.T) {
+	content := "name,description,done\nitem1,desc1,\nexisting,desc2,\n,desc3,\nitem4,desc4,true\n"
+
+	testCases := []struct {
+		testName       string
+		inReq          *pb.ImportTodosRequest
+		expectedOut    *pb.ImportTodosReply
+		expectedErrors []string
+		expectedAdded  int
+		wantErr        bool
+		expectedErr    error
+	}{
+		{
+			testName:    "Fail - missing format",
+			inReq:       &pb.ImportTodosRequest{Content: content},
+			wantErr:     true,
+			expectedErr: errors.New("missing or invalid format"),
+		},
+		{
+			testName:    "Fail - unknown field in columns",
+			inReq:       &pb.ImportTodosRequest{Format: pb.ImportFormat_IMPORT_FORMAT_CSV, Content: content, Columns: map[string]string{"priority": "p"}},
+			wantErr:     true,
+			expectedErr: errors.New("unknown field priority in columns"),
+		},
+		{
+			testName:       "Success - invalid rows are reported",
+			inReq:          &pb.ImportTodosRequest{Format: pb.ImportFormat_IMPORT_FORMAT_CSV, Content: content},
+			expectedOut:    &pb.ImportTodosReply{Total: 4, Imported: 2, Failed: 2},
+			expectedErrors: []string{"3 itemName", "4 itemName"},
+			expectedAdded:  2,
+		},
+		{
+			testName:       "Success - dry run",
+			inReq:          &pb.ImportTodosRequest{Format: pb.ImportFormat_IMPORT_FORMAT_CSV, Content: content, DryRun: true},
+			expectedOut:    &pb.ImportTodosReply{Total: 4, Imported: 2, Failed: 2, DryRun: true},
+			expectedErrors: []string{"3 itemName", "4 itemName"},
+			expectedAdded:  2,
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOperation := data.AddOperation
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriGetUser := data.GetUser
+	oriGetTodoList := data.GetTodoList
+	oriGetItemByItemNameFold := data.GetItemByItemNameFold
+	oriAddItem := data.AddItem
+	oriUpdateItem := data.UpdateItem
+
+	// the transaction outcome is what tells a dry run apart
+	var txErr error
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		txErr = fn(ctx)
+		return txErr
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+		return data.TodoList{Id: todoListId, DuplicatePolicy: data.DuplicatePolicyReject}, nil
+	}
+	data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+		if itemName == "existing" {
+			return data.Item{Id: testItemId, Name: itemName}, nil
+		}
+		return data.Item{}, sql.ErrNoRows
+	}
+	var added int
+	data.AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
+		added++
+		return uuid.New(), nil
+	}
+	var marked []string
+	data.UpdateItem = func(ctx context.Context, itemId string, item data.Item) (bool, error) {
+		marked = append(marked, item.Name)
+		return true, nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			added, marked, txErr = 0, nil, nil
+			out, err := ImportTodos(context.Background(), "test@email.com", tc.inReq)
+			if tc.wantErr && (err == nil || err.Error() != tc.expectedErr.Error()) {
+				tt.Errorf("ImportTodos failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("ImportTodos failed, not expecting err: %v", err)
+			}
+			if tc.expectedOut == nil {
+				return
+			}
+
+			if out.Total != tc.expectedOut.Total || out.Imported != tc.expectedOut.Imported || out.Failed != tc.expectedOut.Failed || out.DryRun != tc.expectedOut.DryRun {
+				tt.Errorf("ImportTodos failed, got out: %v, want out: %v", out, tc.expectedOut)
+			}
+			var rowErrors []string
+			for _, rowErr := range out.Errors {
+				rowErrors = append(rowErrors, strconv.Itoa(int(rowErr.Row))+" "+rowErr.Field)
+			}
+			if strings.Join(rowErrors, ",") != strings.Join(tc.expectedErrors, ",") {
+				tt.Errorf("ImportTodos failed, got errors: %v, want errors: %v", rowErrors, tc.expectedErrors)
+			}
+			if added != tc.expectedAdded || len(marked) != 1 || marked[0] != "item4" {
+				tt.Errorf("ImportTodos failed, added %d, marked %v", added, marked)
+			}
+			if (txErr == errDryRun) != tc.inReq.DryRun {
+				tt.Errorf("ImportTodos failed, dry run %v ended the transaction with %v", tc.inReq.DryRun, txErr)
+			}
+		})
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOperation = oriAddOperation
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.GetUser = oriGetUser
+	data.GetTodoList = oriGetTodoList
+	data.GetItemByItemNameFold = oriGetItemByItemNameFold
+	data.AddItem = oriAddItem
+	data.UpdateItem = oriUpdateItem
+}
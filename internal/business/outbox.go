@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	data "todo/internal/data"
+	requestid "todo/internal/requestid"
+
+	"github.com/google/uuid"
+)
+
+// domain events published through the outbox
+const (
+	eventItemAdded       = "ItemAdded"
+	eventItemMarked      = "ItemMarked"
+	eventItemDeleted     = "ItemDeleted"
+	eventItemReverted    = "ItemReverted"
+	eventItemUndone      = "ItemUndone"
+	eventItemUpdated     = "ItemUpdated"
+	eventUserProvisioned = "UserProvisioned"
+)
+
+// domain event of each item action
+var itemEvents = map[string]string{
+	actionItemAdded:    eventItemAdded,
+	actionItemMarked:   eventItemMarked,
+	actionItemDeleted:  eventItemDeleted,
+	actionItemReverted: eventItemReverted,
+	actionItemUndone:   eventItemUndone,
+	actionItemUpdated:  eventItemUpdated,
+}
+
+// Writes a domain event to the outbox, run it in the same transaction as the change
+// so the event is published if and only if the change is committed.
+func publishEvent(ctx context.Context, eventType string, aggregateType string, aggregateId string, todoListId uuid.UUID, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return data.AddOutboxEvent(ctx, data.OutboxEvent{
+		Id:            uuid.New(),
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateId:   aggregateId,
+		TodoListId:    todoListId,
+		Payload:       body,
+		RequestId:     requestid.FromContext(ctx),
+	})
+}
+
+// Publishes the domain event of an item action, before is nil for added items
+func publishItemEvent(ctx context.Context, actorId uuid.UUID, action string, before *data.Item, after *data.Item) error {
+	eventType, ok := itemEvents[action]
+	if !ok {
+		return nil
+	}
+
+	return publishEvent(ctx, eventType, "item", after.Id.String(), after.TodoListId, struct {
+		ActorId uuid.UUID  `json:"actorId"`
+		Item    *data.Item `json:"item"`
+		Before  *data.Item `json:"before,omitempty"`
+	}{actorId, after, before})
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	data "todo/internal/data"
+	requestid "todo/internal/requestid"
+)
+
+func Test_publishItemEvent(t *testing.T) {
+	testCases := []struct {
+		testName     string
+		action       string
+		expectedType string
+	}{
+		{"Added", actionItemAdded, eventItemAdded},
+		{"Marked", actionItemMarked, eventItemMarked},
+		{"Deleted", actionItemDeleted, eventItemDeleted},
+		{"Undone", actionItemUndone, eventItemUndone},
+		{"Not an item event", actionListSettingsUpdated, ""},
+	}
+
+	// preserve original function
+	oriAddOutboxEvent := data.AddOutboxEvent
+
+	ctx := requestid.NewContext(context.Background(), "request1")
+	before := &data.Item{Id: testItemId, TodoListId: testTodoListId, Name: "item1", Version: 1}
+	after := &data.Item{Id: testItemId, TodoListId: testTodoListId, Name: "item1", MarkDone: true, Version: 2}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			var written []data.OutboxEvent
+			data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+				written = append(written, event)
+				return nil
+			}
+
+			if err := publishItemEvent(ctx, testUserId, tc.action, before, after); err != nil {
+				tt.Fatalf("publishItemEvent failed, not expecting err: %v", err)
+			}
+
+			if tc.expectedType == "" {
+				if len(written) != 0 {
+					tt.Errorf("publishItemEvent failed, not expecting an event, got %v", written)
+				}
+				return
+			}
+			if len(written) != 1 {
+				tt.Fatalf("publishItemEvent failed, got %d events", len(written))
+			}
+
+			event := written[0]
+			if event.Type != tc.expectedType || event.AggregateId != testItemId.String() || event.TodoListId != testTodoListId || event.RequestId != "request1" {
+				tt.Errorf("publishItemEvent failed, got %+v", event)
+			}
+
+			var payload struct {
+				ActorId string    `json:"actorId"`
+				Item    data.Item `json:"item"`
+			}
+			if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.ActorId != testUserId.String() || payload.Item.Version != 2 {
+				tt.Errorf("publishItemEvent failed, got payload %s", event.Payload)
+			}
+		})
+	}
+
+	// reset
+	data.AddOutboxEvent = oriAddOutboxEvent
+}
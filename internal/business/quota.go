@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"strconv"
+	data "todo/internal/data"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Most active items a list can hold, 0 for no limit. Overridden from config.yaml at startup
+var MaxItemsPerList = 0
+
+// Returns how many more active items the list can hold, or -1 when lists are unlimited.
+// The list stays locked until the transaction ends, so concurrent calls can't both take
+// its last slot.
+func itemsLeft(ctx context.Context, todoListId uuid.UUID) (int, error) {
+	if MaxItemsPerList <= 0 {
+		return -1, nil
+	}
+
+	if err := data.LockTodoList(ctx, todoListId); err != nil {
+		return 0, err
+	}
+	count, err := data.CountActiveItems(ctx, todoListId)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(MaxItemsPerList-count, 0), nil
+}
+
+// Fails with codes.ResourceExhausted when the list can't hold one more active item
+func checkItemQuota(ctx context.Context, todoListId uuid.UUID) error {
+	left, err := itemsLeft(ctx, todoListId)
+	if err != nil {
+		return err
+	}
+	if left == 0 {
+		return itemQuotaError(todoListId)
+	}
+	return nil
+}
+
+func itemQuotaMessage() string {
+	return "the list is full, it can hold at most " + strconv.Itoa(MaxItemsPerList) + " items"
+}
+
+// Builds the RESOURCE_EXHAUSTED error of a full list. Unlike rate limits it carries no
+// RetryInfo, retrying won't help until items are deleted.
+func itemQuotaError(todoListId uuid.UUID) error {
+	st := status.New(codes.ResourceExhausted, itemQuotaMessage())
+	st, err := st.WithDetails(&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     "todolist:" + todoListId.String(),
+			Description: "at most " + strconv.Itoa(MaxItemsPerList) + " active items",
+		}},
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, itemQuotaMessage())
+	}
+	return st.Err()
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_ItemQuota(t *testing.T) {
+	testCases := []struct {
+		testName      string
+		maxItems      int
+		activeItems   int
+		call          func() error
+		expectedCode  codes.Code
+		expectedAdded int
+	}{
+		{
+			testName:    "AddTodo - no quota",
+			activeItems: 5,
+			call: func() error {
+				_, err := AddTodo(context.Background(), "test@email.com", &pb.AddTodoRequest{ItemName: "item1", ItemDescription: "desc1"})
+				return err
+			},
+			expectedCode:  codes.OK,
+			expectedAdded: 1,
+		},
+		{
+			testName:    "AddTodo - room left",
+			maxItems:    5,
+			activeItems: 4,
+			call: func() error {
+				_, err := AddTodo(context.Background(), "test@email.com", &pb.AddTodoRequest{ItemName: "item1", ItemDescription: "desc1"})
+				return err
+			},
+			expectedCode:  codes.OK,
+			expectedAdded: 1,
+		},
+		{
+			testName:    "Fail - AddTodo to a full list",
+			maxItems:    5,
+			activeItems: 5,
+			call: func() error {
+				_, err := AddTodo(context.Background(), "test@email.com", &pb.AddTodoRequest{ItemName: "item1", ItemDescription: "desc1"})
+				return err
+			},
+			expectedCode: codes.ResourceExhausted,
+		},
+		{
+			testName:    "ImportTodos - rows that don't fit are reported",
+			maxItems:    5,
+			activeItems: 4,
+			call: func() error {
+				out, err := ImportTodos(context.Background(), "test@email.com", &pb.ImportTodosRequest{
+					Format:  pb.ImportFormat_IMPORT_FORMAT_CSV,
+					Content: "name,description\nitem1,desc1\nitem2,desc2\n",
+				})
+				if err == nil && (out.Imported != 1 || out.Failed != 1 || out.Errors[0].Row != 3) {
+					t.Errorf("ImportTodos failed, got out: %v", out)
+				}
+				return err
+			},
+			expectedCode:  codes.OK,
+			expectedAdded: 1,
+		},
+	}
+
+	// preserve original function
+	oriMaxItemsPerList := MaxItemsPerList
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOperation := data.AddOperation
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriGetUser := data.GetUser
+	oriGetTodoListIdByUserId := data.GetTodoListIdByUserId
+	oriGetTodoList := data.GetTodoList
+	oriGetItemByItemNameFold := data.GetItemByItemNameFold
+	oriLockTodoList := data.LockTodoList
+	oriCountActiveItems := data.CountActiveItems
+	oriAddItem := data.AddItem
+
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{Id: testUserId, TodoListId: testTodoListId}, nil
+	}
+	data.GetTodoListIdByUserId = func(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+		return testTodoListId, nil
+	}
+	data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+		return data.TodoList{Id: todoListId, DuplicatePolicy: data.DuplicatePolicyReject}, nil
+	}
+	data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+		return data.Item{}, sql.ErrNoRows
+	}
+	var locked bool
+	data.LockTodoList = func(ctx context.Context, todoListId uuid.UUID) error {
+		locked = true
+		return nil
+	}
+	var activeItems int
+	data.CountActiveItems = func(ctx context.Context, todoListId uuid.UUID) (int, error) {
+		if !locked {
+			t.Errorf("CountActiveItems called before LockTodoList")
+		}
+		return activeItems, nil
+	}
+	var added int
+	data.AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
+		added++
+		return uuid.New(), nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			MaxItemsPerList, activeItems, locked, added = tc.maxItems, tc.activeItems, false, 0
+
+			err := tc.call()
+			if status.Code(err) != tc.expectedCode {
+				tt.Errorf("%s failed, got err: %v, want code: %v", tc.testName, err, tc.expectedCode)
+			}
+			if added != tc.expectedAdded {
+				tt.Errorf("%s failed, added %d items, want %d", tc.testName, added, tc.expectedAdded)
+			}
+		})
+	}
+
+	// reset
+	MaxItemsPerList = oriMaxItemsPerList
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOperation = oriAddOperation
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.GetUser = oriGetUser
+	data.GetTodoListIdByUserId = oriGetTodoListIdByUserId
+	data.GetTodoList = oriGetTodoList
+	data.GetItemByItemNameFold = oriGetItemByItemNameFold
+	data.LockTodoList = oriLockTodoList
+	data.CountActiveItems = oriCountActiveItems
+	data.AddItem = oriAddItem
+}
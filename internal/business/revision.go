@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+// Lists how an item of the logged in user's list evolved, newest revision first
+func ListTodoRevisions(ctx context.Context, email string, in *pb.ListTodoRevisionsRequest) (*pb.ListTodoRevisionsReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ListTodoRevisionsReply{}, errors.New("missing email")
+	}
+
+	itemId, err := uuid.Parse(in.ItemId)
+	if err != nil {
+		return &pb.ListTodoRevisionsReply{}, errors.New("missing or invalid itemId")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListTodoRevisionsReply{}, err
+	}
+
+	// make sure the item belongs to the user
+	_, err = data.GetItemById(ctx, user.TodoListId, itemId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &pb.ListTodoRevisionsReply{}, errors.New("item do not exist")
+		}
+		return &pb.ListTodoRevisionsReply{}, err
+	}
+
+	revisions, err := data.ListItemRevisions(ctx, itemId)
+	if err != nil {
+		return &pb.ListTodoRevisionsReply{}, err
+	}
+
+	var res pb.ListTodoRevisionsReply
+	res.Count = int32(len(revisions))
+	for _, revision := range revisions {
+		res.Revisions = append(res.Revisions, &pb.TodoRevision{
+			Revision:        revision.Revision,
+			ItemName:        revision.Name,
+			ItemDescription: revision.Description,
+			Done:            revision.MarkDone,
+			Active:          revision.Active,
+			CreatedOn:       revision.CreatedOn.Format(time.RFC3339Nano),
+		})
+	}
+
+	return &res, nil
+}
+
+// Restores an item to the state of one of its earlier revisions, recorded as a new revision
+func RevertTodo(ctx context.Context, email string, in *pb.RevertTodoRequest) (*pb.TodoItem, error) {
+	// validation
+	if email == "" {
+		return &pb.TodoItem{}, errors.New("missing email")
+	}
+
+	itemId, err := uuid.Parse(in.ItemId)
+	if err != nil {
+		return &pb.TodoItem{}, errors.New("missing or invalid itemId")
+	}
+
+	if in.Revision <= 0 {
+		return &pb.TodoItem{}, errors.New("missing revision")
+	}
+	// end validation
+
+	var item data.Item
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		item, err = data.GetItemById(ctx, user.TodoListId, itemId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("item do not exist")
+			}
+			return err
+		}
+
+		// reject stale writes
+		if !etagMatches(in.Etag, item.Version) {
+			return staleItemError(item)
+		}
+
+		revision, err := data.GetItemRevision(ctx, itemId, in.Revision)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("revision do not exist")
+			}
+			return err
+		}
+
+		before := item
+
+		item.Name = revision.Name
+		item.Description = revision.Description
+		item.MarkDone = revision.MarkDone
+		item.Active = revision.Active
+
+		// reverting to before a delete brings the item back into the list
+		if item.Active && !before.Active {
+			if err := checkItemQuota(ctx, user.TodoListId); err != nil {
+				return err
+			}
+		}
+
+		_, err = data.UpdateItem(ctx, item.Id.String(), item)
+		if err == data.ErrVersionConflict {
+			return staleItemError(before)
+		}
+		if err == data.ErrDuplicateName {
+			return duplicateItemError(ctx, user.TodoListId, item.Name)
+		}
+		if err != nil {
+			return err
+		}
+		item.Version++
+
+		return recordItemChange(ctx, user.Id, actionItemReverted, data.OperationEdit, &before, &item)
+	})
+	if err != nil {
+		return &pb.TodoItem{}, err
+	}
+
+	return toTodoItem(item), nil
+}
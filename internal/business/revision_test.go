@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	data "todo/internal/data"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+func Test_RevertTodo(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		inEmail     string
+		inReq       *pb.RevertTodoRequest
+		expectedOut *pb.TodoItem
+		wantErr     bool
+		expectedErr error
+		mockFunc    func()
+	}{
+		{
+			testName: "Fail - missing email",
+			inEmail:  "",
+			inReq: &pb.RevertTodoRequest{
+				ItemId:   testItemId.String(),
+				Revision: 1,
+			},
+			wantErr:     true,
+			expectedErr: errors.New("missing email"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - invalid itemId",
+			inEmail:  "test@email.com",
+			inReq: &pb.RevertTodoRequest{
+				ItemId:   "item1",
+				Revision: 1,
+			},
+			wantErr:     true,
+			expectedErr: errors.New("missing or invalid itemId"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - missing revision",
+			inEmail:  "test@email.com",
+			inReq: &pb.RevertTodoRequest{
+				ItemId: testItemId.String(),
+			},
+			wantErr:     true,
+			expectedErr: errors.New("missing revision"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - revision do not exist",
+			inEmail:  "test@email.com",
+			inReq: &pb.RevertTodoRequest{
+				ItemId:   testItemId.String(),
+				Revision: 9,
+			},
+			wantErr:     true,
+			expectedErr: errors.New("revision do not exist"),
+			mockFunc: func() {
+				data.GetItemRevision = func(ctx context.Context, itemId uuid.UUID, revision int64) (data.ItemRevision, error) {
+					return data.ItemRevision{}, sql.ErrNoRows
+				}
+			},
+		},
+		{
+			testName: "Success",
+			inEmail:  "test@email.com",
+			inReq: &pb.RevertTodoRequest{
+				ItemId:   testItemId.String(),
+				Revision: 1,
+				Etag:     `"2"`,
+			},
+			expectedOut: &pb.TodoItem{
+				ItemName:        "item1",
+				ItemDescription: "desc1",
+				Done:            false,
+				Etag:            `"3"`,
+				ItemId:          testItemId.String(),
+			},
+			wantErr:     false,
+			expectedErr: nil,
+			mockFunc: func() {
+				data.GetItemRevision = func(ctx context.Context, itemId uuid.UUID, revision int64) (data.ItemRevision, error) {
+					return data.ItemRevision{
+						ItemId:      testItemId,
+						Revision:    1,
+						Name:        "item1",
+						Description: "desc1",
+						MarkDone:    false,
+						Active:      true,
+					}, nil
+				}
+			},
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriAddOperation := data.AddOperation
+	oriGetUser := data.GetUser
+	oriGetItemById := data.GetItemById
+	oriGetItemRevision := data.GetItemRevision
+	oriUpdateItem := data.UpdateItem
+
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	data.GetItemById = func(ctx context.Context, todoListId uuid.UUID, itemId uuid.UUID) (data.Item, error) {
+		return data.Item{
+			Id:          testItemId,
+			TodoListId:  testTodoListId,
+			Name:        "item1 renamed",
+			Description: "desc1",
+			MarkDone:    true,
+			Active:      true,
+			Version:     2,
+		}, nil
+	}
+	data.UpdateItem = func(ctx context.Context, itemId string, item data.Item) (bool, error) {
+		return true, nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			tc.mockFunc()
+			out, err := RevertTodo(context.Background(), tc.inEmail, tc.inReq)
+			if tc.wantErr && errors.Is(err, tc.expectedErr) {
+				tt.Errorf("RevertTodo failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("RevertTodo failed, not expecting err: %v", err)
+			}
+			if tc.expectedOut != nil && (out.ItemName != tc.expectedOut.ItemName || out.Done != tc.expectedOut.Done || out.Etag != tc.expectedOut.Etag) {
+				tt.Errorf("RevertTodo failed, got out: %v, want out: %v", out, tc.expectedOut)
+			}
+		})
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.AddOperation = oriAddOperation
+	data.GetUser = oriGetUser
+	data.GetItemById = oriGetItemById
+	data.GetItemRevision = oriGetItemRevision
+	data.UpdateItem = oriUpdateItem
+}
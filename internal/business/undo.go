@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	data "todo/internal/data"
+	metrics "todo/internal/metrics"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Only operations younger than UndoWindow can be undone, at most MaxUndo per call.
+// Overridden from config.yaml at startup.
+var (
+	UndoWindow = time.Hour
+	MaxUndo    = 20
+)
+
+type operationGroupKey struct{}
+
+// Starts a group of operations that are undone together, e.g. all items of one bulk call
+func withOperationGroup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, operationGroupKey{}, uuid.New())
+}
+
+// Audits, journals and publishes a change to an item, run it in the same transaction as the change.
+// before is nil for added items.
+func recordItemChange(ctx context.Context, actorId uuid.UUID, action string, kind string, before *data.Item, after *data.Item) error {
+	if err := auditItem(ctx, actorId, action, before, after); err != nil {
+		return err
+	}
+
+	groupId, ok := ctx.Value(operationGroupKey{}).(uuid.UUID)
+	if !ok {
+		groupId = uuid.New()
+	}
+
+	err := data.AddOperation(ctx, data.Operation{
+		GroupId:      groupId,
+		UserId:       actorId,
+		Kind:         kind,
+		ItemId:       after.Id,
+		Before:       before,
+		AfterVersion: after.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	change := itemChange(action, after)
+	data.AfterCommit(ctx, func() { metrics.ItemChanged(change) })
+
+	return publishItemEvent(ctx, actorId, action, before, after)
+}
+
+// Names an item change for the todo_item_changes_total metric
+func itemChange(action string, after *data.Item) string {
+	switch action {
+	case actionItemAdded:
+		return "created"
+	case actionItemMarked:
+		if after.MarkDone {
+			return "completed"
+		}
+		return "reopened"
+	case actionItemDeleted:
+		return "deleted"
+	case actionItemReverted:
+		return "reverted"
+	case actionItemUndone:
+		return "undone"
+	}
+	return "updated"
+}
+
+// Reverts the logged in user's most recent operations in reverse order. Fails without
+// changing anything if an item was changed by something else since.
+func Undo(ctx context.Context, email string, in *pb.UndoRequest) (*pb.UndoReply, error) {
+	// validation
+	if email == "" {
+		return &pb.UndoReply{}, errors.New("missing email")
+	}
+
+	if in.Count < 0 {
+		return &pb.UndoReply{}, errors.New("invalid count")
+	}
+	count := int(in.Count)
+	if count == 0 {
+		count = 1
+	}
+	if count > MaxUndo {
+		count = MaxUndo
+	}
+	// end validation
+
+	var res pb.UndoReply
+	err := data.WithTx(ctx, func(ctx context.Context) error {
+		res = pb.UndoReply{}
+
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		ops, err := data.ListUndoableOperations(ctx, user.Id, time.Now().Add(-UndoWindow), count)
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			return status.Error(codes.FailedPrecondition, "nothing to undo")
+		}
+
+		// versions left by the undos of this call, older operations on the same item
+		// are undone from them
+		versions := map[uuid.UUID]int64{}
+		for _, op := range ops {
+			if version, ok := versions[op.ItemId]; ok {
+				op.ExpectedVersion = version
+			}
+			item, err := undoOperation(ctx, user, op)
+			if err != nil {
+				return err
+			}
+			versions[item.Id] = item.Version
+			res.Items = append(res.Items, toTodoItem(item))
+		}
+		res.Count = int32(len(res.Items))
+
+		return nil
+	})
+	if err != nil {
+		return &pb.UndoReply{}, err
+	}
+
+	return &res, nil
+}
+
+// Restores the item as it was before op
+func undoOperation(ctx context.Context, user data.User, op data.Operation) (data.Item, error) {
+	item, err := data.GetItemById(ctx, user.TodoListId, op.ItemId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return data.Item{}, errors.New("item do not exist")
+		}
+		return data.Item{}, err
+	}
+
+	// conflict, the item was changed after the operation
+	if item.Version != op.ExpectedVersion {
+		return data.Item{}, status.Error(codes.Aborted, "item "+item.Name+" was changed since, can't undo "+op.Kind)
+	}
+
+	before := item
+	if op.Before == nil {
+		// undo an add
+		item.Active = false
+	} else {
+		item.Name = op.Before.Name
+		item.Description = op.Before.Description
+		item.MarkDone = op.Before.MarkDone
+		item.Active = op.Before.Active
+	}
+
+	// undoing a delete brings the item back into the list
+	if item.Active && !before.Active {
+		if err := checkItemQuota(ctx, user.TodoListId); err != nil {
+			return data.Item{}, err
+		}
+	}
+
+	_, err = data.UpdateItem(ctx, item.Id.String(), item)
+	if err == data.ErrVersionConflict {
+		return data.Item{}, status.Error(codes.Aborted, "item "+item.Name+" was changed since, can't undo "+op.Kind)
+	}
+	if err == data.ErrDuplicateName {
+		return data.Item{}, duplicateItemError(ctx, user.TodoListId, item.Name)
+	}
+	if err != nil {
+		return data.Item{}, err
+	}
+	item.Version++
+
+	if err := data.MarkOperationUndone(ctx, op.Id, item.Version); err != nil {
+		return data.Item{}, err
+	}
+
+	if err := auditItem(ctx, user.Id, actionItemUndone, &before, &item); err != nil {
+		return data.Item{}, err
+	}
+
+	// undoing an add or a delete changes the number of items as much as the operation did
+	change := itemChange(actionItemUndone, &item)
+	data.AfterCommit(ctx, func() { metrics.ItemChanged(change) })
+
+	return item, publishItemEvent(ctx, user.Id, actionItemUndone, &before, &item)
+}
@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	data "todo/internal/data"
+	metrics "todo/internal/metrics"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Undo(t *testing.T) {
+	addedItemId := uuid.New()
+
+	testCases := []struct {
+		testName      string
+		inEmail       string
+		inReq         *pb.UndoRequest
+		expectedCount int32
+		// undone changes counted by todo_item_changes_total
+		expectedUndone float64
+		wantErr        bool
+		expectedErr    error
+		expectedCode   codes.Code
+		mockFunc       func()
+	}{
+		{
+			testName:    "Fail - missing email",
+			inEmail:     "",
+			inReq:       &pb.UndoRequest{},
+			wantErr:     true,
+			expectedErr: errors.New("missing email"),
+			mockFunc:    func() {},
+		},
+		{
+			testName:     "Fail - nothing to undo",
+			inEmail:      "test@email.com",
+			inReq:        &pb.UndoRequest{},
+			wantErr:      true,
+			expectedErr:  nil,
+			expectedCode: codes.FailedPrecondition,
+			mockFunc: func() {
+				data.ListUndoableOperations = func(ctx context.Context, userId uuid.UUID, since time.Time, groups int) ([]data.Operation, error) {
+					return nil, nil
+				}
+			},
+		},
+		{
+			testName:     "Fail - item changed since",
+			inEmail:      "test@email.com",
+			inReq:        &pb.UndoRequest{},
+			wantErr:      true,
+			expectedErr:  nil,
+			expectedCode: codes.Aborted,
+			mockFunc: func() {
+				data.ListUndoableOperations = func(ctx context.Context, userId uuid.UUID, since time.Time, groups int) ([]data.Operation, error) {
+					return []data.Operation{
+						{
+							Id:              uuid.New(),
+							Kind:            data.OperationMark,
+							ItemId:          testItemId,
+							Before:          &data.Item{Id: testItemId, Name: "item1", Active: true},
+							AfterVersion:    1,
+							ExpectedVersion: 1,
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			testName: "Success",
+			inEmail:  "test@email.com",
+			inReq: &pb.UndoRequest{
+				Count: 2,
+			},
+			expectedCount:  2,
+			expectedUndone: 2,
+			wantErr:        false,
+			expectedErr:    nil,
+			mockFunc: func() {
+				data.ListUndoableOperations = func(ctx context.Context, userId uuid.UUID, since time.Time, groups int) ([]data.Operation, error) {
+					if groups != 2 {
+						return nil, errors.New("unexpected groups")
+					}
+					return []data.Operation{
+						{
+							Id:              uuid.New(),
+							Kind:            data.OperationMark,
+							ItemId:          testItemId,
+							Before:          &data.Item{Id: testItemId, Name: "item1", Active: true},
+							AfterVersion:    2,
+							ExpectedVersion: 2,
+						},
+						{
+							Id:              uuid.New(),
+							Kind:            data.OperationAdd,
+							ItemId:          addedItemId,
+							AfterVersion:    2,
+							ExpectedVersion: 2,
+						},
+					}, nil
+				}
+			},
+		},
+		{
+			testName: "Success - two operations on one item",
+			inEmail:  "test@email.com",
+			inReq: &pb.UndoRequest{
+				Count: 2,
+			},
+			expectedCount:  2,
+			expectedUndone: 2,
+			wantErr:        false,
+			expectedErr:    nil,
+			mockFunc: func() {
+				// an item added then marked done, the undo of the mark bumps its version
+				item := data.Item{Id: testItemId, TodoListId: testTodoListId, Name: "item1", MarkDone: true, Active: true, Version: 2}
+				data.GetItemById = func(ctx context.Context, todoListId uuid.UUID, itemId uuid.UUID) (data.Item, error) {
+					return item, nil
+				}
+				data.UpdateItem = func(ctx context.Context, itemId string, updated data.Item) (bool, error) {
+					if updated.Version != item.Version {
+						return false, data.ErrVersionConflict
+					}
+					item = updated
+					item.Version++
+					return true, nil
+				}
+				data.ListUndoableOperations = func(ctx context.Context, userId uuid.UUID, since time.Time, groups int) ([]data.Operation, error) {
+					return []data.Operation{
+						{
+							Id:              uuid.New(),
+							Kind:            data.OperationMark,
+							ItemId:          testItemId,
+							Before:          &data.Item{Id: testItemId, Name: "item1", Active: true},
+							AfterVersion:    2,
+							ExpectedVersion: 2,
+						},
+						{
+							Id:              uuid.New(),
+							Kind:            data.OperationAdd,
+							ItemId:          testItemId,
+							AfterVersion:    1,
+							ExpectedVersion: 1,
+						},
+					}, nil
+				}
+			},
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriGetUser := data.GetUser
+	oriGetItemById := data.GetItemById
+	oriUpdateItem := data.UpdateItem
+	oriListUndoableOperations := data.ListUndoableOperations
+	oriMarkOperationUndone := data.MarkOperationUndone
+
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	data.GetItemById = func(ctx context.Context, todoListId uuid.UUID, itemId uuid.UUID) (data.Item, error) {
+		return data.Item{
+			Id:         itemId,
+			TodoListId: testTodoListId,
+			Name:       "item1",
+			MarkDone:   true,
+			Active:     true,
+			Version:    2,
+		}, nil
+	}
+	data.UpdateItem = func(ctx context.Context, itemId string, item data.Item) (bool, error) {
+		if itemId == testItemId.String() && (item.MarkDone || !item.Active) {
+			return false, errors.New("mark was not undone")
+		}
+		if itemId == addedItemId.String() && item.Active {
+			return false, errors.New("add was not undone")
+		}
+		return true, nil
+	}
+	data.MarkOperationUndone = func(ctx context.Context, operationId uuid.UUID, version int64) error {
+		return nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			tc.mockFunc()
+			undone := undoneChanges(tt)
+			out, err := Undo(context.Background(), tc.inEmail, tc.inReq)
+			if tc.wantErr && errors.Is(err, tc.expectedErr) {
+				tt.Errorf("Undo failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("Undo failed, not expecting err: %v", err)
+			}
+			if tc.expectedCode != codes.OK && status.Code(err) != tc.expectedCode {
+				tt.Errorf("Undo failed, got code: %v, want code: %v", status.Code(err), tc.expectedCode)
+			}
+			if out.Count != tc.expectedCount {
+				tt.Errorf("Undo failed, got count: %v, want count: %v", out.Count, tc.expectedCount)
+			}
+			if got := undoneChanges(tt) - undone; got != tc.expectedUndone {
+				tt.Errorf("Undo failed, counted %v undone changes, want %v", got, tc.expectedUndone)
+			}
+		})
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.GetUser = oriGetUser
+	data.GetItemById = oriGetItemById
+	data.UpdateItem = oriUpdateItem
+	data.ListUndoableOperations = oriListUndoableOperations
+	data.MarkOperationUndone = oriMarkOperationUndone
+}
+
+// Reads todo_item_changes_total{change="undone"}
+func undoneChanges(t *testing.T) float64 {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "todo_item_changes_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "change" && label.GetValue() == "undone" {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
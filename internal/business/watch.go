@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	data "todo/internal/data"
+	events "todo/internal/events"
+	pb "todo/proto/todo"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// events read from the database at a time
+const watchBatchSize = 100
+
+// how soon events held back by a running transaction are read again, see data.ListItemEvents.
+// The delay doubles while events stay held back, up to events.ResyncInterval: a long
+// transaction anywhere in the database holds back every watch.
+var watchHeldBackInterval = 200 * time.Millisecond
+
+var eventTypes = map[string]pb.TodoEventType{
+	data.ItemEventCreated: pb.TodoEventType_TODO_EVENT_TYPE_CREATED,
+	data.ItemEventUpdated: pb.TodoEventType_TODO_EVENT_TYPE_UPDATED,
+	data.ItemEventDeleted: pb.TodoEventType_TODO_EVENT_TYPE_DELETED,
+}
+
+// Sends every change to the logged in user's list until ctx is done, starting after
+// in.Cursor when given, otherwise with the next change. start is called once the request
+// is validated and the cursor found, before the first event.
+func WatchTodos(ctx context.Context, email string, in *pb.WatchTodosRequest, start func() error, send func(*pb.TodoEvent) error) error {
+	// validation
+	if email == "" {
+		return errors.New("missing email")
+	}
+
+	var cursor int64
+	if in.Cursor != "" {
+		var err error
+		if cursor, err = strconv.ParseInt(in.Cursor, 10, 64); err != nil || cursor < 0 {
+			return status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	// subscribe before reading, so no change slips in between
+	wake, unsubscribe := events.Subscribe(user.TodoListId)
+	defer unsubscribe()
+
+	if in.Cursor == "" {
+		if cursor, err = data.LatestItemEventSeq(ctx, user.TodoListId); err != nil {
+			return err
+		}
+	}
+
+	heldBackDelay := watchHeldBackInterval
+	for {
+		batch, heldBack, err := data.ListItemEvents(ctx, user.TodoListId, cursor, watchBatchSize)
+		if err == data.ErrUnknownCursor {
+			return status.Error(codes.OutOfRange, "unknown cursor, watch again without a cursor")
+		}
+		if err != nil {
+			return err
+		}
+
+		if start != nil {
+			if err := start(); err != nil {
+				return err
+			}
+			start = nil
+		}
+
+		for _, event := range batch {
+			if err := send(toTodoEvent(event)); err != nil {
+				return err
+			}
+			cursor = event.Seq
+		}
+
+		// more events are waiting
+		if len(batch) == watchBatchSize {
+			continue
+		}
+
+		// the transaction holding events back may end without a notification, e.g. on rollback
+		var retry <-chan time.Time
+		if heldBack {
+			retry = time.After(heldBackDelay)
+			heldBackDelay = nextHeldBackDelay(heldBackDelay)
+		} else {
+			heldBackDelay = watchHeldBackInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-retry:
+		}
+	}
+}
+
+// Doubles the held back delay, up to the interval notifications are resynced at anyway
+func nextHeldBackDelay(delay time.Duration) time.Duration {
+	return min(2*delay, events.ResyncInterval)
+}
+
+func toTodoEvent(event data.ItemEvent) *pb.TodoEvent {
+	return &pb.TodoEvent{
+		Cursor:     strconv.FormatInt(event.Seq, 10),
+		Type:       eventTypes[event.Kind],
+		Item:       toTodoItem(event.Item),
+		OccurredOn: event.CreatedOn.Format(time.RFC3339Nano),
+	}
+}
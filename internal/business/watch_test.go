@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	data "todo/internal/data"
+	events "todo/internal/events"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+func Test_WatchTodos(t *testing.T) {
+	errStop := errors.New("stop watching")
+
+	testCases := []struct {
+		testName        string
+		inEmail         string
+		inReq           *pb.WatchTodosRequest
+		expectedCursors []string
+		wantErr         bool
+		expectedErr     error
+		mockFunc        func()
+	}{
+		{
+			testName:    "Fail - missing email",
+			inEmail:     "",
+			inReq:       &pb.WatchTodosRequest{},
+			wantErr:     true,
+			expectedErr: errors.New("missing email"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Fail - invalid cursor",
+			inEmail:  "test@email.com",
+			inReq: &pb.WatchTodosRequest{
+				Cursor: "abc",
+			},
+			wantErr:     true,
+			expectedErr: errors.New("invalid cursor"),
+			mockFunc:    func() {},
+		},
+		{
+			testName: "Success - resume from cursor",
+			inEmail:  "test@email.com",
+			inReq: &pb.WatchTodosRequest{
+				Cursor: "5",
+			},
+			expectedCursors: []string{"6", "7"},
+			wantErr:         true,
+			expectedErr:     errStop,
+			mockFunc: func() {
+				data.ListItemEvents = func(ctx context.Context, todoListId uuid.UUID, afterSeq int64, limit int) ([]data.ItemEvent, bool, error) {
+					if afterSeq != 5 {
+						return nil, false, errors.New("unexpected cursor")
+					}
+					return []data.ItemEvent{
+						{Seq: 6, Kind: data.ItemEventCreated, Item: data.Item{Id: testItemId, Name: "item1", Active: true, Version: 1}},
+						{Seq: 7, Kind: data.ItemEventUpdated, Item: data.Item{Id: testItemId, Name: "item1", MarkDone: true, Active: true, Version: 2}},
+					}, false, nil
+				}
+			},
+		},
+		{
+			testName: "Success - held back events are read again",
+			inEmail:  "test@email.com",
+			inReq: &pb.WatchTodosRequest{
+				Cursor: "5",
+			},
+			expectedCursors: []string{"8", "6"},
+			wantErr:         true,
+			expectedErr:     errStop,
+			mockFunc: func() {
+				// 6 commits after 8, it is held back until its transaction ends
+				calls := 0
+				data.ListItemEvents = func(ctx context.Context, todoListId uuid.UUID, afterSeq int64, limit int) ([]data.ItemEvent, bool, error) {
+					calls++
+					switch {
+					case calls == 1 && afterSeq == 5:
+						return []data.ItemEvent{{Seq: 8, Kind: data.ItemEventCreated, Item: data.Item{Id: testItemId, Name: "item1", Active: true, Version: 1}}}, true, nil
+					case calls == 2 && afterSeq == 8:
+						return []data.ItemEvent{{Seq: 6, Kind: data.ItemEventCreated, Item: data.Item{Id: uuid.New(), Name: "item2", Active: true, Version: 1}}}, false, nil
+					}
+					return nil, false, errors.New("unexpected cursor")
+				}
+			},
+		},
+		{
+			testName: "Fail - unknown cursor",
+			inEmail:  "test@email.com",
+			inReq: &pb.WatchTodosRequest{
+				Cursor: "5",
+			},
+			wantErr:     true,
+			expectedErr: errors.New("invalid cursor"),
+			mockFunc: func() {
+				data.ListItemEvents = func(ctx context.Context, todoListId uuid.UUID, afterSeq int64, limit int) ([]data.ItemEvent, bool, error) {
+					return nil, false, data.ErrUnknownCursor
+				}
+			},
+		},
+	}
+
+	// preserve original function
+	oriGetUser := data.GetUser
+	oriListItemEvents := data.ListItemEvents
+
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			tc.mockFunc()
+
+			started := false
+			start := func() error {
+				started = true
+				return nil
+			}
+			var cursors []string
+			send := func(event *pb.TodoEvent) error {
+				if !started {
+					return errors.New("event sent before start")
+				}
+				cursors = append(cursors, event.Cursor)
+				if len(cursors) == len(tc.expectedCursors) {
+					return errStop
+				}
+				return nil
+			}
+
+			err := WatchTodos(context.Background(), tc.inEmail, tc.inReq, start, send)
+			if tc.wantErr && err == nil {
+				tt.Errorf("WatchTodos failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if tc.expectedErr == errStop && err != errStop {
+				tt.Errorf("WatchTodos failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			// failed requests are answered before the watch is established
+			if started != (tc.expectedErr == errStop) {
+				tt.Errorf("WatchTodos failed, got started: %v", started)
+			}
+			if !reflect.DeepEqual(cursors, tc.expectedCursors) {
+				tt.Errorf("WatchTodos failed, got cursors: %v, want cursors: %v", cursors, tc.expectedCursors)
+			}
+		})
+	}
+
+	// reset
+	data.GetUser = oriGetUser
+	data.ListItemEvents = oriListItemEvents
+}
+
+func Test_nextHeldBackDelay(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		inDelay     time.Duration
+		expectedOut time.Duration
+	}{
+		{
+			testName:    "Doubles",
+			inDelay:     watchHeldBackInterval,
+			expectedOut: 2 * watchHeldBackInterval,
+		},
+		{
+			testName:    "Capped at the resync interval",
+			inDelay:     events.ResyncInterval - time.Second,
+			expectedOut: events.ResyncInterval,
+		},
+		{
+			testName:    "Stays at the resync interval",
+			inDelay:     events.ResyncInterval,
+			expectedOut: events.ResyncInterval,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			if got := nextHeldBackDelay(tc.inDelay); got != tc.expectedOut {
+				tt.Errorf("nextHeldBackDelay(%v) failed, got %v, want %v", tc.inDelay, got, tc.expectedOut)
+			}
+		})
+	}
+}
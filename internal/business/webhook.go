@@ -0,0 +1,373 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+	data "todo/internal/data"
+	webhook "todo/internal/webhook"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+// webhook actions, also audited
+const (
+	actionWebhookCreated = "webhook.created"
+	actionWebhookDeleted = "webhook.deleted"
+)
+
+// audit actions a webhook can subscribe to
+var webhookEventTypes = map[string]bool{
+	actionItemAdded:           true,
+	actionItemDeleted:         true,
+	actionItemMarked:          true,
+	actionItemReverted:        true,
+	actionItemUndone:          true,
+	actionItemUpdated:         true,
+	actionListSettingsUpdated: true,
+	actionWebhookCreated:      true,
+	actionWebhookDeleted:      true,
+	actionCalendarFeedCreated: true,
+	actionCalendarFeedDeleted: true,
+	actionAppTokenCreated:     true,
+	actionAppTokenDeleted:     true,
+}
+
+// same as the sizes of main.webhook.url and main.webhook.secret
+const (
+	maxWebhookUrlLength    = 2048
+	maxWebhookSecretLength = 128
+)
+
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 500
+)
+
+// Subscribes a URL to the changes of the logged in user's list. The secret is only
+// returned here, receivers use it to verify the payload signatures.
+func CreateWebhook(ctx context.Context, email string, in *pb.CreateWebhookRequest) (*pb.Webhook, error) {
+	// validation
+	if email == "" {
+		return &pb.Webhook{}, errors.New("missing email")
+	}
+
+	if len(in.Url) > maxWebhookUrlLength {
+		return &pb.Webhook{}, errors.New("url is too long")
+	}
+	u, err := url.Parse(in.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &pb.Webhook{}, errors.New("missing or invalid url, expecting an absolute http(s) url")
+	}
+	if err := webhook.CheckURL(ctx, in.Url); err != nil {
+		return &pb.Webhook{}, err
+	}
+
+	if len(in.Secret) > maxWebhookSecretLength {
+		return &pb.Webhook{}, errors.New("secret is too long")
+	}
+
+	eventTypes := []string{}
+	seen := map[string]bool{}
+	for _, eventType := range in.EventTypes {
+		if !webhookEventTypes[eventType] {
+			return &pb.Webhook{}, errors.New("unknown event type " + eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	// end validation
+
+	secret := in.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			return &pb.Webhook{}, err
+		}
+	}
+
+	var webhook data.Webhook
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		webhook = data.Webhook{
+			Id:         uuid.New(),
+			UserId:     user.Id,
+			TodoListId: user.TodoListId,
+			Url:        in.Url,
+			Secret:     secret,
+			EventTypes: eventTypes,
+			Active:     true,
+			CreatedOn:  time.Now(),
+		}
+		if err := data.AddWebhook(ctx, webhook); err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionWebhookCreated,
+			EntityType: "webhook",
+			EntityId:   webhook.Id.String(),
+			TodoListId: user.TodoListId,
+		}, nil, webhook)
+	})
+	if err != nil {
+		return &pb.Webhook{}, err
+	}
+
+	res := toWebhook(webhook)
+	res.Secret = secret
+	return res, nil
+}
+
+// Lists the active webhooks of the logged in user's list
+func ListWebhooks(ctx context.Context, email string) (*pb.ListWebhooksReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ListWebhooksReply{}, errors.New("missing email")
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListWebhooksReply{}, err
+	}
+
+	webhooks, err := data.ListWebhooks(ctx, user.TodoListId)
+	if err != nil {
+		return &pb.ListWebhooksReply{}, err
+	}
+
+	var res pb.ListWebhooksReply
+	res.Count = int32(len(webhooks))
+	for _, webhook := range webhooks {
+		res.Webhooks = append(res.Webhooks, toWebhook(webhook))
+	}
+
+	return &res, nil
+}
+
+// Stops calling a webhook, its pending deliveries are cancelled
+func DeleteWebhook(ctx context.Context, email string, in *pb.DeleteWebhookRequest) (*pb.EmptyReply, error) {
+	// validation
+	if email == "" {
+		return &pb.EmptyReply{}, errors.New("missing email")
+	}
+
+	webhookId, err := uuid.Parse(in.WebhookId)
+	if err != nil {
+		return &pb.EmptyReply{}, errors.New("missing or invalid webhookId")
+	}
+	// end validation
+
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		webhook, err := getWebhook(ctx, user.TodoListId, webhookId)
+		if err != nil {
+			return err
+		}
+		if !webhook.Active {
+			return errors.New("webhook do not exist")
+		}
+
+		if err := data.DeactivateWebhook(ctx, webhookId); err != nil {
+			return err
+		}
+
+		before := webhook
+		webhook.Active = false
+		return recordAudit(ctx, data.AuditEvent{
+			ActorId:    user.Id,
+			Action:     actionWebhookDeleted,
+			EntityType: "webhook",
+			EntityId:   webhook.Id.String(),
+			TodoListId: user.TodoListId,
+		}, before, webhook)
+	})
+	if err != nil {
+		return &pb.EmptyReply{}, err
+	}
+
+	return &pb.EmptyReply{}, nil
+}
+
+// Lists the most recent deliveries of a webhook with their attempts
+func ListWebhookDeliveries(ctx context.Context, email string, in *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesReply, error) {
+	// validation
+	if email == "" {
+		return &pb.ListWebhookDeliveriesReply{}, errors.New("missing email")
+	}
+
+	webhookId, err := uuid.Parse(in.WebhookId)
+	if err != nil {
+		return &pb.ListWebhookDeliveriesReply{}, errors.New("missing or invalid webhookId")
+	}
+
+	if in.Limit < 0 {
+		return &pb.ListWebhookDeliveriesReply{}, errors.New("invalid limit")
+	}
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultWebhookDeliveryLimit
+	}
+	if limit > maxWebhookDeliveryLimit {
+		limit = maxWebhookDeliveryLimit
+	}
+	// end validation
+
+	user, err := data.GetUser(ctx, email)
+	if err != nil {
+		return &pb.ListWebhookDeliveriesReply{}, err
+	}
+
+	// make sure the webhook belongs to the user
+	if _, err := getWebhook(ctx, user.TodoListId, webhookId); err != nil {
+		return &pb.ListWebhookDeliveriesReply{}, err
+	}
+
+	deliveries, err := data.ListWebhookDeliveries(ctx, webhookId, limit)
+	if err != nil {
+		return &pb.ListWebhookDeliveriesReply{}, err
+	}
+
+	ids := make([]uuid.UUID, len(deliveries))
+	for i, delivery := range deliveries {
+		ids[i] = delivery.Id
+	}
+	attempts, err := data.ListWebhookAttempts(ctx, ids)
+	if err != nil {
+		return &pb.ListWebhookDeliveriesReply{}, err
+	}
+
+	var res pb.ListWebhookDeliveriesReply
+	res.Count = int32(len(deliveries))
+	for _, delivery := range deliveries {
+		res.Deliveries = append(res.Deliveries, toWebhookDelivery(delivery, attempts[delivery.Id]))
+	}
+
+	return &res, nil
+}
+
+// Queues a delivery again, e.g. after fixing the receiver of a failed one
+func RedeliverWebhook(ctx context.Context, email string, in *pb.RedeliverWebhookRequest) (*pb.WebhookDelivery, error) {
+	// validation
+	if email == "" {
+		return &pb.WebhookDelivery{}, errors.New("missing email")
+	}
+
+	deliveryId, err := uuid.Parse(in.DeliveryId)
+	if err != nil {
+		return &pb.WebhookDelivery{}, errors.New("missing or invalid deliveryId")
+	}
+	// end validation
+
+	var delivery data.WebhookDelivery
+	var attempts []data.WebhookAttempt
+	err = data.WithTx(ctx, func(ctx context.Context) error {
+		user, err := data.GetUser(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		delivery, err = data.GetWebhookDelivery(ctx, user.TodoListId, deliveryId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New("delivery do not exist")
+			}
+			return err
+		}
+
+		webhook, err := getWebhook(ctx, user.TodoListId, delivery.WebhookId)
+		if err != nil {
+			return err
+		}
+		if !webhook.Active {
+			return errors.New("webhook was deleted")
+		}
+
+		if err := data.RequeueWebhookDelivery(ctx, deliveryId); err != nil {
+			return err
+		}
+		delivery.Status = data.WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptOn = time.Now()
+		delivery.DeliveredOn = time.Time{}
+
+		all, err := data.ListWebhookAttempts(ctx, []uuid.UUID{deliveryId})
+		attempts = all[deliveryId]
+		return err
+	})
+	if err != nil {
+		return &pb.WebhookDelivery{}, err
+	}
+
+	return toWebhookDelivery(delivery, attempts), nil
+}
+
+func getWebhook(ctx context.Context, todoListId uuid.UUID, webhookId uuid.UUID) (data.Webhook, error) {
+	webhook, err := data.GetWebhook(ctx, todoListId, webhookId)
+	if err == sql.ErrNoRows {
+		return data.Webhook{}, errors.New("webhook do not exist")
+	}
+	return webhook, err
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Formats a webhook for replies, without its secret
+func toWebhook(webhook data.Webhook) *pb.Webhook {
+	return &pb.Webhook{
+		WebhookId:  webhook.Id.String(),
+		Url:        webhook.Url,
+		EventTypes: webhook.EventTypes,
+		Active:     webhook.Active,
+		CreatedOn:  webhook.CreatedOn.Format(time.RFC3339Nano),
+	}
+}
+
+func toWebhookDelivery(delivery data.WebhookDelivery, attempts []data.WebhookAttempt) *pb.WebhookDelivery {
+	res := &pb.WebhookDelivery{
+		DeliveryId:    delivery.Id.String(),
+		WebhookId:     delivery.WebhookId.String(),
+		EventId:       delivery.EventId.String(),
+		EventType:     delivery.EventType,
+		Payload:       string(delivery.Payload),
+		Status:        delivery.Status,
+		Attempts:      int32(delivery.Attempts),
+		NextAttemptOn: delivery.NextAttemptOn.Format(time.RFC3339Nano),
+		CreatedOn:     delivery.CreatedOn.Format(time.RFC3339Nano),
+	}
+	if !delivery.DeliveredOn.IsZero() {
+		res.DeliveredOn = delivery.DeliveredOn.Format(time.RFC3339Nano)
+	}
+	for _, attempt := range attempts {
+		res.AttemptLog = append(res.AttemptLog, &pb.WebhookAttempt{
+			Attempt:    int32(attempt.Attempt),
+			StatusCode: int32(attempt.StatusCode),
+			Error:      attempt.Error,
+			DurationMs: attempt.Duration.Milliseconds(),
+			CreatedOn:  attempt.CreatedOn.Format(time.RFC3339Nano),
+		})
+	}
+	return res
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/netip"
+	"testing"
+	data "todo/internal/data"
+	webhook "todo/internal/webhook"
+	pb "todo/proto/todo"
+
+	"github.com/google/uuid"
+)
+
+func Test_CreateWebhook(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		inEmail     string
+		inReq       *pb.CreateWebhookRequest
+		expectedOut *pb.Webhook
+		wantErr     bool
+		expectedErr error
+	}{
+		{
+			testName:    "Fail - missing email",
+			inEmail:     "",
+			inReq:       &pb.CreateWebhookRequest{Url: "https://example.com/hook"},
+			wantErr:     true,
+			expectedErr: errors.New("missing email"),
+		},
+		{
+			testName:    "Fail - relative url",
+			inEmail:     "test@email.com",
+			inReq:       &pb.CreateWebhookRequest{Url: "/hook"},
+			wantErr:     true,
+			expectedErr: errors.New("missing or invalid url, expecting an absolute http(s) url"),
+		},
+		{
+			testName:    "Fail - unsupported scheme",
+			inEmail:     "test@email.com",
+			inReq:       &pb.CreateWebhookRequest{Url: "ftp://example.com/hook"},
+			wantErr:     true,
+			expectedErr: errors.New("missing or invalid url, expecting an absolute http(s) url"),
+		},
+		{
+			testName:    "Fail - private destination",
+			inEmail:     "test@email.com",
+			inReq:       &pb.CreateWebhookRequest{Url: "http://localhost:9000/hook"},
+			wantErr:     true,
+			expectedErr: webhook.ErrForbiddenDestination,
+		},
+		{
+			testName: "Fail - unknown event type",
+			inEmail:  "test@email.com",
+			inReq: &pb.CreateWebhookRequest{
+				Url:        "https://example.com/hook",
+				EventTypes: []string{"item.exploded"},
+			},
+			wantErr:     true,
+			expectedErr: errors.New("unknown event type item.exploded"),
+		},
+		{
+			testName: "Success - given secret",
+			inEmail:  "test@email.com",
+			inReq: &pb.CreateWebhookRequest{
+				Url:        "https://example.com/hook",
+				Secret:     "s3cret",
+				EventTypes: []string{"item.added", "item.marked", "item.added"},
+			},
+			expectedOut: &pb.Webhook{
+				Url:        "https://example.com/hook",
+				Secret:     "s3cret",
+				EventTypes: []string{"item.added", "item.marked"},
+				Active:     true,
+			},
+			wantErr: false,
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriGetUser := data.GetUser
+	oriAddWebhook := data.AddWebhook
+	oriLookupNetIP := webhook.LookupNetIP
+
+	webhook.LookupNetIP = func(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+		if host == "localhost" {
+			return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+		}
+		return []netip.Addr{netip.MustParseAddr("93.184.216.34")}, nil
+	}
+
+	// run transactional code inline, there is no database in unit tests
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	var added data.Webhook
+	data.AddWebhook = func(ctx context.Context, webhook data.Webhook) error {
+		added = webhook
+		return nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			out, err := CreateWebhook(context.Background(), tc.inEmail, tc.inReq)
+			if tc.wantErr && (err == nil || err.Error() != tc.expectedErr.Error()) {
+				tt.Errorf("CreateWebhook failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("CreateWebhook failed, not expecting err: %v", err)
+			}
+			if tc.expectedOut == nil {
+				return
+			}
+			if out.Url != tc.expectedOut.Url || out.Secret != tc.expectedOut.Secret || out.Active != tc.expectedOut.Active || len(out.EventTypes) != len(tc.expectedOut.EventTypes) {
+				tt.Errorf("CreateWebhook failed, got out: %v, want out: %v", out, tc.expectedOut)
+			}
+			if added.TodoListId != testTodoListId || added.Secret != tc.expectedOut.Secret {
+				tt.Errorf("CreateWebhook failed, stored webhook: %+v", added)
+			}
+		})
+	}
+
+	// generated secrets are random and too long to guess
+	out, err := CreateWebhook(context.Background(), "test@email.com", &pb.CreateWebhookRequest{Url: "https://example.com/hook"})
+	if err != nil {
+		t.Fatalf("CreateWebhook failed, not expecting err: %v", err)
+	}
+	if len(out.Secret) != 64 || added.Secret != out.Secret {
+		t.Errorf("CreateWebhook failed, got secret %q, stored %q", out.Secret, added.Secret)
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.GetUser = oriGetUser
+	data.AddWebhook = oriAddWebhook
+	webhook.LookupNetIP = oriLookupNetIP
+}
+
+func Test_RedeliverWebhook(t *testing.T) {
+	testWebhookId := uuid.New()
+	testDeliveryId := uuid.New()
+
+	testCases := []struct {
+		testName    string
+		inReq       *pb.RedeliverWebhookRequest
+		wantErr     bool
+		expectedErr error
+		mockFunc    func()
+	}{
+		{
+			testName:    "Fail - invalid deliveryId",
+			inReq:       &pb.RedeliverWebhookRequest{DeliveryId: "delivery1"},
+			wantErr:     true,
+			expectedErr: errors.New("missing or invalid deliveryId"),
+			mockFunc:    func() {},
+		},
+		{
+			testName:    "Fail - delivery of another list",
+			inReq:       &pb.RedeliverWebhookRequest{DeliveryId: uuid.NewString()},
+			wantErr:     true,
+			expectedErr: errors.New("delivery do not exist"),
+			mockFunc:    func() {},
+		},
+		{
+			testName:    "Fail - webhook was deleted",
+			inReq:       &pb.RedeliverWebhookRequest{DeliveryId: testDeliveryId.String()},
+			wantErr:     true,
+			expectedErr: errors.New("webhook was deleted"),
+			mockFunc: func() {
+				data.GetWebhook = func(ctx context.Context, todoListId uuid.UUID, webhookId uuid.UUID) (data.Webhook, error) {
+					return data.Webhook{Id: testWebhookId, Active: false}, nil
+				}
+			},
+		},
+		{
+			testName: "Success",
+			inReq:    &pb.RedeliverWebhookRequest{DeliveryId: testDeliveryId.String()},
+			wantErr:  false,
+			mockFunc: func() {
+				data.GetWebhook = func(ctx context.Context, todoListId uuid.UUID, webhookId uuid.UUID) (data.Webhook, error) {
+					return data.Webhook{Id: testWebhookId, Active: true}, nil
+				}
+			},
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriGetUser := data.GetUser
+	oriGetWebhook := data.GetWebhook
+	oriGetWebhookDelivery := data.GetWebhookDelivery
+	oriRequeueWebhookDelivery := data.RequeueWebhookDelivery
+	oriListWebhookAttempts := data.ListWebhookAttempts
+
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		return data.User{
+			Id:         testUserId,
+			TodoListId: testTodoListId,
+		}, nil
+	}
+	data.GetWebhookDelivery = func(ctx context.Context, todoListId uuid.UUID, deliveryId uuid.UUID) (data.WebhookDelivery, error) {
+		if deliveryId != testDeliveryId {
+			return data.WebhookDelivery{}, sql.ErrNoRows
+		}
+		return data.WebhookDelivery{
+			Id:        testDeliveryId,
+			WebhookId: testWebhookId,
+			Status:    data.WebhookDeliveryFailed,
+			Attempts:  8,
+		}, nil
+	}
+	var requeued uuid.UUID
+	data.RequeueWebhookDelivery = func(ctx context.Context, deliveryId uuid.UUID) error {
+		requeued = deliveryId
+		return nil
+	}
+	data.ListWebhookAttempts = func(ctx context.Context, deliveryIds []uuid.UUID) (map[uuid.UUID][]data.WebhookAttempt, error) {
+		return map[uuid.UUID][]data.WebhookAttempt{
+			testDeliveryId: {{DeliveryId: testDeliveryId, Attempt: 1, StatusCode: 500}},
+		}, nil
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			requeued = uuid.Nil
+			tc.mockFunc()
+			out, err := RedeliverWebhook(context.Background(), "test@email.com", tc.inReq)
+			if tc.wantErr && (err == nil || err.Error() != tc.expectedErr.Error()) {
+				tt.Errorf("RedeliverWebhook failed, got err: %v, want err: %v", err, tc.expectedErr)
+			}
+			if tc.wantErr && requeued != uuid.Nil {
+				tt.Errorf("RedeliverWebhook failed, requeued %v on error", requeued)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("RedeliverWebhook failed, not expecting err: %v", err)
+			}
+			if !tc.wantErr && (requeued != testDeliveryId || out.Status != data.WebhookDeliveryPending || out.Attempts != 0 || len(out.AttemptLog) != 1) {
+				tt.Errorf("RedeliverWebhook failed, got out: %v", out)
+			}
+		})
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.GetUser = oriGetUser
+	data.GetWebhook = oriGetWebhook
+	data.GetWebhookDelivery = oriGetWebhookDelivery
+	data.RequeueWebhookDelivery = oriRequeueWebhookDelivery
+	data.ListWebhookAttempts = oriListWebhookAttempts
+}
@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	business "todo/internal/business"
+	data "todo/internal/data"
+	health "todo/internal/health"
+	ical "todo/internal/ical"
+	metrics "todo/internal/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Where the CalDAV server is mounted
+const Prefix = "/caldav/"
+
+// every list is served as this calendar collection of its owner
+const collectionName = "todo"
+
+// largest iCalendar object accepted by PUT
+const maxObjectBytes = 256 << 10
+
+const allowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+
+// The parts of a request path below Prefix
+type target struct {
+	email string
+	// the logged in user, t.email only matches it case-insensitively. Every business
+	// call uses it, never the email of the path.
+	user string
+	// true for the calendar collection and its resources
+	collection bool
+	// resource name, empty for collections
+	name string
+}
+
+func (t target) principalHref() string {
+	return Prefix + url.PathEscape(t.email) + "/"
+}
+
+func (t target) collectionHref() string {
+	return t.principalHref() + collectionName + "/"
+}
+
+func (t target) resourceHref(name string) string {
+	return t.collectionHref() + url.PathEscape(name)
+}
+
+// Serves each user's todo list as a CalDAV calendar collection of VTODO resources:
+//
+//	/caldav/                            the root, pointing clients to the principal
+//	/caldav/<email>/                    the user's principal and calendar home
+//	/caldav/<email>/todo/               the calendar collection of the list
+//	/caldav/<email>/todo/<name>.ics     one item
+//
+// Clients log in with HTTP basic authentication, the user's email and an app token.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+
+		// clients probe the server before logging in
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allowedMethods)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if !health.Ready() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "server is not ready, please retry later", http.StatusServiceUnavailable)
+			return
+		}
+
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			unauthorized(w)
+			return
+		}
+		ctx := data.WithCaller(r.Context(), email)
+		if _, err := business.AuthenticateAppToken(ctx, email, password); err != nil {
+			if status.Code(err) == codes.Unauthenticated {
+				unauthorized(w)
+				return
+			}
+			writeError(ctx, w, err)
+			return
+		}
+		metrics.SeenUser(email)
+
+		t, ok := parsePath(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if t.email == "" {
+			// the root only tells who is logged in
+			t.email = email
+			t.user = email
+			if r.Method != "PROPFIND" {
+				w.Header().Set("Allow", "OPTIONS, PROPFIND")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			propfind(ctx, w, r, t, Prefix)
+			return
+		}
+		if !strings.EqualFold(t.email, email) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		t.user = email
+
+		switch r.Method {
+		case "PROPFIND":
+			propfind(ctx, w, r, t, r.URL.Path)
+		case "REPORT":
+			report(ctx, w, r, t)
+		case http.MethodGet, http.MethodHead:
+			get(ctx, w, r, t)
+		case http.MethodPut:
+			put(ctx, w, r, t)
+		case http.MethodDelete:
+			remove(ctx, w, r, t)
+		default:
+			w.Header().Set("Allow", allowedMethods)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// Answers /.well-known/caldav (RFC 6764), pointing clients to the server
+func WellKnownHandler() http.Handler {
+	return http.RedirectHandler(Prefix, http.StatusMovedPermanently)
+}
+
+// Splits a path below Prefix, email is empty for the root
+func parsePath(path string) (target, bool) {
+	rest, ok := strings.CutPrefix(path, Prefix)
+	if !ok {
+		return target{}, path+"/" == Prefix
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(rest, "/"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	var t target
+	switch len(segments) {
+	case 0:
+		return t, true
+	case 3:
+		t.name = segments[2]
+		fallthrough
+	case 2:
+		if segments[1] != collectionName {
+			return target{}, false
+		}
+		t.collection = true
+		fallthrough
+	case 1:
+		t.email = segments[0]
+		return t, true
+	}
+	return target{}, false
+}
+
+func get(ctx context.Context, w http.ResponseWriter, r *http.Request, t target) {
+	if !t.collection {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body []byte
+	if t.name == "" {
+		// the whole collection as one calendar
+		items, err := business.ListCalendarItems(ctx, t.user)
+		if err != nil {
+			writeError(ctx, w, err)
+			return
+		}
+		for _, item := range items {
+			body = append(body, business.CalendarObject(item)...)
+		}
+		w.Header().Set("ETag", collectionTag(items))
+	} else {
+		item, err := business.GetCalendarItem(ctx, t.user, t.name)
+		if err != nil {
+			writeError(ctx, w, err)
+			return
+		}
+		body = business.CalendarObject(item)
+		w.Header().Set("ETag", business.ETag(item.Version))
+		w.Header().Set("Last-Modified", item.UpdatedOn.UTC().Format(http.TimeFormat))
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func put(ctx context.Context, w http.ResponseWriter, r *http.Request, t target) {
+	if t.name == "" {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxObjectBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxObjectBytes {
+		http.Error(w, "calendar object is larger than "+strconv.Itoa(maxObjectBytes)+" bytes", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// the stored object is rewritten from the item, so no ETag is returned and
+	// clients fetch it again (RFC 4791 section 5.3.4)
+	_, created, err := business.PutCalendarItem(ctx, t.user, t.name, r.Header.Get("If-Match"), r.Header.Get("If-None-Match"), string(body))
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func remove(ctx context.Context, w http.ResponseWriter, r *http.Request, t target) {
+	if t.name == "" {
+		http.Error(w, "collections can't be deleted", http.StatusForbidden)
+		return
+	}
+
+	if err := business.DeleteCalendarItem(ctx, t.user, t.name, r.Header.Get("If-Match")); err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="todo", charset="UTF-8"`)
+	http.Error(w, "log in with your email and an app token", http.StatusUnauthorized)
+}
+
+// Answers an error of the business layer with the matching HTTP status
+func writeError(ctx context.Context, w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.AlreadyExists:
+		code = http.StatusConflict
+	case codes.Aborted, codes.FailedPrecondition:
+		code = http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		// RFC 4918, the list is full
+		code = http.StatusInsufficientStorage
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	}
+
+	if code == http.StatusInternalServerError {
+		slog.ErrorContext(ctx, "CalDAV request failed", "error", err)
+		http.Error(w, "internal error", code)
+		return
+	}
+	http.Error(w, st.Message(), code)
+}
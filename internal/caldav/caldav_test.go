@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	data "todo/internal/data"
+
+	"github.com/google/uuid"
+)
+
+const testEmail = "test@email.com"
+
+var (
+	testUserId     = uuid.MustParse("6f1c1f0e-5d7a-4a7e-9a36-2f6d8f0c2a01")
+	testTodoListId = uuid.MustParse("6f1c1f0e-5d7a-4a7e-9a36-2f6d8f0c2a02")
+	testTokenId    = uuid.MustParse("6f1c1f0e-5d7a-4a7e-9a36-2f6d8f0c2a03")
+)
+
+func Test_Handler(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	openItem := data.Item{Id: uuid.New(), TodoListId: testTodoListId, Name: "open", Description: "desc1", Active: true, Version: 1, CreatedOn: now, UpdatedOn: now}
+	doneItem := data.Item{Id: uuid.New(), TodoListId: testTodoListId, Name: "done", Description: "desc2", MarkDone: true, Active: true, Version: 3, CreatedOn: now, UpdatedOn: now, CalendarUid: "uid-2", CalendarName: "client.ics"}
+	items := []data.Item{openItem, doneItem}
+
+	put := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:new-uid\r\nSUMMARY:new\r\nDESCRIPTION:desc3\r\nPRIORITY:1\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/><C:calendar-data/></D:prop>` +
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"><C:prop-filter name="COMPLETED"><C:is-not-defined/></C:prop-filter></C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+
+	testCases := []struct {
+		testName     string
+		method       string
+		path         string
+		token        string
+		header       map[string]string
+		body         string
+		expectedCode int
+		expected     []string
+		unexpected   []string
+	}{
+		{
+			testName:     "Fail - not logged in",
+			method:       "PROPFIND",
+			path:         "/caldav/",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			testName:     "Fail - invalid token",
+			method:       "PROPFIND",
+			path:         "/caldav/",
+			token:        "wrong",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			testName:     "Fail - someone else's calendar",
+			method:       "PROPFIND",
+			path:         "/caldav/other@email.com/todo/",
+			token:        "secret",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			testName:     "Root points to the principal",
+			method:       "PROPFIND",
+			path:         "/caldav/",
+			token:        "secret",
+			header:       map[string]string{"Depth": "0"},
+			body:         `<D:propfind xmlns:D="DAV:"><D:prop><D:current-user-principal/><D:unknown/></D:prop></D:propfind>`,
+			expectedCode: http.StatusMultiStatus,
+			expected:     []string{"<D:current-user-principal><D:href>/caldav/test@email.com/</D:href></D:current-user-principal>", "<D:unknown/></D:prop><D:status>HTTP/1.1 404 Not Found"},
+		},
+		{
+			testName:     "Collection lists its resources",
+			method:       "PROPFIND",
+			path:         "/caldav/test@email.com/todo/",
+			token:        "secret",
+			header:       map[string]string{"Depth": "1"},
+			expectedCode: http.StatusMultiStatus,
+			expected: []string{
+				"<C:calendar/>",
+				"<CS:getctag>",
+				"<D:href>/caldav/test@email.com/todo/" + openItem.Id.String() + ".ics</D:href>",
+				"<D:href>/caldav/test@email.com/todo/client.ics</D:href>",
+				"<D:getetag>&#34;3&#34;</D:getetag>",
+			},
+		},
+		{
+			testName:     "Path email in another case",
+			method:       http.MethodGet,
+			path:         "/caldav/TEST@email.com/todo/client.ics",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"UID:uid-2\r\n"},
+		},
+		{
+			testName:     "Query for open tasks",
+			method:       "REPORT",
+			path:         "/caldav/test@email.com/todo/",
+			token:        "secret",
+			body:         query,
+			expectedCode: http.StatusMultiStatus,
+			expected:     []string{"SUMMARY:open"},
+			unexpected:   []string{"SUMMARY:done"},
+		},
+		{
+			testName:     "Get a resource",
+			method:       http.MethodGet,
+			path:         "/caldav/test@email.com/todo/client.ics",
+			token:        "secret",
+			expectedCode: http.StatusOK,
+			expected:     []string{"UID:uid-2\r\n", "STATUS:COMPLETED\r\n"},
+		},
+		{
+			testName:     "Create a resource",
+			method:       http.MethodPut,
+			path:         "/caldav/test@email.com/todo/new.ics",
+			token:        "secret",
+			header:       map[string]string{"If-None-Match": "*"},
+			body:         put,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			testName:     "Fail - overwrite with If-None-Match",
+			method:       http.MethodPut,
+			path:         "/caldav/test@email.com/todo/client.ics",
+			token:        "secret",
+			header:       map[string]string{"If-None-Match": "*"},
+			body:         put,
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			testName:     "Fail - delete with a stale etag",
+			method:       http.MethodDelete,
+			path:         "/caldav/test@email.com/todo/client.ics",
+			token:        "secret",
+			header:       map[string]string{"If-Match": `"2"`},
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			testName:     "Fail - delete with a weak etag",
+			method:       http.MethodDelete,
+			path:         "/caldav/test@email.com/todo/client.ics",
+			token:        "secret",
+			header:       map[string]string{"If-Match": `W/"3"`},
+			expectedCode: http.StatusPreconditionFailed,
+		},
+		{
+			testName:     "Delete a resource",
+			method:       http.MethodDelete,
+			path:         "/caldav/test@email.com/todo/client.ics",
+			token:        "secret",
+			header:       map[string]string{"If-Match": `"3"`},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			testName:     "Fail - unknown resource",
+			method:       http.MethodGet,
+			path:         "/caldav/test@email.com/todo/missing.ics",
+			token:        "secret",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	// preserve original function
+	oriWithTx := data.WithTx
+	oriAddAuditEvent := data.AddAuditEvent
+	oriAddOperation := data.AddOperation
+	oriAddOutboxEvent := data.AddOutboxEvent
+	oriGetUser := data.GetUser
+	oriUseAppToken := data.UseAppToken
+	oriListItemPage := data.ListItemPage
+	oriGetItemByCalendarName := data.GetItemByCalendarName
+	oriGetTodoList := data.GetTodoList
+	oriGetItemByItemNameFold := data.GetItemByItemNameFold
+	oriAddItem := data.AddItem
+	oriUpdateItem := data.UpdateItem
+	oriSetItemPlanning := data.SetItemPlanning
+	oriSetItemCalendarName := data.SetItemCalendarName
+
+	data.WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	data.AddAuditEvent = func(ctx context.Context, event data.AuditEvent) error {
+		return nil
+	}
+	data.AddOperation = func(ctx context.Context, op data.Operation) error {
+		return nil
+	}
+	data.AddOutboxEvent = func(ctx context.Context, event data.OutboxEvent) error {
+		return nil
+	}
+	data.GetUser = func(ctx context.Context, email string) (data.User, error) {
+		if email != testEmail {
+			return data.User{}, sql.ErrNoRows
+		}
+		return data.User{Id: testUserId, Email: email, TodoListId: testTodoListId}, nil
+	}
+	data.UseAppToken = func(ctx context.Context, tokenHash string) (data.AppToken, error) {
+		// sha256 of "secret"
+		if tokenHash != "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" {
+			return data.AppToken{}, sql.ErrNoRows
+		}
+		return data.AppToken{Id: testTokenId, UserId: testUserId, Active: true}, nil
+	}
+	data.ListItemPage = func(ctx context.Context, todoListId uuid.UUID, after data.Item, limit int) ([]data.Item, error) {
+		return items, nil
+	}
+	data.GetItemByCalendarName = func(ctx context.Context, todoListId uuid.UUID, calendarName string) (data.Item, error) {
+		for _, item := range items {
+			if calendarName == item.CalendarName || (item.CalendarName == "" && calendarName == item.Id.String()+".ics") {
+				return item, nil
+			}
+		}
+		return data.Item{}, sql.ErrNoRows
+	}
+	data.GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (data.TodoList, error) {
+		return data.TodoList{Id: todoListId, DuplicatePolicy: data.DuplicatePolicyReject}, nil
+	}
+	data.GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (data.Item, error) {
+		return data.Item{}, sql.ErrNoRows
+	}
+	data.AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
+		return uuid.New(), nil
+	}
+	data.UpdateItem = func(ctx context.Context, itemId string, item data.Item) (bool, error) {
+		return true, nil
+	}
+	var priority int
+	data.SetItemPlanning = func(ctx context.Context, itemId uuid.UUID, due *time.Time, p int, categories []string) error {
+		priority = p
+		return nil
+	}
+	var calendarUid, calendarName string
+	data.SetItemCalendarName = func(ctx context.Context, itemId uuid.UUID, uid string, name string) error {
+		calendarUid, calendarName = uid, name
+		return nil
+	}
+
+	handler := Handler()
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.SetBasicAuth(testEmail, tc.token)
+			}
+			for key, value := range tc.header {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedCode {
+				tt.Fatalf("%s %s failed, got code %d, want %d: %s", tc.method, tc.path, rec.Code, tc.expectedCode, rec.Body.String())
+			}
+			for _, expected := range tc.expected {
+				if !strings.Contains(rec.Body.String(), expected) {
+					tt.Errorf("%s %s failed, missing %q in %s", tc.method, tc.path, expected, rec.Body.String())
+				}
+			}
+			for _, unexpected := range tc.unexpected {
+				if strings.Contains(rec.Body.String(), unexpected) {
+					tt.Errorf("%s %s failed, not expecting %q in %s", tc.method, tc.path, unexpected, rec.Body.String())
+				}
+			}
+		})
+	}
+
+	if calendarUid != "new-uid" || calendarName != "new.ics" || priority != 1 {
+		t.Errorf("PUT failed, stored uid %q, name %q and priority %d", calendarUid, calendarName, priority)
+	}
+
+	// reset
+	data.WithTx = oriWithTx
+	data.AddAuditEvent = oriAddAuditEvent
+	data.AddOperation = oriAddOperation
+	data.AddOutboxEvent = oriAddOutboxEvent
+	data.GetUser = oriGetUser
+	data.UseAppToken = oriUseAppToken
+	data.ListItemPage = oriListItemPage
+	data.GetItemByCalendarName = oriGetItemByCalendarName
+	data.GetTodoList = oriGetTodoList
+	data.GetItemByItemNameFold = oriGetItemByItemNameFold
+	data.AddItem = oriAddItem
+	data.UpdateItem = oriUpdateItem
+	data.SetItemPlanning = oriSetItemPlanning
+	data.SetItemCalendarName = oriSetItemCalendarName
+}
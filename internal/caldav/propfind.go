@@ -0,0 +1,406 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	business "todo/internal/business"
+	data "todo/internal/data"
+)
+
+// XML namespaces of the properties served
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+var prefixes = map[string]string{
+	nsDAV:            "D",
+	nsCalDAV:         "C",
+	nsCalendarServer: "CS",
+}
+
+// largest PROPFIND or REPORT body read
+const maxRequestBytes = 64 << 10
+
+// properties of a resource, as XML fragments, in the order they are written
+type property struct {
+	name  xml.Name
+	value string
+}
+
+type response struct {
+	href    string
+	found   []property
+	missing []xml.Name
+}
+
+// Child element names of a DAV:prop element
+type propNames []xml.Name
+
+func (p *propNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			*p = append(*p, token.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type propfindRequest struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     propNames `xml:"DAV: prop"`
+}
+
+// Reads a request body, an empty body is an allprop PROPFIND
+func readBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return io.EOF
+	}
+	return xml.Unmarshal(body, v)
+}
+
+func propfind(ctx context.Context, w http.ResponseWriter, r *http.Request, t target, href string) {
+	var req propfindRequest
+	err := readBody(r, &req)
+	if err != nil && err != io.EOF {
+		http.Error(w, "invalid PROPFIND body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// nil names are every property but the calendar data
+	names := []xml.Name(req.Prop)
+	if err == io.EOF || req.AllProp != nil {
+		names = nil
+	}
+
+	depth := r.Header.Get("Depth")
+	var responses []response
+
+	switch {
+	case t.name != "":
+		item, err := business.GetCalendarItem(ctx, t.user, t.name)
+		if err != nil {
+			writeError(ctx, w, err)
+			return
+		}
+		responses = append(responses, pick(t.resourceHref(business.CalendarResourceName(item)), itemProperties(item, false), names, req.PropName != nil))
+	case t.collection:
+		items, err := business.ListCalendarItems(ctx, t.user)
+		if err != nil {
+			writeError(ctx, w, err)
+			return
+		}
+		responses = append(responses, pick(t.collectionHref(), collectionProperties(t, items), names, req.PropName != nil))
+		if depth != "0" {
+			for _, item := range items {
+				responses = append(responses, pick(t.resourceHref(business.CalendarResourceName(item)), itemProperties(item, false), names, req.PropName != nil))
+			}
+		}
+	default:
+		// the root and the principal answer the same, the principal is also the calendar home
+		responses = append(responses, pick(href, principalProperties(t, href == Prefix), names, req.PropName != nil))
+		if depth != "0" && href != Prefix {
+			items, err := business.ListCalendarItems(ctx, t.user)
+			if err != nil {
+				writeError(ctx, w, err)
+				return
+			}
+			responses = append(responses, pick(t.collectionHref(), collectionProperties(t, items), names, req.PropName != nil))
+		}
+	}
+
+	writeMultistatus(w, responses)
+}
+
+// The filters of a calendar-query that are applied, others are ignored and the
+// server answers with more resources than asked for
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters []struct {
+		Name         string    `xml:"name,attr"`
+		IsNotDefined *struct{} `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	} `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	TimeRange *struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    propNames `xml:"DAV: prop"`
+	Filter  struct {
+		CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Hrefs []string `xml:"DAV: href"`
+}
+
+// Answers the calendar-query and calendar-multiget reports of RFC 4791
+func report(ctx context.Context, w http.ResponseWriter, r *http.Request, t target) {
+	if !t.collection {
+		http.Error(w, "reports are only supported on the calendar collection", http.StatusForbidden)
+		return
+	}
+
+	var req reportRequest
+	if err := readBody(r, &req); err != nil {
+		http.Error(w, "invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	names := []xml.Name(req.Prop)
+	if len(names) == 0 {
+		names = []xml.Name{{Space: nsDAV, Local: "getetag"}, {Space: nsCalDAV, Local: "calendar-data"}}
+	}
+
+	var responses []response
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		items, err := business.ListCalendarItems(ctx, t.user)
+		if err != nil {
+			writeError(ctx, w, err)
+			return
+		}
+		for _, item := range items {
+			if t.name != "" && business.CalendarResourceName(item) != t.name {
+				continue
+			}
+			if matches(item, req.Filter.CompFilter) {
+				responses = append(responses, pick(t.resourceHref(business.CalendarResourceName(item)), itemProperties(item, true), names, false))
+			}
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			name := hrefName(href)
+			item, err := business.GetCalendarItem(ctx, t.user, name)
+			if err != nil {
+				// unknown resources are reported in the multistatus
+				responses = append(responses, response{href: href})
+				continue
+			}
+			responses = append(responses, pick(href, itemProperties(item, true), names, false))
+		}
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+
+	writeMultistatus(w, responses)
+}
+
+// Last segment of an href, unescaped
+func hrefName(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		href = u.Path
+	}
+	return path.Base(href)
+}
+
+// Applies a VCALENDAR comp-filter to an item
+func matches(item data.Item, filter compFilter) bool {
+	if filter.Name != "" && !strings.EqualFold(filter.Name, "VCALENDAR") {
+		return false
+	}
+	for _, comp := range filter.CompFilters {
+		if !strings.EqualFold(comp.Name, "VTODO") {
+			return false
+		}
+
+		for _, prop := range comp.PropFilters {
+			// commonly used to only fetch open tasks
+			if strings.EqualFold(prop.Name, "COMPLETED") && (prop.IsNotDefined != nil) == item.MarkDone {
+				return false
+			}
+		}
+
+		// items without a due date match every range
+		if comp.TimeRange != nil && item.Due != nil {
+			if start, err := time.Parse("20060102T150405Z", comp.TimeRange.Start); err == nil && item.Due.Before(start) {
+				return false
+			}
+			if end, err := time.Parse("20060102T150405Z", comp.TimeRange.End); err == nil && !item.Due.Before(end) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Picks the requested properties of a resource, nil names picks every property
+func pick(href string, properties []property, names []xml.Name, namesOnly bool) response {
+	res := response{href: href}
+
+	if names == nil {
+		for _, p := range properties {
+			if p.name.Local == "calendar-data" {
+				continue
+			}
+			if namesOnly {
+				p.value = ""
+			}
+			res.found = append(res.found, p)
+		}
+		return res
+	}
+
+	for _, name := range names {
+		found := false
+		for _, p := range properties {
+			if p.name == name {
+				res.found = append(res.found, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			res.missing = append(res.missing, name)
+		}
+	}
+	return res
+}
+
+func hrefElement(value string) string {
+	return "<D:href>" + escape(value) + "</D:href>"
+}
+
+func principalProperties(t target, root bool) []property {
+	resourceType := "<D:collection/><D:principal/>"
+	if root {
+		resourceType = "<D:collection/>"
+	}
+
+	return []property{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, resourceType},
+		{xml.Name{Space: nsDAV, Local: "displayname"}, escape(t.email)},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefElement(t.principalHref())},
+		{xml.Name{Space: nsDAV, Local: "principal-URL"}, hrefElement(t.principalHref())},
+		{xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}, hrefElement(t.principalHref())},
+		{xml.Name{Space: nsCalDAV, Local: "calendar-user-address-set"}, hrefElement("mailto:" + t.email)},
+	}
+}
+
+func collectionProperties(t target, items []data.Item) []property {
+	tag := collectionTag(items)
+
+	return []property{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, "<D:collection/><C:calendar/>"},
+		{xml.Name{Space: nsDAV, Local: "displayname"}, "Todo list"},
+		{xml.Name{Space: nsDAV, Local: "getetag"}, escape(tag)},
+		{xml.Name{Space: nsCalendarServer, Local: "getctag"}, escape(tag)},
+		{xml.Name{Space: nsDAV, Local: "current-user-principal"}, hrefElement(t.principalHref())},
+		{xml.Name{Space: nsDAV, Local: "owner"}, hrefElement(t.principalHref())},
+		{xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}, `<C:comp name="VTODO"/>`},
+		{xml.Name{Space: nsDAV, Local: "supported-report-set"},
+			"<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>" +
+				"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>"},
+		{xml.Name{Space: nsDAV, Local: "current-user-privilege-set"},
+			"<D:privilege><D:read/></D:privilege><D:privilege><D:write-content/></D:privilege>" +
+				"<D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>"},
+	}
+}
+
+func itemProperties(item data.Item, withData bool) []property {
+	object := business.CalendarObject(item)
+
+	properties := []property{
+		{xml.Name{Space: nsDAV, Local: "resourcetype"}, ""},
+		{xml.Name{Space: nsDAV, Local: "getetag"}, escape(business.ETag(item.Version))},
+		{xml.Name{Space: nsDAV, Local: "getcontenttype"}, "text/calendar; charset=utf-8; component=VTODO"},
+		{xml.Name{Space: nsDAV, Local: "getcontentlength"}, strconv.Itoa(len(object))},
+		{xml.Name{Space: nsDAV, Local: "getlastmodified"}, item.UpdatedOn.UTC().Format(http.TimeFormat)},
+	}
+	if withData {
+		properties = append(properties, property{xml.Name{Space: nsCalDAV, Local: "calendar-data"}, escape(string(object))})
+	}
+	return properties
+}
+
+// Changes whenever an item is added, changed or removed, clients use it to tell
+// whether they need to sync
+func collectionTag(items []data.Item) string {
+	h := sha256.New()
+	for _, item := range items {
+		h.Write([]byte(item.Id.String() + ":" + strconv.FormatInt(item.Version, 10) + "\n"))
+	}
+	return strconv.Quote(hex.EncodeToString(h.Sum(nil))[:32])
+}
+
+func escape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// Writes an element name, with a prefix of its own for namespaces not declared on the root
+func element(name xml.Name, n int) (open string, close string) {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local, prefix + ":" + name.Local
+	}
+	prefix := "x" + strconv.Itoa(n)
+	return prefix + ":" + name.Local + ` xmlns:` + prefix + `="` + escape(name.Space) + `"`, prefix + ":" + name.Local
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []response) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="` + nsCalDAV + `" xmlns:CS="` + nsCalendarServer + `">`)
+
+	for _, res := range responses {
+		b.WriteString("<D:response>" + hrefElement(res.href))
+		if len(res.found) == 0 && len(res.missing) == 0 {
+			b.WriteString("<D:status>HTTP/1.1 404 Not Found</D:status></D:response>")
+			continue
+		}
+
+		if len(res.found) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for i, p := range res.found {
+				open, close := element(p.name, i)
+				if p.value == "" {
+					b.WriteString("<" + open + "/>")
+					continue
+				}
+				b.WriteString("<" + open + ">" + p.value + "</" + close + ">")
+			}
+			b.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+		}
+		if len(res.missing) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for i, name := range res.missing {
+				open, _ := element(name, i)
+				b.WriteString("<" + open + "/>")
+			}
+			b.WriteString("</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+		}
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>\n")
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How client certificates are asked for by a server
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// Settings of a TLS listener, read from the tls section of config.yaml
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientAuthNone, ClientAuthRequest (verified when sent) or ClientAuthRequire
+	ClientAuth string
+	// CAs that client certificates must be signed by
+	ClientCAFile string
+}
+
+// Settings of the connection of the HTTP gateway to the gRPC server
+type ClientConfig struct {
+	// CAs the server certificate is verified with, the system roots when empty
+	CAFile string
+	// name the server certificate is verified for
+	ServerName string
+	// optional client certificate, for servers requiring mutual TLS
+	CertFile string
+	KeyFile  string
+}
+
+// A certificate and key pair, reloaded from its files when they change
+type Certificate struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	modTime  time.Time
+}
+
+func LoadCertificate(certFile string, keyFile string) (*Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("missing certFile or keyFile")
+	}
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// for tls.Config.GetCertificate
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// for tls.Config.GetClientCertificate
+func (c *Certificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+func (c *Certificate) reload() (bool, error) {
+	modTime, err := lastModified(c.certFile, c.keyFile)
+	if err != nil || !modTime.After(c.modTime) {
+		return false, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.cert.Store(&cert)
+	c.modTime = modTime
+	return true, nil
+}
+
+// A pool of CA certificates, reloaded from its file when it changes
+type CertPool struct {
+	file    string
+	pool    atomic.Pointer[x509.CertPool]
+	modTime time.Time
+}
+
+func LoadCertPool(file string) (*CertPool, error) {
+	p := &CertPool{file: file}
+	if _, err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *CertPool) Pool() *x509.CertPool {
+	return p.pool.Load()
+}
+
+func (p *CertPool) reload() (bool, error) {
+	modTime, err := lastModified(p.file)
+	if err != nil || !modTime.After(p.modTime) {
+		return false, err
+	}
+
+	pem, err := os.ReadFile(p.file)
+	if err != nil {
+		return false, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return false, errors.New("no certificate found in " + p.file)
+	}
+	p.pool.Store(pool)
+	p.modTime = modTime
+	return true, nil
+}
+
+func lastModified(files ...string) (time.Time, error) {
+	var last time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+type reloader interface {
+	reload() (bool, error)
+}
+
+type watchedFile struct {
+	name string
+	item reloader
+}
+
+// Certificates and pools reloaded by Watch
+var (
+	watchedMu sync.Mutex
+	watched   []watchedFile
+)
+
+func watch(name string, item reloader) {
+	watchedMu.Lock()
+	defer watchedMu.Unlock()
+	watched = append(watched, watchedFile{name: name, item: item})
+}
+
+// Builds the configuration of a TLS server. The certificate and client CAs are watched,
+// new handshakes use them as soon as Watch reloaded them. Client certificates, when
+// asked for, are verified before the handshake completes.
+func ServerTLSConfig(config Config) (*tls.Config, error) {
+	cert, err := LoadCertificate(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	watch(config.CertFile, cert)
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.GetCertificate,
+	}
+
+	// client certificates are verified by VerifyConnection, with the current client CAs
+	switch config.ClientAuth {
+	case "", ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAnyClientCert
+	default:
+		return nil, errors.New("unknown clientAuth " + config.ClientAuth)
+	}
+
+	if config.ClientCAFile == "" {
+		return nil, errors.New("clientAuth " + config.ClientAuth + " requires clientCAFile")
+	}
+	clientCAs, err := LoadCertPool(config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	watch(config.ClientCAFile, clientCAs)
+
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			// RequireAnyClientCert already failed the handshake
+			return nil
+		}
+		return verify(state.PeerCertificates, clientCAs.Pool(), "", x509.ExtKeyUsageClientAuth)
+	}
+	return tlsConfig, nil
+}
+
+// Builds the configuration of a TLS client, see ServerTLSConfig
+func ClientTLSConfig(config ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+
+	if config.CertFile != "" {
+		cert, err := LoadCertificate(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		watch(config.CertFile, cert)
+		tlsConfig.GetClientCertificate = cert.GetClientCertificate
+	}
+
+	if config.CAFile == "" {
+		return tlsConfig, nil
+	}
+	roots, err := LoadCertPool(config.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	watch(config.CAFile, roots)
+
+	// RootCAs can't be swapped per connection, verify with the current pool instead
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		return verify(state.PeerCertificates, roots.Pool(), state.ServerName, x509.ExtKeyUsageServerAuth)
+	}
+	return tlsConfig, nil
+}
+
+// Verifies the certificate chain sent by a peer, the first certificate is the peer's
+func verify(chain []*x509.Certificate, roots *x509.CertPool, dnsName string, usage x509.ExtKeyUsage) error {
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       dnsName,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(opts)
+	return err
+}
+
+// Reloads the certificates and CAs of the TLS configurations every interval when their
+// files changed, e.g. after a renewal. A file that fails to load is logged, and the
+// previous one kept until it's fixed.
+func Watch(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			watchedMu.Lock()
+			for _, file := range watched {
+				reloaded, err := file.item.reload()
+				if err != nil {
+					slog.Error("certificate reload failed, keeping the previous one", "file", file.name, "error", err)
+				} else if reloaded {
+					slog.Info("certificate reloaded", "file", file.name)
+				}
+			}
+			watchedMu.Unlock()
+		}
+	}()
+
+	return done
+}
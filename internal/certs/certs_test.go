@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// A CA signing the certificates of a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.path("ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// Issues a certificate to <name>.pem and <name>-key.pem
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage, uri string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if uri != "" {
+		parsed, _ := url.Parse(uri)
+		template.URIs = []*url.URL{parsed}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, ca.path(name+".pem"), "CERTIFICATE", der)
+	writePEM(t, ca.path(name+"-key.pem"), "EC PRIVATE KEY", keyDer)
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Runs a TLS handshake between server and client, returning the connection state
+// seen by the server
+func handshake(server *tls.Config, client *tls.Config) (tls.ConnectionState, error) {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer lis.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		err = tlsConn.Handshake()
+		results <- result{state: tlsConn.ConnectionState(), err: err}
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		// with TLS 1.3 the server checks the client certificate after the client is done
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	res := <-results
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return res.state, res.err
+}
+
+func Test_Handshake(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "")
+	ca.issue(t, "client", x509.ExtKeyUsageClientAuth, "spiffe://todo.local/reporting")
+	other := newTestCA(t)
+	other.issue(t, "client", x509.ExtKeyUsageClientAuth, "")
+
+	testCases := []struct {
+		testName   string
+		server     Config
+		client     ClientConfig
+		wantErr    bool
+		clientCert bool
+	}{
+		{
+			testName: "TLS",
+			server:   Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem")},
+			client:   ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "localhost"},
+		},
+		{
+			testName: "Fail - wrong server name",
+			server:   Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem")},
+			client:   ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "todo.example.com"},
+			wantErr:  true,
+		},
+		{
+			testName: "Mutual TLS",
+			server: Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"),
+				ClientAuth: ClientAuthRequire, ClientCAFile: ca.path("ca.pem")},
+			client: ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "localhost",
+				CertFile: ca.path("client.pem"), KeyFile: ca.path("client-key.pem")},
+			clientCert: true,
+		},
+		{
+			testName: "Fail - mutual TLS without a client certificate",
+			server: Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"),
+				ClientAuth: ClientAuthRequire, ClientCAFile: ca.path("ca.pem")},
+			client:  ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "localhost"},
+			wantErr: true,
+		},
+		{
+			testName: "Mutual TLS optional",
+			server: Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"),
+				ClientAuth: ClientAuthRequest, ClientCAFile: ca.path("ca.pem")},
+			client: ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "localhost"},
+		},
+		{
+			testName: "Fail - client certificate of another CA",
+			server: Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"),
+				ClientAuth: ClientAuthRequest, ClientCAFile: ca.path("ca.pem")},
+			client: ClientConfig{CAFile: ca.path("ca.pem"), ServerName: "localhost",
+				CertFile: other.path("client.pem"), KeyFile: other.path("client-key.pem")},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			server, err := ServerTLSConfig(tc.server)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			client, err := ClientTLSConfig(tc.client)
+			if err != nil {
+				tt.Fatal(err)
+			}
+
+			state, err := handshake(server, client)
+			if (err != nil) != tc.wantErr {
+				tt.Fatalf("handshake failed, got error %v, wantErr %v", err, tc.wantErr)
+			}
+			if err == nil && (len(state.PeerCertificates) > 0) != tc.clientCert {
+				tt.Errorf("handshake failed, got %d client certificates", len(state.PeerCertificates))
+			}
+		})
+	}
+}
+
+func Test_ServerTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "")
+
+	testCases := []struct {
+		testName string
+		config   Config
+	}{
+		{
+			testName: "Fail - missing key",
+			config:   Config{CertFile: ca.path("server.pem")},
+		},
+		{
+			testName: "Fail - unknown clientAuth",
+			config:   Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"), ClientAuth: "always"},
+		},
+		{
+			testName: "Fail - clientAuth without clientCAFile",
+			config:   Config{CertFile: ca.path("server.pem"), KeyFile: ca.path("server-key.pem"), ClientAuth: ClientAuthRequire},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			if _, err := ServerTLSConfig(tc.config); err == nil {
+				tt.Errorf("ServerTLSConfig() failed, expecting an error")
+			}
+		})
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "")
+
+	// only watch the certificate of this test
+	watchedMu.Lock()
+	watched = nil
+	watchedMu.Unlock()
+
+	cert, err := LoadCertificate(ca.path("server.pem"), ca.path("server-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch(ca.path("server.pem"), cert)
+	before, _ := cert.GetCertificate(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := Watch(ctx, 10*time.Millisecond)
+
+	// renewal, with a later modification time than the first files
+	ca.issue(t, "server", x509.ExtKeyUsageServerAuth, "")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(ca.path("server.pem"), later, later)
+	os.Chtimes(ca.path("server-key.pem"), later, later)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		after, _ := cert.GetCertificate(nil)
+		if after != before {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch() failed, the renewed certificate wasn't loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	// reset
+	watchedMu.Lock()
+	watched = nil
+	watchedMu.Unlock()
+}
+
+func Test_Principal(t *testing.T) {
+	// preserve original principals
+	oriPrincipals := Principals
+	Principals = map[string]string{
+		"spiffe://todo.local/reporting": "reporting@todo.local",
+		"backup":                        "backup@todo.local",
+	}
+
+	reporting, _ := url.Parse("spiffe://todo.local/reporting")
+	testCases := []struct {
+		testName    string
+		authInfo    credentials.AuthInfo
+		expectedOut string
+	}{
+		{
+			testName:    "URI SAN",
+			authInfo:    credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{URIs: []*url.URL{reporting}}}}},
+			expectedOut: "reporting@todo.local",
+		},
+		{
+			testName:    "Common name",
+			authInfo:    credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "backup"}}}}},
+			expectedOut: "backup@todo.local",
+		},
+		{
+			testName:    "Unmapped certificate",
+			authInfo:    credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "gateway"}}}}},
+			expectedOut: "",
+		},
+		{
+			testName:    "No client certificate",
+			authInfo:    credentials.TLSInfo{},
+			expectedOut: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{}, AuthInfo: tc.authInfo})
+
+			var got string
+			UnaryServerInterceptor(ctx, nil, nil, func(ctx context.Context, req any) (any, error) {
+				got = FromContext(ctx)
+				return nil, nil
+			})
+			if got != tc.expectedOut {
+				tt.Errorf("%s failed, got principal %q, want %q", tc.testName, got, tc.expectedOut)
+			}
+		})
+	}
+
+	// reset
+	Principals = oriPrincipals
+}
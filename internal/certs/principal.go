@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Client certificate identities mapped to the principal, i.e. the user email, that
+// callers presenting them act as. Identities are URI SANs (e.g. SPIFFE ids), DNS SANs
+// or the subject common name. Set from config.yaml at startup.
+var Principals = map[string]string{}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Returns the principal of the caller's verified client certificate, or "" when the
+// caller didn't present one or it isn't mapped
+func FromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// Tags calls made with a mapped client certificate with their principal
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if principal := peerPrincipal(ctx); principal != "" {
+		ctx = NewContext(ctx, principal)
+	}
+	return handler(ctx, req)
+}
+
+// Streaming version of UnaryServerInterceptor
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if principal := peerPrincipal(ss.Context()); principal != "" {
+		ss = &serverStream{ServerStream: ss, ctx: NewContext(ss.Context(), principal)}
+	}
+	return handler(srv, ss)
+}
+
+// grpc.ServerStream with a replaced context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func peerPrincipal(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	// client certificates that made it through the handshake were verified, see ServerTLSConfig
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return ""
+	}
+	return principal(tlsInfo.State.PeerCertificates[0])
+}
+
+func principal(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if principal, ok := Principals[uri.String()]; ok {
+			return principal
+		}
+	}
+	for _, name := range cert.DNSNames {
+		if principal, ok := Principals[name]; ok {
+			return principal
+		}
+	}
+	return Principals[cert.Subject.CommonName]
+}
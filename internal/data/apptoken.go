@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+var AddAppToken = func(ctx context.Context, token AppToken) error {
+	ctx, cancel := withTimeout(ctx, "AddAppToken")
+	defer cancel()
+
+	query := `INSERT INTO main.appToken(id, userId, name, tokenHash) VALUES($1,$2,$3,$4);`
+	_, err := writer(ctx).ExecContext(ctx, query, token.Id, token.UserId, token.Name, token.TokenHash)
+	if err != nil {
+		return queryErr(ctx, "AddAppToken", err)
+	}
+
+	return nil
+}
+
+// Lists the active app tokens of a user, oldest first
+var ListAppTokens = func(ctx context.Context, userId uuid.UUID) ([]AppToken, error) {
+	ctx, cancel := withTimeout(ctx, "ListAppTokens")
+	defer cancel()
+
+	query := `SELECT id, userId, name, active, lastUsedOn, createdOn FROM main.appToken WHERE userId=$1 AND active ORDER BY createdOn, id`
+	rows, err := reader(ctx).QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, queryErr(ctx, "ListAppTokens", err)
+	}
+	defer rows.Close()
+
+	var tokens []AppToken
+	for rows.Next() {
+		var token AppToken
+		err = rows.Scan(
+			&token.Id,
+			&token.UserId,
+			&token.Name,
+			&token.Active,
+			&token.LastUsedOn,
+			&token.CreatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListAppTokens", err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, queryErr(ctx, "ListAppTokens", rows.Err())
+}
+
+// Deactivates an app token of a user, returns false if the user has no such active token
+var RevokeAppToken = func(ctx context.Context, userId uuid.UUID, tokenId uuid.UUID) (bool, error) {
+	ctx, cancel := withTimeout(ctx, "RevokeAppToken")
+	defer cancel()
+
+	query := `UPDATE main.appToken SET active=false WHERE id=$1 AND userId=$2 AND active`
+	res, err := writer(ctx).ExecContext(ctx, query, tokenId, userId)
+	if err != nil {
+		return false, queryErr(ctx, "RevokeAppToken", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Returns the active app token with the given hash and records that it was used
+var UseAppToken = func(ctx context.Context, tokenHash string) (AppToken, error) {
+	ctx, cancel := withTimeout(ctx, "UseAppToken")
+	defer cancel()
+
+	query := `UPDATE main.appToken SET lastUsedOn=current_timestamp WHERE tokenHash=$1 AND active
+		RETURNING id, userId, name, active, lastUsedOn, createdOn`
+	row := writer(ctx).QueryRowContext(ctx, query, tokenHash)
+
+	var token AppToken
+	err := row.Scan(
+		&token.Id,
+		&token.UserId,
+		&token.Name,
+		&token.Active,
+		&token.LastUsedOn,
+		&token.CreatedOn,
+	)
+	if err != nil {
+		return AppToken{}, queryErr(ctx, "UseAppToken", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Appends an event to main.auditEvent, Id and CreatedOn are filled in by the database
+var AddAuditEvent = func(ctx context.Context, event AuditEvent) error {
+	ctx, cancel := withTimeout(ctx, "AddAuditEvent")
+	defer cancel()
+
+	query := `INSERT INTO main.auditEvent(id, actorId, action, entityType, entityId, todoListId, itemId, before, after, requestId)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10);`
+	_, err := writer(ctx).ExecContext(ctx, query,
+		uuid.New(),
+		nullUUID(event.ActorId),
+		event.Action,
+		event.EntityType,
+		event.EntityId,
+		nullUUID(event.TodoListId),
+		nullUUID(event.ItemId),
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		event.RequestId,
+	)
+	if err != nil {
+		return queryErr(ctx, "AddAuditEvent", err)
+	}
+
+	return nil
+}
+
+// Lists audit events matching filter, newest first
+var ListAuditEvents = func(ctx context.Context, filter AuditEventFilter) ([]AuditEvent, error) {
+	ctx, cancel := withTimeout(ctx, "ListAuditEvents")
+	defer cancel()
+
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.TodoListId != uuid.Nil {
+		where("todoListId=?", filter.TodoListId)
+	}
+	if filter.ItemId != uuid.Nil {
+		where("itemId=?", filter.ItemId)
+	}
+	if filter.ActorId != uuid.Nil {
+		where("actorId=?", filter.ActorId)
+	}
+	if !filter.From.IsZero() {
+		where("createdOn>=?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("createdOn<?", filter.To)
+	}
+
+	query := `SELECT id, actorId, action, entityType, entityId, todoListId, itemId, before, after, requestId, createdOn FROM main.auditEvent`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY createdOn DESC, id"
+	if filter.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(filter.Limit)
+	}
+
+	rows, err := reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, queryErr(ctx, "ListAuditEvents", err)
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		var actorId, todoListId, itemId sql.NullString
+		err = rows.Scan(
+			&event.Id,
+			&actorId,
+			&event.Action,
+			&event.EntityType,
+			&event.EntityId,
+			&todoListId,
+			&itemId,
+			&event.Before,
+			&event.After,
+			&event.RequestId,
+			&event.CreatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListAuditEvents", err)
+		}
+		event.ActorId, _ = uuid.Parse(actorId.String)
+		event.TodoListId, _ = uuid.Parse(todoListId.String)
+		event.ItemId, _ = uuid.Parse(itemId.String)
+
+		events = append(events, event)
+	}
+
+	return events, queryErr(ctx, "ListAuditEvents", rows.Err())
+}
+
+func nullUUID(id uuid.UUID) any {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+func nullJSON(j []byte) any {
+	if j == nil {
+		return nil
+	}
+	return string(j)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("todo/internal/data")
+
+// Timeout applied to every query unless overridden in QueryTimeouts
+var DefaultQueryTimeout = 5 * time.Second
+
+// Per-operation timeouts, keyed by lower-cased data function name e.g. "listitem"
+var QueryTimeouts = map[string]time.Duration{}
+
+type txKey struct{}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Returns the transaction carried by ctx, or the shared pool when there is none.
+func conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return DB
+}
+
+// Derives the context a single data operation runs with, bounded by its configured timeout.
+// Within a traced call the operation is traced as a span ending with the returned cancel
+// func; the polling of background workers isn't, it would start a trace every second.
+func withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		ctx, span = tracer.Start(ctx, "data."+op,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(op)),
+		)
+	}
+
+	timeout, ok := QueryTimeouts[strings.ToLower(op)]
+	if !ok {
+		timeout = DefaultQueryTimeout
+	}
+	var cancel context.CancelFunc
+	if timeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
+
+// Reports cancellations and deadlines as context errors rather than driver errors,
+// so callers can tell them apart with errors.Is.
+func queryErr(ctx context.Context, op string, err error) error {
+	if err == nil || err == sql.ErrNoRows {
+		return err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = fmt.Errorf("%s: %w", op, ctxErr)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
@@ -3,38 +3,183 @@ package internal
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var DB *sql.DB
 
+// Returned by AddItem and UpdateItem when an active item with the same name already exists
+var ErrDuplicateName = errors.New("item with the same name already exists")
+
+// Returned by AddItem when the list doesn't exist
+var ErrTodoListNotFound = errors.New("todo list does not exist")
+
+// Inserts a new item. Unless the list allows duplicates, the name must be unique among
+// the list's active items, otherwise ErrDuplicateName is returned.
 var AddItem = func(ctx context.Context, userId uuid.UUID, todoListId uuid.UUID, itemName string, itemDescription string) (uuid.UUID, error) {
+	ctx, cancel := withTimeout(ctx, "AddItem")
+	defer cancel()
+
 	id := uuid.New()
 
-	query := `INSERT INTO main.item(id, todoListId, name, description) VALUES ($1,$2,$3,$4);`
-	_, err := DB.Exec(query, id, todoListId, itemName, itemDescription)
+	// the new item is also saved as its first revision
+	query := `WITH inserted AS (
+			INSERT INTO main.item(id, todoListId, name, description, uniqueName)
+			SELECT $1, $2, $3, $4, duplicatePolicy <> 'allow' FROM main.todolist WHERE id=$2
+			ON CONFLICT (todoListId, lower(name)) WHERE active AND uniqueName DO NOTHING
+			RETURNING id, version, name, description, markDone, active, createdOn
+		)
+		INSERT INTO main.itemRevision(itemId, revision, name, description, markDone, active, createdOn)
+		SELECT id, version, name, description, markDone, active, createdOn FROM inserted;`
+	res, err := writer(ctx).ExecContext(ctx, query, id, todoListId, itemName, itemDescription)
+	if err != nil {
+		return uuid.Nil, queryErr(ctx, "AddItem", err)
+	}
+
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return uuid.Nil, err
 	}
+	if affected == 0 {
+		// nothing is inserted either without a list
+		var exists bool
+		query := `SELECT EXISTS(SELECT 1 FROM main.todolist WHERE id=$1)`
+		if err := writer(ctx).QueryRowContext(ctx, query, todoListId).Scan(&exists); err != nil {
+			return uuid.Nil, queryErr(ctx, "AddItem", err)
+		}
+		if !exists {
+			return uuid.Nil, ErrTodoListNotFound
+		}
+		return uuid.Nil, ErrDuplicateName
+	}
 
 	return id, nil
 }
 
+// Returned by UpdateItem when the item's version no longer matches item.Version
+var ErrVersionConflict = errors.New("item was modified by another request")
+
+// Updates an item only if it is still at item.Version, bumping the version on success.
+// Every update is kept as a new revision of the item.
 var UpdateItem = func(ctx context.Context, itemId string, item Item) (bool, error) {
-	query := `UPDATE main.item SET name=$1, description=$2, markDone=$3, active=$4, updatedOn=$5 WHERE id=$6;`
-	_, err := DB.Exec(query, item.Name, item.Description, item.MarkDone, item.Active, time.Now(), item.Id)
+	ctx, cancel := withTimeout(ctx, "UpdateItem")
+	defer cancel()
+
+	query := `WITH updated AS (
+			UPDATE main.item SET name=$1, description=$2, markDone=$3, active=$4, updatedOn=$5, version=version+1 WHERE id=$6 AND version=$7
+			RETURNING id, version, name, description, markDone, active, updatedOn
+		)
+		INSERT INTO main.itemRevision(itemId, revision, name, description, markDone, active, createdOn)
+		SELECT id, version, name, description, markDone, active, updatedOn FROM updated;`
+	res, err := writer(ctx).ExecContext(ctx, query, item.Name, item.Description, item.MarkDone, item.Active, time.Now(), item.Id, item.Version)
+	if isUniqueViolation(err) {
+		return false, ErrDuplicateName
+	}
+	if err != nil {
+		return false, queryErr(ctx, "UpdateItem", err)
+	}
+
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return false, err
 	}
+	if affected == 0 {
+		return false, ErrVersionConflict
+	}
 
 	return true, nil
 }
 
+// Sets the calendar fields of an item. Meant for items being added, so neither the
+// version nor the revisions change.
+var SetItemPlanning = func(ctx context.Context, itemId uuid.UUID, due *time.Time, priority int, categories []string) error {
+	ctx, cancel := withTimeout(ctx, "SetItemPlanning")
+	defer cancel()
+
+	if categories == nil {
+		categories = []string{}
+	}
+
+	query := `UPDATE main.item SET due=$1, priority=$2, categories=$3 WHERE id=$4`
+	_, err := writer(ctx).ExecContext(ctx, query, due, priority, pq.Array(categories), itemId)
+	if err != nil {
+		return queryErr(ctx, "SetItemPlanning", err)
+	}
+
+	return nil
+}
+
+// Sets the VTODO UID and resource name of an item created by a CalDAV client
+var SetItemCalendarName = func(ctx context.Context, itemId uuid.UUID, calendarUid string, calendarName string) error {
+	ctx, cancel := withTimeout(ctx, "SetItemCalendarName")
+	defer cancel()
+
+	query := `UPDATE main.item SET calendarUid=$1, calendarName=$2 WHERE id=$3`
+	_, err := writer(ctx).ExecContext(ctx, query, calendarUid, calendarName, itemId)
+	if err != nil {
+		return queryErr(ctx, "SetItemCalendarName", err)
+	}
+
+	return nil
+}
+
+// Returns the active item of a list with the given CalDAV resource name. Items that were
+// not created over CalDAV are named by their id followed by .ics, they are looked up by
+// the id parsed from the name, so both lookups use an index.
+var GetItemByCalendarName = func(ctx context.Context, todoListId uuid.UUID, calendarName string) (Item, error) {
+	ctx, cancel := withTimeout(ctx, "GetItemByCalendarName")
+	defer cancel()
+
+	// NULL unless the name is a default one
+	var itemId *uuid.UUID
+	if id, ok := strings.CutSuffix(calendarName, ".ics"); ok {
+		if parsed, err := uuid.Parse(id); err == nil && parsed.String() == id {
+			itemId = &parsed
+		}
+	}
+
+	columns := `id, todoListId, name, description, markDone, active, version, createdOn, updatedOn, due, priority, categories, calendarUid, calendarName`
+	query := `(SELECT ` + columns + ` FROM main.item WHERE todoListId=$1 AND active AND calendarName<>'' AND calendarName=$2)
+		UNION ALL
+		(SELECT ` + columns + ` FROM main.item WHERE todoListId=$1 AND active AND calendarName='' AND id=$3)
+		LIMIT 1`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, calendarName, itemId)
+
+	var item Item
+	err := row.Scan(
+		&item.Id,
+		&item.TodoListId,
+		&item.Name,
+		&item.Description,
+		&item.MarkDone,
+		&item.Active,
+		&item.Version,
+		&item.CreatedOn,
+		&item.UpdatedOn,
+		&item.Due,
+		&item.Priority,
+		pq.Array(&item.Categories),
+		&item.CalendarUid,
+		&item.CalendarName,
+	)
+	if err != nil {
+		return Item{}, queryErr(ctx, "GetItemByCalendarName", err)
+	}
+
+	return item, nil
+}
+
 var GetItemByItemName = func(ctx context.Context, todoListId uuid.UUID, itemName string) (Item, error) {
-	query := `SELECT id, todoListId, name, description, markDone FROM main.item WHERE todoListId=$1 AND name=$2 AND active=true`
-	row := DB.QueryRow(query, todoListId, itemName)
+	ctx, cancel := withTimeout(ctx, "GetItemByItemName")
+	defer cancel()
+
+	query := `SELECT id, todoListId, name, description, markDone, version FROM main.item WHERE todoListId=$1 AND name=$2 AND active=true ORDER BY createdOn, id LIMIT 1`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, itemName)
 
 	var item Item
 	err := row.Scan(
@@ -43,75 +188,312 @@ var GetItemByItemName = func(ctx context.Context, todoListId uuid.UUID, itemName
 		&item.Name,
 		&item.Description,
 		&item.MarkDone,
+		&item.Version,
 	)
 	if err != nil {
-		return Item{}, err
+		return Item{}, queryErr(ctx, "GetItemByItemName", err)
+	}
+
+	return item, nil
+}
+
+// Same as GetItemByItemName, but matches names case-insensitively like the unique index does
+var GetItemByItemNameFold = func(ctx context.Context, todoListId uuid.UUID, itemName string) (Item, error) {
+	ctx, cancel := withTimeout(ctx, "GetItemByItemNameFold")
+	defer cancel()
+
+	query := `SELECT id, todoListId, name, description, markDone, version FROM main.item WHERE todoListId=$1 AND lower(name)=lower($2) AND active=true ORDER BY createdOn, id LIMIT 1`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, itemName)
+
+	var item Item
+	err := row.Scan(
+		&item.Id,
+		&item.TodoListId,
+		&item.Name,
+		&item.Description,
+		&item.MarkDone,
+		&item.Version,
+	)
+	if err != nil {
+		return Item{}, queryErr(ctx, "GetItemByItemNameFold", err)
+	}
+
+	return item, nil
+}
+
+// Returns an item of the list by id, including soft deleted items
+var GetItemById = func(ctx context.Context, todoListId uuid.UUID, itemId uuid.UUID) (Item, error) {
+	ctx, cancel := withTimeout(ctx, "GetItemById")
+	defer cancel()
+
+	query := `SELECT id, todoListId, name, description, markDone, active, version, createdOn, updatedOn, due, priority, categories, calendarUid, calendarName FROM main.item WHERE todoListId=$1 AND id=$2`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, itemId)
+
+	var item Item
+	err := row.Scan(
+		&item.Id,
+		&item.TodoListId,
+		&item.Name,
+		&item.Description,
+		&item.MarkDone,
+		&item.Active,
+		&item.Version,
+		&item.CreatedOn,
+		&item.UpdatedOn,
+		&item.Due,
+		&item.Priority,
+		pq.Array(&item.Categories),
+		&item.CalendarUid,
+		&item.CalendarName,
+	)
+	if err != nil {
+		return Item{}, queryErr(ctx, "GetItemById", err)
 	}
 
 	return item, nil
 }
 
 var ListItem = func(ctx context.Context, todoListId uuid.UUID) ([]Item, error) {
-	query := `SELECT name, description, markDone FROM main.item WHERE todoListId=$1 AND active=true`
-	rows, err := DB.Query(query, todoListId)
+	ctx, cancel := withTimeout(ctx, "ListItem")
+	defer cancel()
+
+	query := `SELECT id, name, description, markDone, version, due, priority, categories FROM main.item WHERE todoListId=$1 AND active=true`
+	rows, err := reader(ctx).QueryContext(ctx, query, todoListId)
 	if err != nil {
-		return nil, err
+		return nil, queryErr(ctx, "ListItem", err)
 	}
+	defer rows.Close()
 
 	var items []Item
 	for rows.Next() {
 		var item Item
-		err = rows.Scan(&item.Name, &item.Description, &item.MarkDone)
+		err = rows.Scan(&item.Id, &item.Name, &item.Description, &item.MarkDone, &item.Version, &item.Due, &item.Priority, pq.Array(&item.Categories))
 		if err != nil {
-			return nil, err
+			return nil, queryErr(ctx, "ListItem", err)
 		}
 
 		items = append(items, item)
 	}
 
-	return items, nil
+	return items, queryErr(ctx, "ListItem", rows.Err())
+}
+
+// Lists up to limit active items of a list created after the given item, oldest first,
+// so long lists can be read page by page. Pass a zero Item for the first page.
+var ListItemPage = func(ctx context.Context, todoListId uuid.UUID, after Item, limit int) ([]Item, error) {
+	ctx, cancel := withTimeout(ctx, "ListItemPage")
+	defer cancel()
+
+	query := `SELECT id, todoListId, name, description, markDone, active, version, createdOn, updatedOn, due, priority, categories, calendarUid, calendarName FROM main.item
+		WHERE todoListId=$1 AND active=true AND (createdOn, id) > ($2, $3) ORDER BY createdOn, id LIMIT $4`
+	rows, err := reader(ctx).QueryContext(ctx, query, todoListId, after.CreatedOn, after.Id, limit)
+	if err != nil {
+		return nil, queryErr(ctx, "ListItemPage", err)
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		var item Item
+		err = rows.Scan(
+			&item.Id,
+			&item.TodoListId,
+			&item.Name,
+			&item.Description,
+			&item.MarkDone,
+			&item.Active,
+			&item.Version,
+			&item.CreatedOn,
+			&item.UpdatedOn,
+			&item.Due,
+			&item.Priority,
+			pq.Array(&item.Categories),
+			&item.CalendarUid,
+			&item.CalendarName,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListItemPage", err)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, queryErr(ctx, "ListItemPage", rows.Err())
+}
+
+// Counts the active items of a list
+var CountActiveItems = func(ctx context.Context, todoListId uuid.UUID) (int, error) {
+	ctx, cancel := withTimeout(ctx, "CountActiveItems")
+	defer cancel()
+
+	query := `SELECT count(*) FROM main.item WHERE todoListId=$1 AND active`
+	row := writer(ctx).QueryRowContext(ctx, query, todoListId)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, queryErr(ctx, "CountActiveItems", err)
+	}
+
+	return count, nil
+}
+
+// Takes the row lock of a list until the transaction ends. The row is written rather than
+// selected FOR UPDATE, so that a repeatable read transaction that waited for the lock fails
+// with a serialization error, and is retried with a snapshot showing the other's changes.
+var LockTodoList = func(ctx context.Context, todoListId uuid.UUID) error {
+	ctx, cancel := withTimeout(ctx, "LockTodoList")
+	defer cancel()
+
+	query := `UPDATE main.todolist SET updatedOn=$1 WHERE id=$2`
+	_, err := writer(ctx).ExecContext(ctx, query, time.Now(), todoListId)
+	if err != nil {
+		return queryErr(ctx, "LockTodoList", err)
+	}
+
+	return nil
 }
 
 var GetTodoListIdByUserId = func(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+	ctx, cancel := withTimeout(ctx, "GetTodoListIdByUserId")
+	defer cancel()
+
 	query := `SELECT todoListId FROM main.user WHERE id=$1`
-	row := DB.QueryRow(query, userId)
+	row := reader(ctx).QueryRowContext(ctx, query, userId)
 
 	var todoListId uuid.UUID
 	err := row.Scan(&todoListId)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, queryErr(ctx, "GetTodoListIdByUserId", err)
 	}
 
 	return todoListId, nil
 }
 
 var AddTodoList = func(ctx context.Context) (uuid.UUID, error) {
+	ctx, cancel := withTimeout(ctx, "AddTodoList")
+	defer cancel()
+
 	id := uuid.New()
 
 	query := `INSERT INTO main.todoList(id) VALUES($1);`
-	_, err := DB.Exec(query, id)
+	_, err := writer(ctx).ExecContext(ctx, query, id)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, queryErr(ctx, "AddTodoList", err)
 	}
 
 	return id, nil
 }
 
+var GetTodoList = func(ctx context.Context, todoListId uuid.UUID) (TodoList, error) {
+	ctx, cancel := withTimeout(ctx, "GetTodoList")
+	defer cancel()
+
+	query := `SELECT id, active, duplicatePolicy, createdOn, updatedOn FROM main.todolist WHERE id=$1`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId)
+
+	var todoList TodoList
+	err := row.Scan(
+		&todoList.Id,
+		&todoList.Active,
+		&todoList.DuplicatePolicy,
+		&todoList.CreatedOn,
+		&todoList.UpdatedOn,
+	)
+	if err != nil {
+		return TodoList{}, queryErr(ctx, "GetTodoList", err)
+	}
+
+	return todoList, nil
+}
+
+// Changes how duplicate item names are handled in a list.
+// When duplicates stop being allowed, the oldest item of each name becomes the unique one.
+var UpdateDuplicatePolicy = func(ctx context.Context, todoListId uuid.UUID, policy string) error {
+	ctx, cancel := withTimeout(ctx, "UpdateDuplicatePolicy")
+	defer cancel()
+
+	return WithTx(ctx, func(ctx context.Context) error {
+		query := `UPDATE main.todolist SET duplicatePolicy=$1, updatedOn=$2 WHERE id=$3`
+		if _, err := writer(ctx).ExecContext(ctx, query, policy, time.Now(), todoListId); err != nil {
+			return queryErr(ctx, "UpdateDuplicatePolicy", err)
+		}
+		if policy == DuplicatePolicyAllow {
+			return nil
+		}
+
+		// clear first, the unique index is checked row by row
+		query = `UPDATE main.item SET uniqueName=false WHERE todoListId=$1 AND active`
+		if _, err := writer(ctx).ExecContext(ctx, query, todoListId); err != nil {
+			return queryErr(ctx, "UpdateDuplicatePolicy", err)
+		}
+		query = `UPDATE main.item i SET uniqueName=true WHERE i.todoListId=$1 AND i.active AND NOT EXISTS (
+			SELECT 1 FROM main.item o WHERE o.todoListId=i.todoListId AND o.active AND lower(o.name)=lower(i.name)
+			AND (o.createdOn, o.id) < (i.createdOn, i.id))`
+		if _, err := writer(ctx).ExecContext(ctx, query, todoListId); err != nil {
+			return queryErr(ctx, "UpdateDuplicatePolicy", err)
+		}
+		return nil
+	})
+}
+
+// Sets the hash of the token of the list's calendar feed, an empty hash removes the feed
+var UpdateCalendarTokenHash = func(ctx context.Context, todoListId uuid.UUID, tokenHash string) error {
+	ctx, cancel := withTimeout(ctx, "UpdateCalendarTokenHash")
+	defer cancel()
+
+	query := `UPDATE main.todolist SET calendarTokenHash=NULLIF($1, ''), updatedOn=$2 WHERE id=$3`
+	_, err := writer(ctx).ExecContext(ctx, query, tokenHash, time.Now(), todoListId)
+	if err != nil {
+		return queryErr(ctx, "UpdateCalendarTokenHash", err)
+	}
+
+	return nil
+}
+
+// Returns the list whose calendar feed has the given token hash
+var GetTodoListByCalendarTokenHash = func(ctx context.Context, tokenHash string) (TodoList, error) {
+	ctx, cancel := withTimeout(ctx, "GetTodoListByCalendarTokenHash")
+	defer cancel()
+
+	query := `SELECT id, active, duplicatePolicy, createdOn, updatedOn FROM main.todolist WHERE calendarTokenHash=$1`
+	row := reader(ctx).QueryRowContext(ctx, query, tokenHash)
+
+	var todoList TodoList
+	err := row.Scan(
+		&todoList.Id,
+		&todoList.Active,
+		&todoList.DuplicatePolicy,
+		&todoList.CreatedOn,
+		&todoList.UpdatedOn,
+	)
+	if err != nil {
+		return TodoList{}, queryErr(ctx, "GetTodoListByCalendarTokenHash", err)
+	}
+
+	return todoList, nil
+}
+
 var AddUser = func(ctx context.Context, email string, todoListId uuid.UUID) (uuid.UUID, error) {
+	ctx, cancel := withTimeout(ctx, "AddUser")
+	defer cancel()
+
 	id := uuid.New()
 
 	query := `INSERT INTO main.user(id, email, todoListId) VALUES($1,$2,$3);`
-	_, err := DB.Exec(query, id, email, todoListId)
+	_, err := writer(ctx).ExecContext(ctx, query, id, email, todoListId)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, queryErr(ctx, "AddUser", err)
 	}
 
 	return id, nil
 }
 
 var GetUser = func(ctx context.Context, email string) (User, error) {
+	ctx, cancel := withTimeout(ctx, "GetUser")
+	defer cancel()
+
 	query := `SELECT * FROM main.user WHERE email = $1;`
-	row := DB.QueryRow(query, email)
+	row := reader(ctx).QueryRowContext(ctx, query, email)
 
 	var user User
 	err := row.Scan(
@@ -123,7 +505,7 @@ var GetUser = func(ctx context.Context, email string) (User, error) {
 		&user.UpdatedOn,
 	)
 	if err != nil {
-		return User{}, err
+		return User{}, queryErr(ctx, "GetUser", err)
 	}
 
 	return user, nil
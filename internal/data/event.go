@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Returned by ListItemEvents when the afterSeq cursor isn't an event of the list
+var ErrUnknownCursor = errors.New("unknown cursor")
+
+// Lists up to limit events of a list that come after the afterSeq cursor, oldest first.
+// Sequence numbers are taken before commit, so a transaction can commit an event after a
+// later one was read: events are ordered by transaction, and those of transactions not
+// older than every running one are held back, heldBack tells whether there are any.
+// Always read from the primary, which is where change notifications come from.
+var ListItemEvents = func(ctx context.Context, todoListId uuid.UUID, afterSeq int64, limit int) (events []ItemEvent, heldBack bool, err error) {
+	ctx, cancel := withTimeout(ctx, "ListItemEvents")
+	defer cancel()
+
+	afterTxId := "0"
+	if afterSeq > 0 {
+		query := `SELECT txId::text FROM main.itemEvent WHERE seq=$1 AND todoListId=$2`
+		err := conn(ctx).QueryRowContext(ctx, query, afterSeq, todoListId).Scan(&afterTxId)
+		if err == sql.ErrNoRows {
+			return nil, false, ErrUnknownCursor
+		}
+		if err != nil {
+			return nil, false, queryErr(ctx, "ListItemEvents", err)
+		}
+	}
+
+	query := `SELECT seq, kind, itemId, todoListId, name, description, markDone, active, version, createdOn,
+			txId >= pg_snapshot_xmin(pg_current_snapshot())
+		FROM main.itemEvent WHERE todoListId=$1 AND (txId, seq) > ($2::xid8, $3)
+		ORDER BY txId, seq LIMIT $4`
+	rows, err := conn(ctx).QueryContext(ctx, query, todoListId, afterTxId, afterSeq, limit)
+	if err != nil {
+		return nil, false, queryErr(ctx, "ListItemEvents", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event ItemEvent
+		var running bool
+		err = rows.Scan(
+			&event.Seq,
+			&event.Kind,
+			&event.Item.Id,
+			&event.Item.TodoListId,
+			&event.Item.Name,
+			&event.Item.Description,
+			&event.Item.MarkDone,
+			&event.Item.Active,
+			&event.Item.Version,
+			&event.CreatedOn,
+			&running,
+		)
+		if err != nil {
+			return nil, false, queryErr(ctx, "ListItemEvents", err)
+		}
+		// this and the following events may come before events not committed yet
+		if running {
+			heldBack = true
+			break
+		}
+		event.Item.UpdatedOn = event.CreatedOn
+
+		events = append(events, event)
+	}
+
+	return events, heldBack, queryErr(ctx, "ListItemEvents", rows.Err())
+}
+
+// Returns the cursor of the latest event of a list ListItemEvents doesn't hold back, 0
+// when there is none
+var LatestItemEventSeq = func(ctx context.Context, todoListId uuid.UUID) (int64, error) {
+	ctx, cancel := withTimeout(ctx, "LatestItemEventSeq")
+	defer cancel()
+
+	query := `SELECT COALESCE((
+			SELECT seq FROM main.itemEvent
+			WHERE todoListId=$1 AND txId < pg_snapshot_xmin(pg_current_snapshot())
+			ORDER BY txId DESC, seq DESC LIMIT 1
+		), 0)`
+	var seq int64
+	if err := conn(ctx).QueryRowContext(ctx, query, todoListId).Scan(&seq); err != nil {
+		return 0, queryErr(ctx, "LatestItemEventSeq", err)
+	}
+
+	return seq, nil
+}
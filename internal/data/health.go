@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+	health "todo/internal/health"
+)
+
+// Pings the database every interval until ctx is done, reporting the result and pool
+// stats as the "database" health component. Transitions are logged.
+// The returned channel is closed once the checks stopped.
+func StartHealthCheck(ctx context.Context, interval time.Duration, timeout time.Duration) <-chan struct{} {
+	healthy := true
+	check := func() {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := DB.PingContext(pingCtx)
+		cancel()
+
+		stats := PoolStats()
+		health.Set("database", err, stats)
+		if err != nil && healthy {
+			slog.Error("database unreachable, marking server not ready", "error", err, "pool", stats)
+		}
+		if err == nil && !healthy {
+			slog.Info("database reachable again", "pool", stats)
+		}
+		healthy = err == nil
+	}
+
+	check()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+
+	return done
+}
+
+// Summarizes sql.DBStats of the pool
+func PoolStats() string {
+	stats := DB.Stats()
+	return fmt.Sprintf("open=%d inUse=%d idle=%d waitCount=%d waitDuration=%s maxIdleClosed=%d maxLifetimeClosed=%d",
+		stats.OpenConnections,
+		stats.InUse,
+		stats.Idle,
+		stats.WaitCount,
+		stats.WaitDuration,
+		stats.MaxIdleClosed,
+		stats.MaxLifetimeClosed,
+	)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	health "todo/internal/health"
+)
+
+// Applies <n>_<name>_up.sql scripts from dir that are newer than the first time setup, in order.
+// Applied versions are recorded in main.migration so each script runs once.
+func Migrate(ctx context.Context, dir string) error {
+	query := `CREATE TABLE IF NOT EXISTS main.migration(
+		version integer primary key,
+		name varchar(128),
+		appliedOn timestamp with time zone default current_timestamp
+	);`
+	if _, err := DB.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*_up.sql"))
+	if err != nil {
+		return err
+	}
+
+	type migration struct {
+		version int
+		path    string
+	}
+	var migrations []migration
+	for _, path := range files {
+		version, err := strconv.Atoi(strings.SplitN(filepath.Base(path), "_", 2)[0])
+		// 1_first_time_up.sql is run by the first time setup
+		if err != nil || version <= 1 {
+			continue
+		}
+		migrations = append(migrations, migration{version, path})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	for _, m := range migrations {
+		var applied bool
+		query := `SELECT EXISTS(SELECT 1 FROM main.migration WHERE version=$1)`
+		if err := DB.QueryRowContext(ctx, query, m.version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		sqlScript, err := os.ReadFile(m.path)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("applying migration", "file", filepath.Base(m.path))
+		err = WithTx(ctx, func(ctx context.Context) error {
+			if _, err := conn(ctx).ExecContext(ctx, string(sqlScript)); err != nil {
+				return err
+			}
+			query := `INSERT INTO main.migration(version, name) VALUES($1,$2)`
+			_, err := conn(ctx).ExecContext(ctx, query, m.version, filepath.Base(m.path))
+			return err
+		})
+		if err != nil {
+			err = fmt.Errorf("migration %s failed: %w", filepath.Base(m.path), err)
+			health.Set("migrations", err, "")
+			return err
+		}
+	}
+
+	// report the schema version the server runs on
+	latest := 1
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	health.Set("migrations", nil, "version "+strconv.Itoa(latest))
+	return nil
+}
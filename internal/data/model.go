@@ -15,20 +15,188 @@ type User struct {
 	UpdatedOn  time.Time
 }
 
+// How a list handles adding an item whose name is already used by an active item
+const (
+	DuplicatePolicyReject     = "reject"
+	DuplicatePolicyAllow      = "allow"
+	DuplicatePolicyAutoSuffix = "auto_suffix"
+)
+
 type TodoList struct {
-	Id        uuid.UUID
-	Active    bool
-	CreatedOn time.Time
-	UpdatedOn time.Time
+	Id              uuid.UUID
+	Active          bool
+	DuplicatePolicy string
+	CreatedOn       time.Time
+	UpdatedOn       time.Time
 }
 
 type Item struct {
-	Id          uuid.UUID
-	TodoListId  uuid.UUID
-	Name        string `json:"itemName"`
-	Description string `json:"itemDescription"`
-	MarkDone    bool   `json:"done"`
-	Active      bool
-	CreatedOn   time.Time
-	UpdatedOn   time.Time
+	Id          uuid.UUID `json:"itemId"`
+	TodoListId  uuid.UUID `json:"todoListId"`
+	Name        string    `json:"itemName"`
+	Description string    `json:"itemDescription"`
+	MarkDone    bool      `json:"done"`
+	Active      bool      `json:"active"`
+	Version     int64     `json:"version"`
+	CreatedOn   time.Time `json:"createdOn"`
+	UpdatedOn   time.Time `json:"updatedOn"`
+	// calendar fields, Priority goes from 1 (highest) to 9 and is 0 when undefined
+	Due        *time.Time `json:"due,omitempty"`
+	Priority   int        `json:"priority"`
+	Categories []string   `json:"categories"`
+	// set on items created by a CalDAV client, the VTODO UID and the resource name
+	CalendarUid  string `json:"calendarUid,omitempty"`
+	CalendarName string `json:"calendarName,omitempty"`
+}
+
+// State of an item as of one of its versions
+type ItemRevision struct {
+	ItemId      uuid.UUID `json:"itemId"`
+	Revision    int64     `json:"revision"`
+	Name        string    `json:"itemName"`
+	Description string    `json:"itemDescription"`
+	MarkDone    bool      `json:"done"`
+	Active      bool      `json:"active"`
+	CreatedOn   time.Time `json:"createdOn"`
+}
+
+// kinds of item events
+const (
+	ItemEventCreated = "created"
+	ItemEventUpdated = "updated"
+	ItemEventDeleted = "deleted"
+)
+
+// A change to an item as seen by watchers, Seq orders the events and serves as resume cursor
+type ItemEvent struct {
+	Seq       int64
+	Kind      string
+	Item      Item
+	CreatedOn time.Time
+}
+
+// kinds of journaled operations
+const (
+	OperationAdd    = "add"
+	OperationDelete = "delete"
+	OperationMark   = "mark"
+	OperationEdit   = "edit"
+)
+
+// A mutation of an item by a user that can be undone. Operations of the same call
+// share a GroupId and are undone together.
+type Operation struct {
+	Id           uuid.UUID
+	GroupId      uuid.UUID
+	UserId       uuid.UUID
+	Kind         string
+	ItemId       uuid.UUID
+	Before       *Item
+	AfterVersion int64
+	// version the item has to be at to undo the operation, see ListUndoableOperations
+	ExpectedVersion int64
+	Undone          bool
+	CreatedOn       time.Time
+}
+
+// One change recorded in the audit trail. Before and After are JSON snapshots
+// of the entity, nil when it didn't exist.
+type AuditEvent struct {
+	Id         uuid.UUID
+	ActorId    uuid.UUID
+	Action     string
+	EntityType string
+	EntityId   string
+	TodoListId uuid.UUID
+	ItemId     uuid.UUID
+	Before     []byte
+	After      []byte
+	RequestId  string
+	CreatedOn  time.Time
+}
+
+// Filters for ListAuditEvents, zero values match everything
+type AuditEventFilter struct {
+	TodoListId uuid.UUID
+	ItemId     uuid.UUID
+	ActorId    uuid.UUID
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// A token an app logs in with on behalf of a user, only its hash is kept
+type AppToken struct {
+	Id         uuid.UUID  `json:"appTokenId"`
+	UserId     uuid.UUID  `json:"userId"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Active     bool       `json:"active"`
+	LastUsedOn *time.Time `json:"lastUsedOn,omitempty"`
+	CreatedOn  time.Time  `json:"createdOn"`
+}
+
+// An endpoint called with the audited changes of a list. EventTypes are audit actions,
+// an empty list subscribes to all of them.
+type Webhook struct {
+	Id         uuid.UUID `json:"webhookId"`
+	UserId     uuid.UUID `json:"userId"`
+	TodoListId uuid.UUID `json:"todoListId"`
+	Url        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	CreatedOn  time.Time `json:"createdOn"`
+	UpdatedOn  time.Time `json:"updatedOn"`
+}
+
+// statuses of a webhook delivery
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+	WebhookDeliveryCancelled = "cancelled"
+)
+
+// One event queued for a webhook. Url and Secret are those of the webhook, they are only
+// filled in by ClaimWebhookDeliveries.
+type WebhookDelivery struct {
+	Id            uuid.UUID
+	WebhookId     uuid.UUID
+	EventId       uuid.UUID
+	EventType     string
+	Payload       []byte
+	Status        string
+	Attempts      int
+	NextAttemptOn time.Time
+	DeliveredOn   time.Time
+	CreatedOn     time.Time
+	Url           string
+	Secret        string
+}
+
+// One HTTP call made for a delivery, StatusCode is 0 when no response was received
+type WebhookAttempt struct {
+	DeliveryId uuid.UUID
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedOn  time.Time
+}
+
+// A domain event waiting in the outbox. Id is unique per event and lets sinks drop
+// duplicates, Published lists the sinks it already reached.
+type OutboxEvent struct {
+	Id            uuid.UUID
+	Seq           int64
+	Type          string
+	AggregateType string
+	AggregateId   string
+	TodoListId    uuid.UUID
+	Payload       []byte
+	RequestId     string
+	Attempts      int
+	CreatedOn     time.Time
+	Published     []string
 }
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Journals an operation, Id and CreatedOn are filled in by the database
+var AddOperation = func(ctx context.Context, op Operation) error {
+	ctx, cancel := withTimeout(ctx, "AddOperation")
+	defer cancel()
+
+	var before []byte
+	if op.Before != nil {
+		var err error
+		if before, err = json.Marshal(op.Before); err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO main.operation(id, groupId, userId, kind, itemId, before, afterVersion) VALUES($1,$2,$3,$4,$5,$6,$7);`
+	_, err := writer(ctx).ExecContext(ctx, query, uuid.New(), op.GroupId, op.UserId, op.Kind, op.ItemId, nullJSON(before), op.AfterVersion)
+	if err != nil {
+		return queryErr(ctx, "AddOperation", err)
+	}
+
+	return nil
+}
+
+// Returns the operations of the user's most recent groups made since the given time and
+// not undone yet, newest first. At most groups groups are returned. The expected version
+// of an operation is the one left by undoing the newest later operation on its item, its
+// AfterVersion when there is none or that one isn't undone.
+var ListUndoableOperations = func(ctx context.Context, userId uuid.UUID, since time.Time, groups int) ([]Operation, error) {
+	ctx, cancel := withTimeout(ctx, "ListUndoableOperations")
+	defer cancel()
+
+	query := `WITH recent AS (
+			SELECT groupId, max(createdOn) AS lastOn FROM main.operation
+			WHERE userId=$1 AND NOT undone AND createdOn>=$2
+			GROUP BY groupId ORDER BY lastOn DESC LIMIT $3
+		)
+		SELECT o.id, o.groupId, o.userId, o.kind, o.itemId, o.before, o.afterVersion,
+			COALESCE((
+				SELECT n.undoneVersion FROM main.operation n
+				WHERE n.itemId=o.itemId AND n.afterVersion>o.afterVersion
+				ORDER BY n.afterVersion DESC LIMIT 1
+			), o.afterVersion),
+			o.undone, o.createdOn
+		FROM main.operation o JOIN recent r ON r.groupId=o.groupId
+		WHERE NOT o.undone
+		ORDER BY r.lastOn DESC, o.createdOn DESC, o.afterVersion DESC`
+	rows, err := reader(ctx).QueryContext(ctx, query, userId, since, groups)
+	if err != nil {
+		return nil, queryErr(ctx, "ListUndoableOperations", err)
+	}
+	defer rows.Close()
+
+	var ops []Operation
+	for rows.Next() {
+		var op Operation
+		var before []byte
+		err = rows.Scan(
+			&op.Id,
+			&op.GroupId,
+			&op.UserId,
+			&op.Kind,
+			&op.ItemId,
+			&before,
+			&op.AfterVersion,
+			&op.ExpectedVersion,
+			&op.Undone,
+			&op.CreatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListUndoableOperations", err)
+		}
+		if before != nil {
+			op.Before = &Item{}
+			if err := json.Unmarshal(before, op.Before); err != nil {
+				return nil, err
+			}
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, queryErr(ctx, "ListUndoableOperations", rows.Err())
+}
+
+// Marks an operation undone, version is the one the undo left the item at
+var MarkOperationUndone = func(ctx context.Context, operationId uuid.UUID, version int64) error {
+	ctx, cancel := withTimeout(ctx, "MarkOperationUndone")
+	defer cancel()
+
+	query := `UPDATE main.operation SET undone=true, undoneVersion=$2 WHERE id=$1`
+	_, err := writer(ctx).ExecContext(ctx, query, operationId, version)
+	if err != nil {
+		return queryErr(ctx, "MarkOperationUndone", err)
+	}
+
+	return nil
+}
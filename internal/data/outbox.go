@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Writes a domain event to the outbox, run it in the same transaction as the change.
+// Seq and CreatedOn are filled in by the database.
+var AddOutboxEvent = func(ctx context.Context, event OutboxEvent) error {
+	ctx, cancel := withTimeout(ctx, "AddOutboxEvent")
+	defer cancel()
+
+	query := `INSERT INTO main.outboxEvent(id, type, aggregateType, aggregateId, todoListId, payload, requestId) VALUES($1,$2,$3,$4,$5,$6,$7);`
+	_, err := writer(ctx).ExecContext(ctx, query,
+		event.Id,
+		event.Type,
+		event.AggregateType,
+		event.AggregateId,
+		nullUUID(event.TodoListId),
+		nullJSON(event.Payload),
+		event.RequestId,
+	)
+	if err != nil {
+		return queryErr(ctx, "AddOutboxEvent", err)
+	}
+
+	return nil
+}
+
+// Takes up to limit unpublished events that are due, oldest first. Claimed events aren't
+// due again for lease, so several relays can share the outbox.
+var ClaimOutboxEvents = func(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	ctx, cancel := withTimeout(ctx, "ClaimOutboxEvents")
+	defer cancel()
+
+	now := time.Now()
+	query := `UPDATE main.outboxEvent e SET nextAttemptOn=$1
+		WHERE e.id IN (
+			SELECT id FROM main.outboxEvent
+			WHERE publishedOn IS NULL AND nextAttemptOn<=$2
+			ORDER BY seq LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING e.id, e.seq, e.type, e.aggregateType, e.aggregateId, coalesce(e.todoListId, ''), e.payload, e.requestId, e.attempts, e.createdOn,
+			ARRAY(SELECT sink FROM main.outboxPublication p WHERE p.eventId=e.id)`
+	rows, err := writer(ctx).QueryContext(ctx, query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, queryErr(ctx, "ClaimOutboxEvents", err)
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		var todoListId string
+		err = rows.Scan(
+			&event.Id,
+			&event.Seq,
+			&event.Type,
+			&event.AggregateType,
+			&event.AggregateId,
+			&todoListId,
+			&event.Payload,
+			&event.RequestId,
+			&event.Attempts,
+			&event.CreatedOn,
+			pq.Array(&event.Published),
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ClaimOutboxEvents", err)
+		}
+		event.TodoListId, _ = uuid.Parse(todoListId)
+
+		events = append(events, event)
+	}
+
+	return events, queryErr(ctx, "ClaimOutboxEvents", rows.Err())
+}
+
+// Records that an event reached a sink
+var AddOutboxPublication = func(ctx context.Context, eventId uuid.UUID, sink string) error {
+	ctx, cancel := withTimeout(ctx, "AddOutboxPublication")
+	defer cancel()
+
+	query := `INSERT INTO main.outboxPublication(eventId, sink) VALUES($1,$2) ON CONFLICT DO NOTHING;`
+	_, err := writer(ctx).ExecContext(ctx, query, eventId, sink)
+	if err != nil {
+		return queryErr(ctx, "AddOutboxPublication", err)
+	}
+
+	return nil
+}
+
+// Marks an event as published once every sink has it
+var CompleteOutboxEvent = func(ctx context.Context, eventId uuid.UUID) error {
+	ctx, cancel := withTimeout(ctx, "CompleteOutboxEvent")
+	defer cancel()
+
+	query := `UPDATE main.outboxEvent SET publishedOn=$1 WHERE id=$2`
+	_, err := writer(ctx).ExecContext(ctx, query, time.Now(), eventId)
+	if err != nil {
+		return queryErr(ctx, "CompleteOutboxEvent", err)
+	}
+
+	return nil
+}
+
+// Counts a failed attempt and makes the event due again at nextAttemptOn
+var RetryOutboxEvent = func(ctx context.Context, eventId uuid.UUID, nextAttemptOn time.Time) error {
+	ctx, cancel := withTimeout(ctx, "RetryOutboxEvent")
+	defer cancel()
+
+	query := `UPDATE main.outboxEvent SET attempts=attempts+1, nextAttemptOn=$1 WHERE id=$2`
+	_, err := writer(ctx).ExecContext(ctx, query, nextAttemptOn, eventId)
+	if err != nil {
+		return queryErr(ctx, "RetryOutboxEvent", err)
+	}
+
+	return nil
+}
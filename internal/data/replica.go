@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	health "todo/internal/health"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Replicas further behind the primary than this stop receiving reads
+var MaxReplicaLag = 5 * time.Second
+
+// After a caller writes, its reads go to the primary for this long so it sees its own changes
+var ReadYourWritesWindow = 10 * time.Second
+
+type Replica struct {
+	Name string
+	DB   *sql.DB
+
+	// set by the replica monitor
+	usable atomic.Bool
+	lag    atomic.Int64
+}
+
+var (
+	replicas    []*Replica
+	nextReplica atomic.Uint64
+
+	// last write per caller, see WithCaller. Entries older than ReadYourWritesWindow are
+	// swept by the replica monitor.
+	lastWrites sync.Map
+)
+
+type callerKey struct{}
+
+// Registers a read replica, it receives reads once the monitor has seen it caught up
+func AddReplica(name string, db *sql.DB) {
+	replicas = append(replicas, &Replica{Name: name, DB: db})
+}
+
+// Closes the primary and the replicas, once nothing queries them anymore
+func Close() error {
+	var errs []error
+	for _, replica := range replicas {
+		if err := replica.DB.Close(); err != nil {
+			errs = append(errs, errors.New("replica "+replica.Name+": "+err.Error()))
+		}
+	}
+	if DB != nil {
+		if err := DB.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Tags ctx with the identity of the caller, e.g. the logged in email, so that reads
+// following the caller's own writes are served by the primary
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// Returns the connection writes run on, and remembers the caller wrote just now
+func writer(ctx context.Context) querier {
+	// without replicas every read goes to the primary anyway
+	if caller, ok := ctx.Value(callerKey{}).(string); ok && caller != "" && len(replicas) > 0 {
+		lastWrites.Store(caller, time.Now())
+	}
+	return conn(ctx)
+}
+
+// Returns the connection reads run on: the current transaction if any, otherwise a usable
+// replica unless the caller wrote recently, falling back to the primary.
+func reader(ctx context.Context) querier {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok || len(replicas) == 0 {
+		return conn(ctx)
+	}
+
+	if caller, ok := ctx.Value(callerKey{}).(string); ok && caller != "" {
+		if wrote, ok := lastWrites.Load(caller); ok {
+			if time.Since(wrote.(time.Time)) < ReadYourWritesWindow {
+				return DB
+			}
+			lastWrites.Delete(caller)
+		}
+	}
+
+	start := nextReplica.Add(1)
+	for i := 0; i < len(replicas); i++ {
+		replica := replicas[(start+uint64(i))%uint64(len(replicas))]
+		if replica.usable.Load() {
+			// tells slow reads on a lagging replica apart in traces
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("db.replica", replica.Name))
+			return replica.DB
+		}
+	}
+	return DB
+}
+
+// Measures each replica's replay lag every interval until ctx is done.
+// Replicas that can't be reached or lag more than MaxReplicaLag are skipped by reads.
+// The returned channel is closed once the monitor stopped.
+func StartReplicaMonitor(ctx context.Context, interval time.Duration) <-chan struct{} {
+	check := func() {
+		for _, replica := range replicas {
+			lag, err := replicaLag(ctx, replica.DB)
+			usable := err == nil && lag <= MaxReplicaLag
+			replica.lag.Store(int64(lag))
+
+			// reads fall back to the primary, so replicas don't affect readiness
+			switch {
+			case err != nil:
+				health.SetOptional("replica "+replica.Name, err, "")
+			case !usable:
+				health.SetOptional("replica "+replica.Name, errors.New("lags "+lag.String()), "")
+			default:
+				health.SetOptional("replica "+replica.Name, nil, "lag "+lag.String())
+			}
+
+			if replica.usable.Swap(usable) != usable {
+				switch {
+				case err != nil:
+					slog.Warn("replica unreachable, reading from primary", "replica", replica.Name, "error", err)
+				case !usable:
+					slog.Warn("replica lags, reading from primary", "replica", replica.Name, "lag", lag)
+				default:
+					slog.Info("replica caught up", "replica", replica.Name, "lag", lag)
+				}
+			}
+		}
+	}
+
+	check()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+				sweepLastWrites()
+			}
+		}
+	}()
+
+	return done
+}
+
+// Forgets the writes of callers that are past ReadYourWritesWindow, callers that never
+// read again would otherwise stay in lastWrites
+func sweepLastWrites() {
+	lastWrites.Range(func(caller, wrote any) bool {
+		if time.Since(wrote.(time.Time)) >= ReadYourWritesWindow {
+			lastWrites.CompareAndDelete(caller, wrote)
+		}
+		return true
+	})
+}
+
+// Time since the last replayed transaction, zero when the replica has replayed
+// everything it received so an idle primary doesn't look like lag.
+func replicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	ctx, cancel := withTimeout(ctx, "replicaLag")
+	defer cancel()
+
+	query := `SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+	var seconds float64
+	if err := db.QueryRowContext(ctx, query).Scan(&seconds); err != nil {
+		return 0, queryErr(ctx, "replicaLag", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
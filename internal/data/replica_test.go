@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_StartReplicaMonitor_sweepsLastWrites(t *testing.T) {
+	lastWrites.Store("expired@email.com", time.Now().Add(-2*ReadYourWritesWindow))
+	lastWrites.Store("recent@email.com", time.Now())
+	defer lastWrites.Delete("recent@email.com")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := StartReplicaMonitor(ctx, 5*time.Millisecond)
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if _, ok := lastWrites.Load("expired@email.com"); !ok {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, ok := lastWrites.Load("expired@email.com"); ok {
+		t.Errorf("StartReplicaMonitor failed, the expired write is still remembered")
+	}
+	if _, ok := lastWrites.Load("recent@email.com"); !ok {
+		t.Errorf("StartReplicaMonitor failed, swept a write within ReadYourWritesWindow")
+	}
+}
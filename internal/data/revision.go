@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Lists the revisions of an item, newest first
+var ListItemRevisions = func(ctx context.Context, itemId uuid.UUID) ([]ItemRevision, error) {
+	ctx, cancel := withTimeout(ctx, "ListItemRevisions")
+	defer cancel()
+
+	query := `SELECT itemId, revision, name, description, markDone, active, createdOn FROM main.itemRevision WHERE itemId=$1 ORDER BY revision DESC`
+	rows, err := reader(ctx).QueryContext(ctx, query, itemId)
+	if err != nil {
+		return nil, queryErr(ctx, "ListItemRevisions", err)
+	}
+	defer rows.Close()
+
+	var revisions []ItemRevision
+	for rows.Next() {
+		var revision ItemRevision
+		err = rows.Scan(
+			&revision.ItemId,
+			&revision.Revision,
+			&revision.Name,
+			&revision.Description,
+			&revision.MarkDone,
+			&revision.Active,
+			&revision.CreatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListItemRevisions", err)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, queryErr(ctx, "ListItemRevisions", rows.Err())
+}
+
+var GetItemRevision = func(ctx context.Context, itemId uuid.UUID, revision int64) (ItemRevision, error) {
+	ctx, cancel := withTimeout(ctx, "GetItemRevision")
+	defer cancel()
+
+	query := `SELECT itemId, revision, name, description, markDone, active, createdOn FROM main.itemRevision WHERE itemId=$1 AND revision=$2`
+	row := reader(ctx).QueryRowContext(ctx, query, itemId, revision)
+
+	var res ItemRevision
+	err := row.Scan(
+		&res.ItemId,
+		&res.Revision,
+		&res.Name,
+		&res.Description,
+		&res.MarkDone,
+		&res.Active,
+		&res.CreatedOn,
+	)
+	if err != nil {
+		return ItemRevision{}, queryErr(ctx, "GetItemRevision", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Settings used by WithTx, overridden from config.yaml at startup
+type TxConfig struct {
+	Isolation    sql.IsolationLevel
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+var TxSettings = TxConfig{
+	Isolation:    sql.LevelRepeatableRead,
+	MaxRetries:   3,
+	RetryBackoff: 50 * time.Millisecond,
+}
+
+// Parses an isolation level name as written in config.yaml, e.g. "repeatable read"
+func ParseIsolation(name string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, errors.New("unknown isolation level: " + name)
+}
+
+// Runs fn inside a single database transaction using TxSettings.
+// Every data function called with the ctx passed to fn joins that transaction.
+// Nested calls reuse the outer transaction.
+var WithTx = func(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTxOptions(ctx, &sql.TxOptions{Isolation: TxSettings.Isolation}, fn)
+}
+
+// Same as WithTx but with explicit transaction options.
+// The transaction is retried when postgres reports a serialization failure or deadlock.
+func WithTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	// the queries of the transaction are traced as children of this span, see withTimeout
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		ctx, span = tracer.Start(ctx, "data.WithTx", trace.WithAttributes(semconv.DBSystemPostgreSQL))
+		defer span.End()
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = runTx(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt >= TxSettings.MaxRetries {
+			// rollbacks aren't errors by themselves, e.g. import dry runs
+			span.SetAttributes(
+				attribute.Int("db.transaction.attempts", attempt+1),
+				attribute.Bool("db.transaction.committed", err == nil),
+			)
+			return err
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(TxSettings.RetryBackoff * time.Duration(1<<attempt)):
+		}
+	}
+}
+
+func runTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := DB.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	var hooks []func()
+	ctx = context.WithValue(ctx, txKey{}, tx)
+	ctx = context.WithValue(ctx, afterCommitKey{}, &hooks)
+	if err := fn(ctx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+type afterCommitKey struct{}
+
+// Runs fn once the transaction ctx belongs to is committed, or right away outside of
+// a transaction. Nothing runs when it is rolled back, and only the attempt that
+// committed counts when it is retried.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*[]func())
+	if !ok {
+		fn()
+		return
+	}
+	*hooks = append(*hooks, fn)
+}
+
+// serialization_failure and deadlock_detected are safe to retry from scratch
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// unique_violation, e.g. from main.item's unique name index
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Deliveries are queued by a trigger on main.auditEvent, see postgresql/8_webhook_up.sql
+
+var AddWebhook = func(ctx context.Context, webhook Webhook) error {
+	ctx, cancel := withTimeout(ctx, "AddWebhook")
+	defer cancel()
+
+	query := `INSERT INTO main.webhook(id, userId, todoListId, url, secret, eventTypes) VALUES($1,$2,$3,$4,$5,$6);`
+	_, err := writer(ctx).ExecContext(ctx, query, webhook.Id, webhook.UserId, webhook.TodoListId, webhook.Url, webhook.Secret, pq.Array(webhook.EventTypes))
+	if err != nil {
+		return queryErr(ctx, "AddWebhook", err)
+	}
+
+	return nil
+}
+
+// Lists the active webhooks of a list, oldest first
+var ListWebhooks = func(ctx context.Context, todoListId uuid.UUID) ([]Webhook, error) {
+	ctx, cancel := withTimeout(ctx, "ListWebhooks")
+	defer cancel()
+
+	query := `SELECT id, userId, todoListId, url, secret, eventTypes, active, createdOn, updatedOn FROM main.webhook WHERE todoListId=$1 AND active ORDER BY createdOn, id`
+	rows, err := reader(ctx).QueryContext(ctx, query, todoListId)
+	if err != nil {
+		return nil, queryErr(ctx, "ListWebhooks", err)
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		err = rows.Scan(
+			&webhook.Id,
+			&webhook.UserId,
+			&webhook.TodoListId,
+			&webhook.Url,
+			&webhook.Secret,
+			pq.Array(&webhook.EventTypes),
+			&webhook.Active,
+			&webhook.CreatedOn,
+			&webhook.UpdatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListWebhooks", err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, queryErr(ctx, "ListWebhooks", rows.Err())
+}
+
+// Returns a webhook of the list, including deactivated ones
+var GetWebhook = func(ctx context.Context, todoListId uuid.UUID, webhookId uuid.UUID) (Webhook, error) {
+	ctx, cancel := withTimeout(ctx, "GetWebhook")
+	defer cancel()
+
+	query := `SELECT id, userId, todoListId, url, secret, eventTypes, active, createdOn, updatedOn FROM main.webhook WHERE todoListId=$1 AND id=$2`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, webhookId)
+
+	var webhook Webhook
+	err := row.Scan(
+		&webhook.Id,
+		&webhook.UserId,
+		&webhook.TodoListId,
+		&webhook.Url,
+		&webhook.Secret,
+		pq.Array(&webhook.EventTypes),
+		&webhook.Active,
+		&webhook.CreatedOn,
+		&webhook.UpdatedOn,
+	)
+	if err != nil {
+		return Webhook{}, queryErr(ctx, "GetWebhook", err)
+	}
+
+	return webhook, nil
+}
+
+// Stops a webhook and cancels its pending deliveries
+var DeactivateWebhook = func(ctx context.Context, webhookId uuid.UUID) error {
+	ctx, cancel := withTimeout(ctx, "DeactivateWebhook")
+	defer cancel()
+
+	return WithTx(ctx, func(ctx context.Context) error {
+		query := `UPDATE main.webhook SET active=false, updatedOn=$1 WHERE id=$2`
+		if _, err := writer(ctx).ExecContext(ctx, query, time.Now(), webhookId); err != nil {
+			return queryErr(ctx, "DeactivateWebhook", err)
+		}
+
+		query = `UPDATE main.webhookDelivery SET status=$1 WHERE webhookId=$2 AND status=$3`
+		if _, err := writer(ctx).ExecContext(ctx, query, WebhookDeliveryCancelled, webhookId, WebhookDeliveryPending); err != nil {
+			return queryErr(ctx, "DeactivateWebhook", err)
+		}
+		return nil
+	})
+}
+
+const webhookDeliveryColumns = `d.id, d.webhookId, d.eventId, d.eventType, d.payload, d.status, d.attempts, d.nextAttemptOn, d.deliveredOn, d.createdOn`
+
+func scanWebhookDelivery(scan func(dest ...any) error, extra ...any) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var deliveredOn sql.NullTime
+	err := scan(append([]any{
+		&delivery.Id,
+		&delivery.WebhookId,
+		&delivery.EventId,
+		&delivery.EventType,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptOn,
+		&deliveredOn,
+		&delivery.CreatedOn,
+	}, extra...)...)
+	delivery.DeliveredOn = deliveredOn.Time
+	return delivery, err
+}
+
+// Lists up to limit deliveries of a webhook, newest first
+var ListWebhookDeliveries = func(ctx context.Context, webhookId uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, "ListWebhookDeliveries")
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM main.webhookDelivery d WHERE d.webhookId=$1 ORDER BY d.createdOn DESC, d.id LIMIT $2`
+	rows, err := reader(ctx).QueryContext(ctx, query, webhookId, limit)
+	if err != nil {
+		return nil, queryErr(ctx, "ListWebhookDeliveries", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows.Scan)
+		if err != nil {
+			return nil, queryErr(ctx, "ListWebhookDeliveries", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, queryErr(ctx, "ListWebhookDeliveries", rows.Err())
+}
+
+// Returns a delivery of one of the list's webhooks
+var GetWebhookDelivery = func(ctx context.Context, todoListId uuid.UUID, deliveryId uuid.UUID) (WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, "GetWebhookDelivery")
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM main.webhookDelivery d JOIN main.webhook w ON w.id=d.webhookId WHERE w.todoListId=$1 AND d.id=$2`
+	row := reader(ctx).QueryRowContext(ctx, query, todoListId, deliveryId)
+
+	delivery, err := scanWebhookDelivery(row.Scan)
+	if err != nil {
+		return WebhookDelivery{}, queryErr(ctx, "GetWebhookDelivery", err)
+	}
+
+	return delivery, nil
+}
+
+// Returns the attempts made for the given deliveries, in order, keyed by delivery id
+var ListWebhookAttempts = func(ctx context.Context, deliveryIds []uuid.UUID) (map[uuid.UUID][]WebhookAttempt, error) {
+	ctx, cancel := withTimeout(ctx, "ListWebhookAttempts")
+	defer cancel()
+
+	ids := make([]string, len(deliveryIds))
+	for i, id := range deliveryIds {
+		ids[i] = id.String()
+	}
+
+	query := `SELECT deliveryId, attempt, statusCode, error, durationMs, createdOn FROM main.webhookAttempt WHERE deliveryId=ANY($1) ORDER BY deliveryId, attempt, id`
+	rows, err := reader(ctx).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, queryErr(ctx, "ListWebhookAttempts", err)
+	}
+	defer rows.Close()
+
+	attempts := map[uuid.UUID][]WebhookAttempt{}
+	for rows.Next() {
+		var attempt WebhookAttempt
+		var durationMs int64
+		err = rows.Scan(
+			&attempt.DeliveryId,
+			&attempt.Attempt,
+			&attempt.StatusCode,
+			&attempt.Error,
+			&durationMs,
+			&attempt.CreatedOn,
+		)
+		if err != nil {
+			return nil, queryErr(ctx, "ListWebhookAttempts", err)
+		}
+		attempt.Duration = time.Duration(durationMs) * time.Millisecond
+
+		attempts[attempt.DeliveryId] = append(attempts[attempt.DeliveryId], attempt)
+	}
+
+	return attempts, queryErr(ctx, "ListWebhookAttempts", rows.Err())
+}
+
+// Queues a delivery again with a fresh set of attempts, the attempt log is kept
+var RequeueWebhookDelivery = func(ctx context.Context, deliveryId uuid.UUID) error {
+	ctx, cancel := withTimeout(ctx, "RequeueWebhookDelivery")
+	defer cancel()
+
+	query := `UPDATE main.webhookDelivery SET status=$1, attempts=0, nextAttemptOn=$2, deliveredOn=NULL WHERE id=$3`
+	_, err := writer(ctx).ExecContext(ctx, query, WebhookDeliveryPending, time.Now(), deliveryId)
+	if err != nil {
+		return queryErr(ctx, "RequeueWebhookDelivery", err)
+	}
+
+	return nil
+}
+
+// Takes up to limit pending deliveries that are due, together with their webhook's url
+// and secret. Claimed deliveries aren't due again for lease, so several server instances
+// can work the queue without sending the same delivery twice at once.
+var ClaimWebhookDeliveries = func(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, "ClaimWebhookDeliveries")
+	defer cancel()
+
+	now := time.Now()
+	query := `UPDATE main.webhookDelivery d SET nextAttemptOn=$1
+		FROM main.webhook w
+		WHERE w.id=d.webhookId AND d.id IN (
+			SELECT q.id FROM main.webhookDelivery q JOIN main.webhook qw ON qw.id=q.webhookId
+			WHERE q.status=$2 AND q.nextAttemptOn<=$3 AND qw.active
+			ORDER BY q.nextAttemptOn LIMIT $4
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns + `, w.url, w.secret`
+	rows, err := writer(ctx).QueryContext(ctx, query, now.Add(lease), WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, queryErr(ctx, "ClaimWebhookDeliveries", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanWebhookDelivery(rows.Scan, &url, &secret)
+		if err != nil {
+			return nil, queryErr(ctx, "ClaimWebhookDeliveries", err)
+		}
+		delivery.Url = url
+		delivery.Secret = secret
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, queryErr(ctx, "ClaimWebhookDeliveries", rows.Err())
+}
+
+// Logs an attempt and moves the delivery to status, the next attempt is due at
+// nextAttemptOn while the delivery stays pending
+var RecordWebhookAttempt = func(ctx context.Context, attempt WebhookAttempt, status string, nextAttemptOn time.Time) error {
+	ctx, cancel := withTimeout(ctx, "RecordWebhookAttempt")
+	defer cancel()
+
+	return WithTx(ctx, func(ctx context.Context) error {
+		query := `INSERT INTO main.webhookAttempt(deliveryId, attempt, statusCode, error, durationMs) VALUES($1,$2,$3,$4,$5);`
+		_, err := writer(ctx).ExecContext(ctx, query, attempt.DeliveryId, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.Duration.Milliseconds())
+		if err != nil {
+			return queryErr(ctx, "RecordWebhookAttempt", err)
+		}
+
+		query = `UPDATE main.webhookDelivery SET status=$1, attempts=$2, nextAttemptOn=$3,
+			deliveredOn=CASE WHEN $1=$4 THEN current_timestamp END WHERE id=$5`
+		_, err = writer(ctx).ExecContext(ctx, query, status, attempt.Attempt, nextAttemptOn, WebhookDeliverySucceeded, attempt.DeliveryId)
+		if err != nil {
+			return queryErr(ctx, "RecordWebhookAttempt", err)
+		}
+		return nil
+	})
+}
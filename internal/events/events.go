@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+	health "todo/internal/health"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Channel the main.item trigger notifies on, see postgresql/7_item_event_up.sql
+const Channel = "item_events"
+
+// Subscribers are also woken up this often, in case a notification was lost
+const ResyncInterval = 30 * time.Second
+
+type notification struct {
+	Seq        int64  `json:"seq"`
+	TodoListId string `json:"todoListId"`
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = map[uuid.UUID]map[chan struct{}]struct{}{}
+)
+
+// Returns a channel that receives a signal whenever new events may be available for the
+// list. Signals are coalesced, so the subscriber should read everything after its cursor
+// when woken up. Call the returned func to unsubscribe.
+func Subscribe(todoListId uuid.UUID) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	mu.Lock()
+	if subscribers[todoListId] == nil {
+		subscribers[todoListId] = map[chan struct{}]struct{}{}
+	}
+	subscribers[todoListId][wake] = struct{}{}
+	mu.Unlock()
+
+	return wake, func() {
+		mu.Lock()
+		delete(subscribers[todoListId], wake)
+		if len(subscribers[todoListId]) == 0 {
+			delete(subscribers, todoListId)
+		}
+		mu.Unlock()
+	}
+}
+
+// Listens for item change notifications from postgres until ctx is done, waking up the
+// subscribers of the changed list. Every server instance listens, so watchers are woken
+// up whichever instance made the change. The returned channel is closed once the
+// listener is closed.
+func Start(ctx context.Context, dsn string) (<-chan struct{}, error) {
+	// watchers still see changes within ResyncInterval while disconnected
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("item events listener failed", "error", err)
+		}
+		switch event {
+		case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+			health.SetOptional("item events", nil, "listening on "+Channel)
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			health.SetOptional("item events", err, "")
+		}
+	})
+	if err := listener.Listen(Channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer listener.Close()
+
+		ticker := time.NewTicker(ResyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				// nil after a reconnect, notifications may have been missed
+				if n == nil {
+					wakeAll()
+					continue
+				}
+
+				var payload notification
+				if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+					slog.Warn("item events listener received an invalid payload", "payload", n.Extra)
+					continue
+				}
+				todoListId, err := uuid.Parse(payload.TodoListId)
+				if err != nil {
+					continue
+				}
+				Publish(todoListId)
+			case <-ticker.C:
+				go listener.Ping()
+				wakeAll()
+			}
+		}
+	}()
+
+	return done, nil
+}
+
+// Wakes up the subscribers of a list
+func Publish(todoListId uuid.UUID) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for wake := range subscribers[todoListId] {
+		signal(wake)
+	}
+}
+
+func wakeAll() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, list := range subscribers {
+		for wake := range list {
+			signal(wake)
+		}
+	}
+}
+
+// non-blocking, a pending signal already covers this one
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
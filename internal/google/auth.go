@@ -2,9 +2,8 @@ package internal
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -51,7 +50,9 @@ func HandleMain(w http.ResponseWriter, r *http.Request) {
 func HandleGLogin(w http.ResponseWriter, r *http.Request, oauthConf *oauth2.Config, oauthStateString string) {
 	URL, err := url.Parse(oauthConf.Endpoint.AuthURL)
 	if err != nil {
-		log.Fatalln("Parse: " + err.Error())
+		slog.ErrorContext(r.Context(), "invalid google auth url", "error", err)
+		http.Error(w, "Google login is misconfigured", http.StatusInternalServerError)
+		return
 	}
 	// fmt.Println(URL.String())
 	parameters := url.Values{}
@@ -74,7 +75,7 @@ func CallBackFromGoogle(w http.ResponseWriter, r *http.Request) {
 	state := r.FormValue("state")
 	// fmt.Println(state)
 	if state != oauthStateStringGl {
-		fmt.Println("invalid oauth state, expected " + oauthStateStringGl + ", got " + state + "\n")
+		slog.WarnContext(r.Context(), "invalid oauth state", "state", state)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -92,15 +93,22 @@ func CallBackFromGoogle(w http.ResponseWriter, r *http.Request) {
 		// User has denied access..
 		// http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 	} else {
-		token, err := oauthConfGl.Exchange(oauth2.NoContext, code)
+		token, err := oauthConfGl.Exchange(r.Context(), code)
 		if err != nil {
-			log.Fatalln("oauthConfGl.Exchange() failed with " + err.Error() + "\n")
+			slog.ErrorContext(r.Context(), "oauth code exchange failed", "error", err)
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
 
-		resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + url.QueryEscape(token.AccessToken))
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + url.QueryEscape(token.AccessToken), nil)
 		if err != nil {
-			log.Fatalln("Get: " + err.Error() + "\n")
+			slog.ErrorContext(r.Context(), "google userinfo request failed", "error", err)
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "google userinfo request failed", "error", err)
 			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
@@ -108,18 +116,19 @@ func CallBackFromGoogle(w http.ResponseWriter, r *http.Request) {
 
 		response, err := io.ReadAll(resp.Body)
 		if err != nil {
-			log.Fatalln("ReadAll: " + err.Error() + "\n")
+			slog.ErrorContext(r.Context(), "reading google userinfo failed", "error", err)
 			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
 		
 		// fmt.Println("parseResponseBody: " + string(response) + "\n")
 		if err := json.Unmarshal(response, &UserDetails); err != nil {
-			log.Fatalln("Unmarshal: " + err.Error() + "\n")
+			slog.ErrorContext(r.Context(), "invalid google userinfo", "error", err)
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
 
-		fmt.Println("Logged in as " + UserDetails.Email)
+		slog.InfoContext(r.Context(), "logged in with google", "email", UserDetails.Email)
 		http.Redirect(w, r, "/auth/google/authenticated", http.StatusTemporaryRedirect)
 
 		// w.Write([]byte(string(response))) // this thing stores the login user details
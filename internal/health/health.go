@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Last reported state of a dependency the server needs to serve requests
+type Status struct {
+	Component string    `json:"component"`
+	Healthy   bool      `json:"healthy"`
+	Detail    string    `json:"detail,omitempty"`
+	CheckedOn time.Time `json:"checkedOn"`
+	// optional components are reported but don't make the server unready,
+	// e.g. a replica whose reads fall back to the primary
+	Optional bool `json:"optional,omitempty"`
+}
+
+var (
+	mu         sync.RWMutex
+	components = map[string]Status{}
+
+	// the readiness gate, closed until startup is done and again during shutdown
+	serving       bool
+	servingReason = "starting"
+
+	// serializes listener calls so they see changes in order
+	notifyMu  sync.Mutex
+	listeners []func(serving bool)
+	lastReady bool
+)
+
+// Records the outcome of a component's latest check, err == nil means healthy
+func Set(component string, err error, detail string) {
+	set(component, err, detail, false)
+}
+
+// Same as Set, for components that don't affect readiness
+func SetOptional(component string, err error, detail string) {
+	set(component, err, detail, true)
+}
+
+func set(component string, err error, detail string, optional bool) {
+	status := Status{
+		Component: component,
+		Healthy:   err == nil,
+		Detail:    detail,
+		CheckedOn: time.Now(),
+		Optional:  optional,
+	}
+	if err != nil {
+		status.Detail = err.Error()
+	}
+
+	mu.Lock()
+	components[component] = status
+	mu.Unlock()
+
+	notify()
+}
+
+// Opens or closes the readiness gate. Requests are still served while it is closed,
+// only probes report the server as not ready so it gets no new traffic.
+func SetServing(open bool, reason string) {
+	mu.Lock()
+	serving = open
+	servingReason = reason
+	mu.Unlock()
+
+	notify()
+}
+
+// Reports whether every required component is healthy
+func Ready() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return ready()
+}
+
+func ready() bool {
+	for _, status := range components {
+		if !status.Healthy && !status.Optional {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the server should receive traffic: the readiness gate is open and
+// every required component is healthy. When it shouldn't, reason tells why.
+func Serving() (ok bool, reason string) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if !serving {
+		return false, servingReason
+	}
+	if !ready() {
+		return false, "a required component is unhealthy"
+	}
+	return true, ""
+}
+
+// Calls fn with the result of Serving whenever it changes, and once right away
+func OnChange(fn func(serving bool)) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	mu.Lock()
+	listeners = append(listeners, fn)
+	current := lastReady
+	mu.Unlock()
+
+	fn(current)
+}
+
+func notify() {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	mu.Lock()
+	current := serving && ready()
+	changed := current != lastReady
+	lastReady = current
+	fns := listeners
+	mu.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, fn := range fns {
+		fn(current)
+	}
+}
+
+// Returns the state of all components, sorted by name
+func Snapshot() []Status {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	statuses := make([]Status, 0, len(components))
+	for _, status := range components {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Component < statuses[j].Component })
+	return statuses
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func reset() {
+	mu.Lock()
+	components = map[string]Status{}
+	serving, servingReason = false, "starting"
+	listeners, lastReady = nil, false
+	mu.Unlock()
+}
+
+func Test_Serving(t *testing.T) {
+	reset()
+	defer reset()
+
+	var changes []bool
+	OnChange(func(serving bool) {
+		changes = append(changes, serving)
+	})
+
+	testCases := []struct {
+		testName       string
+		apply          func()
+		expectedReady  bool
+		expectedServed bool
+		expectedReason string
+	}{
+		{
+			testName:       "Starting",
+			apply:          func() { Set("database", nil, "") },
+			expectedReady:  true,
+			expectedReason: "starting",
+		},
+		{
+			testName:       "Started",
+			apply:          func() { SetServing(true, "") },
+			expectedReady:  true,
+			expectedServed: true,
+		},
+		{
+			testName:       "Optional component down",
+			apply:          func() { SetOptional("replica db2:5432", errors.New("connection refused"), "") },
+			expectedReady:  true,
+			expectedServed: true,
+		},
+		{
+			testName:       "Required component down",
+			apply:          func() { Set("database", errors.New("connection refused"), "") },
+			expectedReason: "a required component is unhealthy",
+		},
+		{
+			testName:       "Required component back",
+			apply:          func() { Set("database", nil, "") },
+			expectedReady:  true,
+			expectedServed: true,
+		},
+		{
+			testName:       "Shutting down",
+			apply:          func() { SetServing(false, "shutting down") },
+			expectedReady:  true,
+			expectedReason: "shutting down",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			tc.apply()
+
+			if Ready() != tc.expectedReady {
+				tt.Errorf("Ready() failed, got %v, want %v", Ready(), tc.expectedReady)
+			}
+			served, reason := Serving()
+			if served != tc.expectedServed || reason != tc.expectedReason {
+				tt.Errorf("Serving() failed, got %v %q, want %v %q", served, reason, tc.expectedServed, tc.expectedReason)
+			}
+		})
+	}
+
+	// only changes are reported, after the initial state
+	expected := []bool{false, true, false, true, false}
+	if len(changes) != len(expected) {
+		t.Fatalf("OnChange() failed, got %v, want %v", changes, expected)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("OnChange() failed, got %v, want %v", changes, expected)
+		}
+	}
+}
+
+func Test_Handlers(t *testing.T) {
+	reset()
+	defer reset()
+
+	Set("database", errors.New("connection refused"), "")
+	Set("migrations", nil, "version 11")
+	SetServing(true, "")
+
+	testCases := []struct {
+		testName       string
+		handler        http.Handler
+		expectedCode   int
+		expectedStatus string
+	}{
+		{
+			testName:       "Alive while a dependency is down",
+			handler:        LivenessHandler(),
+			expectedCode:   http.StatusOK,
+			expectedStatus: "ok",
+		},
+		{
+			testName:       "Not ready while a dependency is down",
+			handler:        ReadinessHandler(),
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: "unavailable",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tc.expectedCode {
+				tt.Errorf("%s failed, got code %d, want %d", tc.testName, rec.Code, tc.expectedCode)
+			}
+
+			var body report
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				tt.Fatalf("%s failed, invalid body %s", tc.testName, rec.Body.String())
+			}
+			if body.Status != tc.expectedStatus {
+				tt.Errorf("%s failed, got status %q, want %q", tc.testName, body.Status, tc.expectedStatus)
+			}
+			if len(body.Components) != 2 || body.Components[0].Component != "database" || body.Components[0].Detail != "connection refused" {
+				tt.Errorf("%s failed, got components %+v", tc.testName, body.Components)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	healthgrpc "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Body of /healthz and /readyz
+type report struct {
+	Status     string   `json:"status"`
+	Reason     string   `json:"reason,omitempty"`
+	Components []Status `json:"components"`
+}
+
+// Answers liveness probes (/healthz). The server is alive as long as it answers, so
+// orchestrators don't restart it for a dependency that is down; components are
+// still reported for humans.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, report{Status: "ok", Components: Snapshot()})
+	})
+}
+
+// Answers readiness probes (/readyz) with 503 Service Unavailable while the server
+// shouldn't receive traffic, see Serving
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, reason := Serving()
+		if !ok {
+			writeReport(w, http.StatusServiceUnavailable, report{Status: "unavailable", Reason: reason, Components: Snapshot()})
+			return
+		}
+		writeReport(w, http.StatusOK, report{Status: "ok", Components: Snapshot()})
+	})
+}
+
+func writeReport(w http.ResponseWriter, code int, body report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Registers the standard grpc.health.v1 service on s. The server ("") and each of
+// services report SERVING exactly when Serving does.
+func RegisterGRPC(s *grpc.Server, services ...string) {
+	server := healthgrpc.NewServer()
+	healthpb.RegisterHealthServer(s, server)
+
+	OnChange(func(serving bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if serving {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		server.SetServingStatus("", status)
+		for _, service := range services {
+			server.SetServingStatus(service, status)
+		}
+	})
+}
+
+// Reports whether method belongs to the grpc.health.v1 service, which must answer
+// even while the server isn't ready
+func IsHealthMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,389 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Content type of iCalendar files
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+	// content lines are folded after this many octets
+	maxLineLength = 75
+)
+
+// A VTODO component (RFC 5545 section 3.6.2), limited to the properties a todo item has.
+// Zero values are left out when writing.
+type Todo struct {
+	UID          string
+	Summary      string
+	Description  string
+	Completed    bool
+	Due          *time.Time
+	Priority     int
+	Categories   []string
+	Created      time.Time
+	LastModified time.Time
+	// set when reading, the properties whose value could not be read
+	Errors []*PropertyError
+}
+
+// A property of a VTODO with an invalid value, the rest of the VTODO is still read
+type PropertyError struct {
+	Property string
+	Message  string
+}
+
+func (e *PropertyError) Error() string {
+	return e.Property + ": " + e.Message
+}
+
+// Writes a VCALENDAR holding the todos, name is shown by calendar apps for the feed
+func Marshal(name string, todos []Todo) []byte {
+	var buf bytes.Buffer
+	writeLine(&buf, "BEGIN", "VCALENDAR")
+	writeLine(&buf, "VERSION", "2.0")
+	writeLine(&buf, "PRODID", "-//todo//todo//EN")
+	writeLine(&buf, "CALSCALE", "GREGORIAN")
+	if name != "" {
+		writeLine(&buf, "X-WR-CALNAME", escapeText(name))
+	}
+
+	for _, todo := range todos {
+		writeTodo(&buf, todo)
+	}
+
+	writeLine(&buf, "END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+func writeTodo(buf *bytes.Buffer, todo Todo) {
+	// DTSTAMP is required, the last change is the closest thing a feed has
+	stamp := todo.LastModified
+	if stamp.IsZero() {
+		stamp = todo.Created
+	}
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	writeLine(buf, "BEGIN", "VTODO")
+	writeLine(buf, "UID", todo.UID)
+	writeLine(buf, "DTSTAMP", formatTime(stamp))
+	if !todo.Created.IsZero() {
+		writeLine(buf, "CREATED", formatTime(todo.Created))
+	}
+	if !todo.LastModified.IsZero() {
+		writeLine(buf, "LAST-MODIFIED", formatTime(todo.LastModified))
+	}
+	writeLine(buf, "SUMMARY", escapeText(todo.Summary))
+	if todo.Description != "" {
+		writeLine(buf, "DESCRIPTION", escapeText(todo.Description))
+	}
+	if todo.Completed {
+		writeLine(buf, "STATUS", "COMPLETED")
+		writeLine(buf, "COMPLETED", formatTime(stamp))
+	} else {
+		writeLine(buf, "STATUS", "NEEDS-ACTION")
+	}
+	if todo.Due != nil {
+		writeLine(buf, "DUE", formatTime(*todo.Due))
+	}
+	if todo.Priority > 0 {
+		writeLine(buf, "PRIORITY", strconv.Itoa(todo.Priority))
+	}
+	if len(todo.Categories) > 0 {
+		categories := make([]string, len(todo.Categories))
+		for i, category := range todo.Categories {
+			categories[i] = escapeText(category)
+		}
+		writeLine(buf, "CATEGORIES", strings.Join(categories, ","))
+	}
+	writeLine(buf, "END", "VTODO")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout) + "Z"
+}
+
+// Writes a content line, folded so no line is longer than 75 octets
+func writeLine(buf *bytes.Buffer, name string, value string) {
+	line := name + ":" + value
+
+	// continuation lines start with a space, which counts towards their length
+	limit := maxLineLength
+	for len(line) > limit {
+		// never split a character
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = maxLineLength - 1
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+func unescapeText(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// Splits a list of TEXT values on the commas that are not escaped
+func splitText(value string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescapeText(value[start:]))
+}
+
+// One unfolded content line
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Splits "NAME;PARAM=value;PARAM="quoted":value"
+func parseLine(line string) (contentLine, error) {
+	var l contentLine
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return l, errors.New("invalid content line " + line)
+	}
+	l.name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return l, errors.New("invalid parameter in " + l.name)
+		}
+		key := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return l, errors.New("unterminated parameter in " + l.name)
+			}
+			value = line[1 : end+1]
+			line = line[end+2:]
+		} else {
+			end := strings.IndexAny(line, ";:")
+			if end < 0 {
+				return l, errors.New("invalid content line " + l.name)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+		if l.params == nil {
+			l.params = map[string]string{}
+		}
+		l.params[key] = value
+
+		i = 0
+		if line == "" {
+			return l, errors.New("missing value in " + l.name)
+		}
+	}
+
+	if line[i] != ':' {
+		return l, errors.New("invalid content line " + l.name)
+	}
+	l.value = line[i+1:]
+	return l, nil
+}
+
+// Reads the VTODOs of an iCalendar file, other components are skipped. Invalid property
+// values are reported on the todo, the file only fails when it is malformed.
+func Parse(content string) ([]Todo, error) {
+	var todos []Todo
+	var todo *Todo
+	// components opened inside the current VTODO, e.g. a VALARM
+	nested := 0
+	calendars := 0
+
+	lines, err := unfold(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		l, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case l.name == "BEGIN" && strings.EqualFold(l.value, "VCALENDAR"):
+			calendars++
+		case l.name == "BEGIN" && strings.EqualFold(l.value, "VTODO") && todo == nil:
+			if calendars == 0 {
+				return nil, errors.New("VTODO outside of a VCALENDAR")
+			}
+			todo = &Todo{}
+		case l.name == "BEGIN" && todo != nil:
+			nested++
+		case l.name == "END" && todo != nil && nested > 0:
+			nested--
+		case l.name == "END" && todo != nil:
+			if !strings.EqualFold(l.value, "VTODO") {
+				return nil, errors.New("unexpected END:" + l.value + " in VTODO")
+			}
+			todos = append(todos, *todo)
+			todo = nil
+		case todo != nil && nested == 0:
+			readProperty(todo, l)
+		}
+	}
+	if todo != nil {
+		return nil, errors.New("missing END:VTODO")
+	}
+	if calendars == 0 {
+		return nil, errors.New("missing BEGIN:VCALENDAR")
+	}
+
+	return todos, nil
+}
+
+// Joins folded lines, a line starting with a space or tab continues the previous one
+func unfold(content string) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(content, "\ufeff")))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("invalid iCalendar: " + err.Error())
+	}
+
+	return lines, nil
+}
+
+func readProperty(todo *Todo, l contentLine) {
+	fail := func(message string) {
+		todo.Errors = append(todo.Errors, &PropertyError{Property: l.name, Message: message})
+	}
+
+	switch l.name {
+	case "UID":
+		todo.UID = l.value
+	case "SUMMARY":
+		todo.Summary = unescapeText(l.value)
+	case "DESCRIPTION":
+		todo.Description = unescapeText(l.value)
+	case "STATUS":
+		todo.Completed = strings.EqualFold(l.value, "COMPLETED")
+	case "COMPLETED":
+		todo.Completed = true
+	case "PRIORITY":
+		priority, err := strconv.Atoi(l.value)
+		if err != nil || priority < 0 || priority > 9 {
+			fail("invalid priority " + l.value + ", expecting 0 to 9")
+			return
+		}
+		todo.Priority = priority
+	case "CATEGORIES":
+		for _, category := range splitText(l.value) {
+			if category = strings.TrimSpace(category); category != "" {
+				todo.Categories = append(todo.Categories, category)
+			}
+		}
+	case "DUE":
+		due, err := parseTime(l)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		todo.Due = &due
+	case "CREATED":
+		if created, err := parseTime(l); err == nil {
+			todo.Created = created
+		}
+	case "LAST-MODIFIED":
+		if modified, err := parseTime(l); err == nil {
+			todo.LastModified = modified
+		}
+	}
+}
+
+// Reads a DATE or DATE-TIME value. Dates are midnight UTC and floating times, which have
+// neither a Z nor a TZID, are taken as UTC.
+func parseTime(l contentLine) (time.Time, error) {
+	if strings.EqualFold(l.params["VALUE"], "DATE") || len(l.value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, l.value)
+		if err != nil {
+			return time.Time{}, errors.New("invalid date " + l.value)
+		}
+		return t, nil
+	}
+
+	if value, ok := strings.CutSuffix(l.value, "Z"); ok {
+		t, err := time.Parse(dateTimeLayout, value)
+		if err != nil {
+			return time.Time{}, errors.New("invalid date-time " + l.value)
+		}
+		return t, nil
+	}
+
+	location := time.UTC
+	if tzid := l.params["TZID"]; tzid != "" {
+		var err error
+		if location, err = time.LoadLocation(strings.TrimPrefix(tzid, "/")); err != nil {
+			return time.Time{}, errors.New("unknown time zone " + tzid)
+		}
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, l.value, location)
+	if err != nil {
+		return time.Time{}, errors.New("invalid date-time " + l.value)
+	}
+	return t, nil
+}
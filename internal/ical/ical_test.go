@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Marshal(t *testing.T) {
+	due := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	todo := Todo{
+		UID:          "item1",
+		Summary:      "call mom; dad, too",
+		Description:  strings.Repeat("long description ", 10) + "\nsecond line",
+		Completed:    true,
+		Due:          &due,
+		Priority:     1,
+		Categories:   []string{"family", "a,b"},
+		Created:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastModified: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	out := string(Marshal("Todo list", []Todo{todo}))
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("Marshal failed, line longer than %d octets: %q", maxLineLength, line)
+		}
+	}
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"SUMMARY:call mom\\; dad\\, too\r\n",
+		"STATUS:COMPLETED\r\nCOMPLETED:20240102T000000Z\r\n",
+		"DUE:20240201T090000Z\r\n",
+		"PRIORITY:1\r\n",
+		"CATEGORIES:family,a\\,b\r\n",
+		"END:VTODO\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Marshal failed, missing %q in %q", expected, out)
+		}
+	}
+
+	// what is written reads back the same
+	todos, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse failed, not expecting err: %v", err)
+	}
+	if len(todos) != 1 {
+		t.Fatalf("Parse failed, got %d todos, want 1", len(todos))
+	}
+	got := todos[0]
+	if got.Summary != todo.Summary || got.Description != todo.Description || !got.Completed || got.Priority != 1 ||
+		!got.Due.Equal(due) || strings.Join(got.Categories, "|") != "family|a,b" || len(got.Errors) > 0 {
+		t.Errorf("Parse failed, got %+v, want %+v", got, todo)
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	testCases := []struct {
+		testName       string
+		content        string
+		expectedDue    []time.Time
+		expectedErrors []string
+		wantErr        bool
+	}{
+		{
+			testName: "Dates, time zones and nested components",
+			content: "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\nDUE;VALUE=DATE:20240301\nEND:VTODO\n" +
+				"BEGIN:VTODO\nSUMMARY:b\nDUE;TZID=America/New_York:20240301T090000\n" +
+				"BEGIN:VALARM\nSUMMARY:ignored\nEND:VALARM\nEND:VTODO\nBEGIN:VEVENT\nSUMMARY:c\nEND:VEVENT\nEND:VCALENDAR\n",
+			expectedDue: []time.Time{
+				time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 1, 9, 0, 0, 0, newYork),
+			},
+			expectedErrors: []string{"", ""},
+		},
+		{
+			testName:       "Invalid values are reported",
+			content:        "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\nPRIORITY:high\nDUE:soon\nEND:VTODO\nEND:VCALENDAR\n",
+			expectedDue:    []time.Time{{}},
+			expectedErrors: []string{"PRIORITY: invalid priority high, expecting 0 to 9,DUE: invalid date-time soon"},
+		},
+		{
+			testName: "Missing END:VTODO",
+			content:  "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\nEND:VCALENDAR\n",
+			wantErr:  true,
+		},
+		{
+			testName: "Not iCalendar",
+			content:  "name,description\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			todos, err := Parse(tc.content)
+			if tc.wantErr {
+				if err == nil {
+					tt.Errorf("Parse failed, expecting an error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Parse failed, not expecting err: %v", err)
+			}
+			if len(todos) != len(tc.expectedDue) {
+				tt.Fatalf("Parse failed, got %d todos, want %d", len(todos), len(tc.expectedDue))
+			}
+
+			for i, todo := range todos {
+				var errs []string
+				for _, err := range todo.Errors {
+					errs = append(errs, err.Error())
+				}
+				if strings.Join(errs, ",") != tc.expectedErrors[i] {
+					tt.Errorf("Parse failed, got errors %v, want %s", errs, tc.expectedErrors[i])
+				}
+				if !tc.expectedDue[i].IsZero() && (todo.Due == nil || !todo.Due.Equal(tc.expectedDue[i])) {
+					tt.Errorf("Parse failed, got due %v, want %v", todo.Due, tc.expectedDue[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	ratelimit "todo/internal/ratelimit"
+	requestid "todo/internal/requestid"
+	pb "todo/proto/todo"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Settings shared by the SSE and WebSocket endpoints
+type Config struct {
+	// how often an idle connection is pinged so proxies keep it open
+	Heartbeat time.Duration
+	// events buffered per client, a client that falls further behind is disconnected
+	// and expected to reconnect with its last cursor
+	BufferSize int
+	// how long a single write to a client may take
+	WriteTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	Heartbeat:    15 * time.Second,
+	BufferSize:   64,
+	WriteTimeout: 10 * time.Second,
+}
+
+var errSlowClient = errors.New("client is too slow, reconnect with the last cursor")
+
+var marshaler = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// An established WatchTodos call, its events are buffered in events until the client
+// takes them. err is set once events is closed.
+type watch struct {
+	events chan *pb.TodoEvent
+	err    error
+}
+
+// Opens WatchTodos through the gRPC server, so the caller is authenticated exactly like
+// the REST routes. Errors that happen before the watch is established are returned as is.
+func startWatch(ctx context.Context, client pb.TodoClient, r *http.Request, bufferSize int) (*watch, error) {
+	// same metadata the gateway forwards for the REST routes
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+	}
+	if id := r.Header.Get(requestid.MetadataKey); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id)
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		cursor = id
+	}
+
+	stream, err := client.WatchTodos(ctx, &pb.WatchTodosRequest{Cursor: cursor})
+	if err != nil {
+		return nil, err
+	}
+
+	// the server sends headers once the watch is established
+	md, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		// ended without headers, the error comes with the trailer
+		if _, err := stream.Recv(); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, errors.New("watch ended unexpectedly")
+	}
+
+	w := &watch{events: make(chan *pb.TodoEvent, bufferSize)}
+	go func() {
+		defer close(w.events)
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				w.err = err
+				return
+			}
+
+			select {
+			case w.events <- event:
+			default:
+				w.err = errSlowClient
+				return
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Answers a failed watch with the same HTTP status the gateway would use
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	body, _ := marshaler.Marshal(st.Proto())
+
+	ratelimit.SetRetryAfter(w.Header(), st)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	w.Write(body)
+}
@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	pb "todo/proto/todo"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Serves WatchTodos from a stubStream, the other methods are not used
+type stubClient struct {
+	pb.TodoClient
+	stream *stubStream
+	// cursor of the last WatchTodos call
+	cursor string
+}
+
+func (c *stubClient) WatchTodos(ctx context.Context, in *pb.WatchTodosRequest, opts ...grpc.CallOption) (pb.Todo_WatchTodosClient, error) {
+	c.cursor = in.Cursor
+	return c.stream, nil
+}
+
+// Sends events until it is closed, then fails with err. A nil header ends the watch
+// before it is established, like a call the server refused.
+type stubStream struct {
+	grpc.ClientStream
+	header metadata.MD
+	events chan *pb.TodoEvent
+	err    error
+}
+
+func newStubStream(err error, events ...*pb.TodoEvent) *stubStream {
+	s := &stubStream{header: metadata.MD{}, events: make(chan *pb.TodoEvent, len(events)), err: err}
+	for _, event := range events {
+		s.events <- event
+	}
+	return s
+}
+
+func (s *stubStream) Header() (metadata.MD, error) {
+	return s.header, nil
+}
+
+func (s *stubStream) Recv() (*pb.TodoEvent, error) {
+	event, ok := <-s.events
+	if !ok {
+		return nil, s.err
+	}
+	return event, nil
+}
+
+var testConfig = Config{
+	Heartbeat:    time.Hour,
+	BufferSize:   8,
+	WriteTimeout: time.Second,
+}
+
+func Test_invalidCursor(t *testing.T) {
+	invalid := status.Error(codes.InvalidArgument, "invalid cursor")
+
+	handlers := map[string]func(pb.TodoClient, Config) http.Handler{
+		"SSE":       SSEHandler,
+		"WebSocket": WebSocketHandler,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(tt *testing.T) {
+			stream := newStubStream(invalid)
+			stream.header = nil
+			close(stream.events)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/todo/events?cursor=bad", nil)
+			handler(&stubClient{stream: stream}, testConfig).ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				tt.Errorf("%s failed, got status %d, want %d", name, w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), "invalid cursor") {
+				tt.Errorf("%s failed, got body %q", name, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_SSEHandler(t *testing.T) {
+	event := &pb.TodoEvent{Cursor: "42", Type: pb.TodoEventType_TODO_EVENT_TYPE_CREATED}
+	stream := newStubStream(io.EOF, event)
+	close(stream.events)
+	client := &stubClient{stream: stream}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/todo/events?cursor=1", nil)
+	r.Header.Set("Last-Event-ID", "41")
+	SSEHandler(client, testConfig).ServeHTTP(w, r)
+
+	if client.cursor != "41" {
+		t.Errorf("SSEHandler failed, resumed from cursor %q, want the Last-Event-ID %q", client.cursor, "41")
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("SSEHandler failed, got status %d and content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "id: 42\nevent: TODO_EVENT_TYPE_CREATED\n") {
+		t.Errorf("SSEHandler failed, the event id is not its cursor, got %q", body)
+	}
+}
+
+func Test_SSEHandler_heartbeat(t *testing.T) {
+	stream := newStubStream(io.EOF)
+	config := testConfig
+	config.Heartbeat = 5 * time.Millisecond
+
+	// the watch stays idle for a few heartbeats
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(stream.events)
+	}()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/todo/events", nil)
+	SSEHandler(&stubClient{stream: stream}, config).ServeHTTP(w, r)
+
+	if body := w.Body.String(); !strings.Contains(body, ": heartbeat\n\n") {
+		t.Errorf("SSEHandler failed, no heartbeat in %q", body)
+	}
+}
+
+func Test_startWatch_slowClient(t *testing.T) {
+	stream := newStubStream(io.EOF, &pb.TodoEvent{Cursor: "1"}, &pb.TodoEvent{Cursor: "2"})
+
+	// nobody takes the events, the second one doesn't fit
+	r := httptest.NewRequest(http.MethodGet, "/v1/todo/events", nil)
+	watch, err := startWatch(context.Background(), &stubClient{stream: stream}, r, 1)
+	if err != nil {
+		t.Fatalf("startWatch failed, not expecting err: %v", err)
+	}
+
+	// let the watch take both events before anything is read
+	for deadline := time.Now().Add(time.Second); len(stream.events) > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var received int
+	for range watch.events {
+		received++
+	}
+	if received != 1 || watch.err != errSlowClient {
+		t.Errorf("startWatch failed, got %d events and err %v, want 1 event and %v", received, watch.err, errSlowClient)
+	}
+}
+
+func Test_WebSocketHandler(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		inErr          error
+		expectedCode   int
+		expectedReason string
+	}{
+		{
+			testName:       "Slow client",
+			inErr:          errSlowClient,
+			expectedCode:   websocket.CloseTryAgainLater,
+			expectedReason: errSlowClient.Error(),
+		},
+		{
+			testName:       "Long error",
+			inErr:          status.Error(codes.Internal, strings.Repeat("é", 100)),
+			expectedCode:   websocket.CloseInternalServerErr,
+			expectedReason: strings.Repeat("é", 61),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			event := &pb.TodoEvent{Cursor: "42", Type: pb.TodoEventType_TODO_EVENT_TYPE_CREATED}
+			stream := newStubStream(tc.inErr, event)
+			close(stream.events)
+
+			server := httptest.NewServer(WebSocketHandler(&stubClient{stream: stream}, testConfig))
+			defer server.Close()
+
+			ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			defer ws.Close()
+
+			_, body, err := ws.ReadMessage()
+			if err != nil || !strings.Contains(string(body), `"cursor":"42"`) {
+				tt.Fatalf("WebSocketHandler failed, got message %q and err %v", body, err)
+			}
+
+			_, _, err = ws.ReadMessage()
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				tt.Fatalf("WebSocketHandler failed, expecting a close frame, got %v", err)
+			}
+			if closeErr.Code != tc.expectedCode || closeErr.Text != tc.expectedReason {
+				tt.Errorf("WebSocketHandler failed, got close %d %q, want %d %q", closeErr.Code, closeErr.Text, tc.expectedCode, tc.expectedReason)
+			}
+		})
+	}
+}
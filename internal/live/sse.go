@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	pb "todo/proto/todo"
+)
+
+// Serves WatchTodos as Server-Sent Events. Each event's id is its cursor, so browsers
+// resume automatically through the Last-Event-ID header after reconnecting.
+func SSEHandler(client pb.TodoClient, config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		watch, err := startWatch(ctx, client, r, config.BufferSize)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(format string, args ...any) error {
+			rc.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		// tell the browser how soon to reconnect
+		if err := write("retry: %d\n\n", time.Second.Milliseconds()); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(config.Heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				if err := write(": heartbeat\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-watch.events:
+				if !ok {
+					write("event: error\ndata: %q\n\n", watch.err.Error())
+					return
+				}
+
+				body, err := marshaler.Marshal(event)
+				if err != nil {
+					return
+				}
+				if err := write("id: %s\nevent: %s\ndata: %s\n\n", event.Cursor, event.Type, body); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	pb "todo/proto/todo"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/status"
+)
+
+// A close frame is a control frame of at most 125 bytes, 2 of them for the code
+const maxCloseReason = 123
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Serves WatchTodos over a WebSocket, one JSON text message per event. Clients resume
+// with ?cursor= set to the last cursor they received.
+func WebSocketHandler(client pb.TodoClient, config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// authenticate before upgrading, so failures get a regular HTTP answer
+		watch, err := startWatch(ctx, client, r, config.BufferSize)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		// the client is considered gone when it misses two heartbeats
+		pongWait := 2 * config.Heartbeat
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(pongWait))
+		})
+
+		// reads are only needed to process pongs and close frames
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := ws.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		heartbeat := time.NewTicker(config.Heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.WriteTimeout)); err != nil {
+					return
+				}
+			case event, ok := <-watch.events:
+				if !ok {
+					message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, closeReason(watch.err))
+					if watch.err != errSlowClient {
+						message = websocket.FormatCloseMessage(websocket.CloseInternalServerErr, closeReason(watch.err))
+					}
+					ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(config.WriteTimeout))
+					return
+				}
+
+				body, err := marshaler.Marshal(event)
+				if err != nil {
+					return
+				}
+				ws.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+				if err := ws.WriteMessage(websocket.TextMessage, body); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// The message of err, cut to fit a close frame. A longer frame is refused by the
+// library, and the client would see an abnormal close instead of the code.
+func closeReason(err error) string {
+	reason := status.Convert(err).Message()
+	if len(reason) > maxCloseReason {
+		// a rune cut in half is dropped
+		reason = strings.ToValidUTF8(reason[:maxCloseReason], "")
+	}
+	return reason
+}
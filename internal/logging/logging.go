@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	requestid "todo/internal/requestid"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log line formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Settings of Setup, read from the log section of config.yaml
+type Config struct {
+	// debug, info, warn or error
+	Level string
+	// FormatText or FormatJSON
+	Format string
+	// log the file and line of each call
+	AddSource bool
+	// log every request of the gRPC, gateway and frontend servers
+	AccessLog bool
+}
+
+var DefaultConfig = Config{
+	Level:     "info",
+	Format:    FormatText,
+	AccessLog: true,
+}
+
+// Whether Setup enabled access logs
+var accessLog = DefaultConfig.AccessLog
+
+// Makes slog log to w as configured, for slog and the standard log package alike.
+// Lines logged with a request's context carry its request_id and trace_id.
+func Setup(w io.Writer, config Config) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return errors.New("unknown log level " + config.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, AddSource: config.AddSource}
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return errors.New("unknown log format " + config.Format)
+	}
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	accessLog = config.AccessLog
+	return nil
+}
+
+// Logs msg as an error and exits with status 1, for failures the server can't start with
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Adds the request id and trace id of the context a line is logged with
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestId := requestid.FromContext(ctx); requestId != "" {
+		r.AddAttrs(slog.String("request_id", requestId))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
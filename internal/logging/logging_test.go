@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	requestid "todo/internal/requestid"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Logs JSON lines to the returned buffer until the test ends
+func setupTest(t *testing.T) *bytes.Buffer {
+	// preserve original logger
+	oriLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(oriLogger)
+		accessLog = DefaultConfig.AccessLog
+	})
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, Config{Level: "info", Format: FormatJSON, AccessLog: true}); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+func Test_Setup(t *testing.T) {
+	testCases := []struct {
+		testName string
+		config   Config
+		wantErr  bool
+	}{
+		{
+			testName: "Default",
+			config:   DefaultConfig,
+		},
+		{
+			testName: "JSON",
+			config:   Config{Level: "debug", Format: FormatJSON},
+		},
+		{
+			testName: "Fail - unknown level",
+			config:   Config{Level: "verbose"},
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - unknown format",
+			config:   Config{Level: "info", Format: "xml"},
+			wantErr:  true,
+		},
+	}
+
+	oriLogger := slog.Default()
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			err := Setup(&bytes.Buffer{}, tc.config)
+			if (err != nil) != tc.wantErr {
+				tt.Errorf("Setup() failed, got error %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	// reset
+	slog.SetDefault(oriLogger)
+	accessLog = DefaultConfig.AccessLog
+}
+
+func Test_RequestId(t *testing.T) {
+	buf := setupTest(t)
+
+	slog.InfoContext(requestid.NewContext(context.Background(), "abc"), "in a request")
+	slog.Info("outside of a request")
+
+	got := lines(t, buf)
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2", len(got))
+	}
+	if got[0]["request_id"] != "abc" {
+		t.Errorf("got request_id %v, want abc", got[0]["request_id"])
+	}
+	if _, ok := got[1]["request_id"]; ok {
+		t.Errorf("got request_id %v outside of a request, want none", got[1]["request_id"])
+	}
+}
+
+func Test_AccessLog(t *testing.T) {
+	buf := setupTest(t)
+
+	handler := requestid.Middleware(AccessLog("test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "handling")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/todo", nil)
+	req.Header.Set("X-Request-Id", "from-client")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-Id"); got != "from-client" {
+		t.Errorf("got X-Request-Id %q, want from-client", got)
+	}
+
+	got := lines(t, buf)
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2", len(got))
+	}
+	for _, line := range got {
+		if line["request_id"] != "from-client" {
+			t.Errorf("%v failed, got request_id %v, want from-client", line["msg"], line["request_id"])
+		}
+	}
+	access := got[1]
+	if access["msg"] != "http request" || access["server"] != "test" || access["status"] != float64(http.StatusCreated) || access["bytes"] != float64(len("created")) {
+		t.Errorf("got access log %v", access)
+	}
+}
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.Todo/AddTodo"}
+
+	testCases := []struct {
+		testName      string
+		err           error
+		expectedCode  string
+		expectedLevel string
+	}{
+		{
+			testName:      "Success",
+			expectedCode:  "OK",
+			expectedLevel: "INFO",
+		},
+		{
+			testName:      "Client error",
+			err:           status.Error(codes.NotFound, "item do not exist"),
+			expectedCode:  "NotFound",
+			expectedLevel: "INFO",
+		},
+		{
+			testName:      "Server error",
+			err:           errors.New("connection refused"),
+			expectedCode:  "Unknown",
+			expectedLevel: "WARN",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			buf := setupTest(tt)
+
+			ctx := requestid.NewContext(context.Background(), "abc")
+			UnaryServerInterceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				return nil, tc.err
+			})
+
+			got := lines(tt, buf)
+			if len(got) != 1 {
+				tt.Fatalf("got %d lines, want 1", len(got))
+			}
+			line := got[0]
+			if line["code"] != tc.expectedCode || line["level"] != tc.expectedLevel || line["request_id"] != "abc" {
+				tt.Errorf("%s failed, got %v", tc.testName, line)
+			}
+		})
+	}
+}
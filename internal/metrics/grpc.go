@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "RPCs started on the server.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+
+	grpcHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by status code.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time RPCs took until they completed on the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+)
+
+// Counts and times unary calls by method and status code. It should run before the
+// interceptors that reject calls, so rejected calls are counted too.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	service, method := splitMethod(info.FullMethod)
+	start := time.Now()
+	grpcStarted.WithLabelValues("unary", service, method).Inc()
+
+	resp, err := handler(ctx, req)
+
+	grpcHandled.WithLabelValues("unary", service, method, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues("unary", service, method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// Streaming version of UnaryServerInterceptor
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	kind := streamType(info)
+	service, method := splitMethod(info.FullMethod)
+	start := time.Now()
+	grpcStarted.WithLabelValues(kind, service, method).Inc()
+
+	err := handler(srv, ss)
+
+	grpcHandled.WithLabelValues(kind, service, method, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues(kind, service, method).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Splits "/pb.Todo/AddTodo" into "pb.Todo" and "AddTodo"
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+	return service, method
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	}
+	return "server_stream"
+}
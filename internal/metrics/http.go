@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	httpInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served, including open SSE and WebSocket connections.",
+	}, []string{"server"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route and status code.",
+	}, []string{"server", "route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time HTTP requests took until the response was written.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"server", "route", "method"})
+)
+
+type routeKey struct{}
+
+// Counts and times the requests of mux. Requests are labelled with the pattern they
+// matched in mux, or the path pattern of the gateway route when GatewayRoute is
+// registered on the gateway, so paths with ids or tokens don't add labels.
+func Instrument(server string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		route := &pattern
+
+		inFlight := httpInFlight.WithLabelValues(server)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		mux.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+
+		code := rec.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		httpRequests.WithLabelValues(server, *route, r.Method, strconv.Itoa(code)).Inc()
+		httpDuration.WithLabelValues(server, *route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Labels gateway requests with their route, e.g. "/v1/todo/calendar/{token}".
+// Register it with runtime.WithMetadata, it adds no metadata.
+func GatewayRoute(ctx context.Context, r *http.Request) metadata.MD {
+	if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = pattern
+		}
+	}
+	return nil
+}
+
+// Remembers the status code, while keeping streaming and WebSocket upgrades working
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// used by http.ResponseController, e.g. to flush SSE events
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// gorilla/websocket hijacks the connection without http.ResponseController
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	w.code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
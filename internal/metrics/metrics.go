@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Holds every metric of the server, served by Handler
+var Registry = prometheus.NewRegistry()
+
+// Users that made a call within this window count as active, see SeenUser
+var ActiveUserWindow = 15 * time.Minute
+
+var (
+	itemChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "todo_item_changes_total",
+		Help: "Committed item changes, by change: created, completed, reopened, updated, deleted, reverted or undone.",
+	}, []string{"change"})
+
+	usersProvisioned = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "todo_users_provisioned_total",
+		Help: "Users created on their first login.",
+	})
+
+	activeUsers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "todo_active_users",
+		Help: "Users that made a call to this instance within the active user window.",
+	}, countActiveUsers)
+
+	// last call per user, pruned when counted
+	seenMu sync.Mutex
+	seen   = map[string]time.Time{}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		itemChanges,
+		usersProvisioned,
+		activeUsers,
+		grpcStarted,
+		grpcHandled,
+		grpcDuration,
+		httpInFlight,
+		httpRequests,
+		httpDuration,
+	)
+}
+
+// Serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Exposes the connection pool stats of db as go_sql_* metrics labelled db_name=name
+func RegisterDB(name string, db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Counts an item change, call it once the change is committed
+func ItemChanged(change string) {
+	itemChanges.WithLabelValues(change).Inc()
+}
+
+// Counts a user created on their first login, call it once the user is committed
+func UserProvisioned() {
+	usersProvisioned.Inc()
+}
+
+// Records that a user made a call, for todo_active_users
+func SeenUser(email string) {
+	if email == "" {
+		return
+	}
+
+	seenMu.Lock()
+	seen[email] = time.Now()
+	seenMu.Unlock()
+}
+
+func countActiveUsers() float64 {
+	since := time.Now().Add(-ActiveUserWindow)
+
+	seenMu.Lock()
+	defer seenMu.Unlock()
+
+	for email, last := range seen {
+		if last.Before(since) {
+			delete(seen, email)
+		}
+	}
+	return float64(len(seen))
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Instrument(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/todo/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// what the gateway does for its routes
+		route := r.Context().Value(routeKey{}).(*string)
+		*route = "/v1/todo/calendar/{token}"
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Instrument("test", mux)
+
+	testCases := []struct {
+		testName      string
+		path          string
+		expectedRoute string
+		expectedCode  string
+	}{
+		{
+			testName:      "Mux pattern",
+			path:          "/v1/todo/export?format=csv",
+			expectedRoute: "/v1/todo/export",
+			expectedCode:  "200",
+		},
+		{
+			testName:      "Gateway route",
+			path:          "/v1/todo/calendar/secret.ics",
+			expectedRoute: "/v1/todo/calendar/{token}",
+			expectedCode:  "404",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			got := testutil.ToFloat64(httpRequests.WithLabelValues("test", tc.expectedRoute, http.MethodGet, tc.expectedCode))
+			if got != 1 {
+				tt.Errorf("%s failed, got %v requests for %s, want 1", tc.testName, got, tc.expectedRoute)
+			}
+		})
+	}
+}
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.Todo/AddTodo"}
+
+	testCases := []struct {
+		testName     string
+		err          error
+		expectedCode string
+	}{
+		{
+			testName:     "Success",
+			expectedCode: "OK",
+		},
+		{
+			testName:     "Status error",
+			err:          status.Error(codes.NotFound, "item do not exist"),
+			expectedCode: "NotFound",
+		},
+		{
+			testName:     "Plain error",
+			err:          errors.New("missing name"),
+			expectedCode: "Unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			UnaryServerInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+				return nil, tc.err
+			})
+
+			got := testutil.ToFloat64(grpcHandled.WithLabelValues("unary", "pb.Todo", "AddTodo", tc.expectedCode))
+			if got != 1 {
+				tt.Errorf("%s failed, got %v calls with code %s, want 1", tc.testName, got, tc.expectedCode)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(grpcStarted.WithLabelValues("unary", "pb.Todo", "AddTodo")); got != 3 {
+		t.Errorf("grpc_server_started_total failed, got %v, want 3", got)
+	}
+}
+
+func Test_ActiveUsers(t *testing.T) {
+	SeenUser("a@email.com")
+	SeenUser("b@email.com")
+	SeenUser("a@email.com")
+	SeenUser("")
+
+	// a call outside the window
+	seenMu.Lock()
+	seen["c@email.com"] = time.Now().Add(-2 * ActiveUserWindow)
+	seenMu.Unlock()
+
+	if got := testutil.ToFloat64(activeUsers); got != 2 {
+		t.Errorf("todo_active_users failed, got %v, want 2", got)
+	}
+}
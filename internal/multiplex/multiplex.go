@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// Serves gRPC calls and HTTP requests on a single listener. gRPC calls, HTTP/2 requests
+// with a gRPC content type, go to the gRPC server and everything else to next.
+type Handler struct {
+	grpcServer *grpc.Server
+	next       http.Handler
+
+	mu       sync.Mutex
+	stopping bool
+	calls    sync.WaitGroup
+}
+
+func NewHandler(grpcServer *grpc.Server, next http.Handler) *Handler {
+	return &Handler{grpcServer: grpcServer, next: next}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !IsGRPC(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	if h.stopping {
+		h.mu.Unlock()
+		// refused or cancelled by the stopped gRPC server
+		h.grpcServer.ServeHTTP(w, r)
+		return
+	}
+	h.calls.Add(1)
+	h.mu.Unlock()
+	defer h.calls.Done()
+
+	h.grpcServer.ServeHTTP(w, r)
+}
+
+// Waits for the running gRPC calls, then stops the gRPC server. Calls still running when
+// ctx is done are cancelled. grpc.Server.GracefulStop doesn't support calls served
+// through ServeHTTP, this replaces it.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.stopping = true
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.calls.Wait()
+		close(done)
+	}()
+
+	defer h.grpcServer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// Serves HTTP/2 next to HTTP/1 on server: negotiated with ALPN when server has a TLS
+// configuration, otherwise in cleartext (h2c), which gRPC clients use without TLS.
+// HTTP/2 connections are sent a GOAWAY when server is shut down.
+func EnableHTTP2(server *http.Server) error {
+	cleartext := server.TLSConfig == nil
+
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return err
+	}
+	if cleartext {
+		// ConfigureServer always adds a TLS configuration
+		server.TLSConfig = nil
+		server.Handler = h2c.NewHandler(server.Handler, h2s)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_Handler(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	handler := NewHandler(grpcServer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "http")
+	}))
+	server := &http.Server{Handler: handler}
+	if err := EnableHTTP2(server); err != nil {
+		t.Fatal(err)
+	}
+	if server.TLSConfig != nil {
+		t.Fatal("EnableHTTP2() failed, added a TLS configuration")
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// gRPC over h2c
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Handler failed, gRPC call got error %v", err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Handler failed, gRPC call got status %v", res.Status)
+	}
+
+	// HTTP/1
+	httpRes, err := http.Get("http://" + lis.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(httpRes.Body)
+	httpRes.Body.Close()
+	if string(body) != "http" {
+		t.Errorf("Handler failed, HTTP request got %q", body)
+	}
+
+	// the gRPC connection is idle, shutdown doesn't wait
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() failed, got error %v", err)
+	}
+	if err := handler.Shutdown(ctx); err != nil {
+		t.Errorf("Handler.Shutdown() failed, got error %v", err)
+	}
+}
+
+func Test_IsGRPC(t *testing.T) {
+	testCases := []struct {
+		testName    string
+		protoMajor  int
+		contentType string
+		expectedOut bool
+	}{
+		{
+			testName:    "gRPC",
+			protoMajor:  2,
+			contentType: "application/grpc",
+			expectedOut: true,
+		},
+		{
+			testName:    "gRPC with a codec",
+			protoMajor:  2,
+			contentType: "application/grpc+proto",
+			expectedOut: true,
+		},
+		{
+			testName:    "REST over HTTP/2",
+			protoMajor:  2,
+			contentType: "application/json",
+			expectedOut: false,
+		},
+		{
+			testName:    "HTTP/1",
+			protoMajor:  1,
+			contentType: "application/grpc",
+			expectedOut: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			r := &http.Request{ProtoMajor: tc.protoMajor, Header: http.Header{"Content-Type": {tc.contentType}}}
+			if got := IsGRPC(r); got != tc.expectedOut {
+				tt.Errorf("IsGRPC() failed, got %v, want %v", got, tc.expectedOut)
+			}
+		})
+	}
+}
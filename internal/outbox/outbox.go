@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+	data "todo/internal/data"
+	health "todo/internal/health"
+
+	"github.com/google/uuid"
+)
+
+// The message published to every sink. Id stays the same when an event is published
+// again after a failure, consumers use it to drop duplicates.
+type Event struct {
+	Id            string          `json:"id"`
+	Seq           int64           `json:"seq"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateId   string          `json:"aggregateId"`
+	TodoListId    string          `json:"todoListId,omitempty"`
+	RequestId     string          `json:"requestId,omitempty"`
+	OccurredOn    time.Time       `json:"occurredOn"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Somewhere events are published to. Publish must only return nil once the event is
+// safely handed over, it is called again with the same event otherwise.
+type Sink interface {
+	// identifies the sink in main.outboxPublication, keep it stable across restarts
+	Name() string
+	Publish(ctx context.Context, event Event) error
+}
+
+// Settings of the relay, overridden from config.yaml at startup
+type Config struct {
+	// how often the outbox is checked for unpublished events
+	PollInterval time.Duration
+	// events relayed per poll
+	BatchSize int
+	// how long a claimed batch is kept from other relays
+	Lease time.Duration
+	// delay before retrying an event, doubled for every further attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultConfig = Config{
+	PollInterval: time.Second,
+	BatchSize:    100,
+	Lease:        time.Minute,
+	Backoff:      time.Second,
+	MaxBackoff:   5 * time.Minute,
+}
+
+// Relays outbox events to the sinks until ctx is done. Events that didn't reach every
+// sink are retried with backoff, only for the sinks that failed.
+// The returned channel is closed once the relay stopped.
+func Start(ctx context.Context, config Config, sinks []Sink) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// keep going while the outbox is full
+			for {
+				n, err := relay(ctx, config, sinks)
+				if ctx.Err() == nil {
+					if err != nil {
+						slog.Error("outbox relay failed", "error", err)
+					}
+					health.SetOptional("outbox", err, "")
+				}
+				if err != nil || n < config.BatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// Claims and publishes one batch of events, returns how many were claimed
+func relay(ctx context.Context, config Config, sinks []Sink) (int, error) {
+	events, err := data.ClaimOutboxEvents(ctx, config.BatchSize, config.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := publish(ctx, config, sinks, event); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// Publishes an event to the sinks it hasn't reached yet
+func publish(ctx context.Context, config Config, sinks []Sink, event data.OutboxEvent) error {
+	published := map[string]bool{}
+	for _, sink := range event.Published {
+		published[sink] = true
+	}
+
+	message := toEvent(event)
+	failed := false
+	for _, sink := range sinks {
+		if published[sink.Name()] {
+			continue
+		}
+
+		if err := sink.Publish(ctx, message); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("outbox relay failed to publish an event", "event", event.Id, "sink", sink.Name(), "error", err)
+			health.SetOptional("outbox sink "+sink.Name(), err, "")
+			failed = true
+			continue
+		}
+		health.SetOptional("outbox sink "+sink.Name(), nil, "")
+
+		if err := data.AddOutboxPublication(ctx, event.Id, sink.Name()); err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return data.RetryOutboxEvent(ctx, event.Id, time.Now().Add(backoff(config, event.Attempts+1)))
+	}
+	return data.CompleteOutboxEvent(ctx, event.Id)
+}
+
+// Delay before retrying after the given number of failed attempts
+func backoff(config Config, attempts int) time.Duration {
+	delay := config.Backoff
+	for i := 1; i < attempts && delay < config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > config.MaxBackoff {
+		delay = config.MaxBackoff
+	}
+	return delay
+}
+
+func toEvent(event data.OutboxEvent) Event {
+	res := Event{
+		Id:            event.Id.String(),
+		Seq:           event.Seq,
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateId:   event.AggregateId,
+		RequestId:     event.RequestId,
+		OccurredOn:    event.CreatedOn,
+		Data:          event.Payload,
+	}
+	if len(res.Data) == 0 {
+		res.Data = json.RawMessage("null")
+	}
+	if event.TodoListId != uuid.Nil {
+		res.TodoListId = event.TodoListId.String()
+	}
+	return res
+}
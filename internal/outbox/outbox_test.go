@@ -0,0 +1,270 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	data "todo/internal/data"
+	webhook "todo/internal/webhook"
+
+	"github.com/google/uuid"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+type testSink struct {
+	name      string
+	err       error
+	published []Event
+}
+
+func (s *testSink) Name() string {
+	return s.name
+}
+
+func (s *testSink) Publish(ctx context.Context, event Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func Test_relay(t *testing.T) {
+	config := Config{BatchSize: 10, Lease: time.Minute, Backoff: time.Second, MaxBackoff: time.Minute}
+	eventId := uuid.New()
+
+	testCases := []struct {
+		testName          string
+		published         []string
+		failing           string
+		expectedPublished map[string]int
+		expectedRetry     bool
+	}{
+		{
+			testName:          "Success - every sink",
+			expectedPublished: map[string]int{"a": 1, "b": 1},
+		},
+		{
+			testName:          "Failing sink is retried",
+			failing:           "b",
+			expectedPublished: map[string]int{"a": 1, "b": 0},
+			expectedRetry:     true,
+		},
+		{
+			testName:          "Success - retry skips sinks that have the event",
+			published:         []string{"a"},
+			expectedPublished: map[string]int{"a": 0, "b": 1},
+		},
+	}
+
+	// preserve original function
+	oriClaimOutboxEvents := data.ClaimOutboxEvents
+	oriAddOutboxPublication := data.AddOutboxPublication
+	oriCompleteOutboxEvent := data.CompleteOutboxEvent
+	oriRetryOutboxEvent := data.RetryOutboxEvent
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			data.ClaimOutboxEvents = func(ctx context.Context, limit int, lease time.Duration) ([]data.OutboxEvent, error) {
+				return []data.OutboxEvent{{
+					Id:          eventId,
+					Seq:         7,
+					Type:        "ItemAdded",
+					AggregateId: "item1",
+					Payload:     []byte(`{"item":{}}`),
+					Published:   tc.published,
+				}}, nil
+			}
+			recorded := map[string]bool{}
+			data.AddOutboxPublication = func(ctx context.Context, id uuid.UUID, sink string) error {
+				recorded[sink] = true
+				return nil
+			}
+			completed, retried := false, false
+			data.CompleteOutboxEvent = func(ctx context.Context, id uuid.UUID) error {
+				completed = true
+				return nil
+			}
+			data.RetryOutboxEvent = func(ctx context.Context, id uuid.UUID, nextAttemptOn time.Time) error {
+				retried = true
+				return nil
+			}
+
+			sinks := map[string]*testSink{"a": {name: "a"}, "b": {name: "b"}}
+			if tc.failing != "" {
+				sinks[tc.failing].err = errors.New("unavailable")
+			}
+
+			n, err := relay(context.Background(), config, []Sink{sinks["a"], sinks["b"]})
+			if err != nil || n != 1 {
+				tt.Fatalf("relay failed, got %d, err: %v", n, err)
+			}
+
+			for name, expected := range tc.expectedPublished {
+				if len(sinks[name].published) != expected || recorded[name] != (expected == 1) {
+					tt.Errorf("relay failed, sink %s got %d events, recorded %v", name, len(sinks[name].published), recorded[name])
+				}
+				if expected == 1 && sinks[name].published[0].Id != eventId.String() {
+					tt.Errorf("relay failed, sink %s got id %s, want %s", name, sinks[name].published[0].Id, eventId)
+				}
+			}
+			if retried != tc.expectedRetry || completed == tc.expectedRetry {
+				tt.Errorf("relay failed, retried: %v, completed: %v", retried, completed)
+			}
+		})
+	}
+
+	// reset
+	data.ClaimOutboxEvents = oriClaimOutboxEvents
+	data.AddOutboxPublication = oriAddOutboxPublication
+	data.CompleteOutboxEvent = oriCompleteOutboxEvent
+	data.RetryOutboxEvent = oriRetryOutboxEvent
+}
+
+func Test_WebhookSink(t *testing.T) {
+	var header http.Header
+	var body []byte
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	sink := &WebhookSink{Url: receiver.URL, Secret: "secret"}
+	event := Event{Id: uuid.NewString(), Type: "ItemMarked", Data: json.RawMessage(`{}`)}
+
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish failed, not expecting err: %v", err)
+	}
+	if header.Get("Idempotency-Key") != event.Id || header.Get(webhook.HeaderEvent) != "ItemMarked" {
+		t.Errorf("Publish failed, got headers %v", header)
+	}
+	if want := webhook.Sign("secret", header.Get(webhook.HeaderTimestamp), body); header.Get(webhook.HeaderSignature) != want {
+		t.Errorf("Publish failed, got signature %q, want %q", header.Get(webhook.HeaderSignature), want)
+	}
+
+	status = http.StatusBadGateway
+	if err := sink.Publish(context.Background(), event); err == nil {
+		t.Errorf("Publish failed, expecting an error for status %d", status)
+	}
+
+	// recorded in outboxPublication.sink, a varchar(64)
+	long := &WebhookSink{Url: "https://events.example.com/ingest/" + strings.Repeat("x", 100) + "?token=secret"}
+	if name := long.Name(); len(name) > 64 || strings.Contains(name, "secret") {
+		t.Errorf("Name failed, got %q", name)
+	}
+	if same := (&WebhookSink{Url: long.Url}); same.Name() != long.Name() || long.Name() == sink.Name() {
+		t.Errorf("Name failed, expecting a stable name per URL")
+	}
+}
+
+func Test_NATSSink(t *testing.T) {
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.Username = "outbox"
+	opts.Password = "secret"
+	server := natstest.RunServer(&opts)
+	defer server.Shutdown()
+
+	address := strings.TrimPrefix(server.ClientURL(), "nats://")
+	subscriber, err := nats.Connect("nats://outbox:secret@" + address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+	subscription, err := subscriber.SubscribeSync("todo.events.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber.Flush()
+
+	testCases := []struct {
+		testName string
+		url      string
+		wantErr  bool
+	}{
+		{
+			testName: "Success",
+			url:      "nats://outbox:secret@" + address,
+		},
+		{
+			testName: "Fail - wrong password",
+			url:      "nats://outbox:wrong@" + address,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			sink := &NATSSink{Url: tc.url, Subject: "todo.events", Timeout: time.Second}
+			defer sink.Close()
+
+			event := Event{Id: uuid.NewString(), Type: "ItemDeleted", Data: json.RawMessage(`{}`)}
+			err := sink.Publish(context.Background(), event)
+			if tc.wantErr {
+				if err == nil {
+					tt.Errorf("Publish failed, expecting an error")
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Publish failed, not expecting err: %v", err)
+			}
+
+			msg, err := subscription.NextMsg(time.Second)
+			if err != nil {
+				tt.Fatalf("Publish failed, nothing received: %v", err)
+			}
+			if msg.Subject != "todo.events.ItemDeleted" || msg.Header.Get(nats.MsgIdHdr) != event.Id {
+				tt.Errorf("Publish failed, got subject %q and headers %v", msg.Subject, msg.Header)
+			}
+			if !strings.Contains(string(msg.Data), `"type":"ItemDeleted"`) {
+				tt.Errorf("Publish failed, got %q", msg.Data)
+			}
+		})
+	}
+
+	// Close drains the connection, the next Publish connects again
+	sink := &NATSSink{Url: "nats://outbox:secret@" + address, Subject: "todo.events", Timeout: time.Second}
+	event := Event{Id: uuid.NewString(), Type: "ItemDeleted", Data: json.RawMessage(`{}`)}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish failed, not expecting err: %v", err)
+	}
+	conn := sink.conn
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close failed, not expecting err: %v", err)
+	}
+	if !conn.IsClosed() || sink.conn != nil {
+		t.Errorf("Close failed, the connection is still open")
+	}
+	for deadline := time.Now().Add(time.Second); server.NumClients() > 1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.NumClients(); n != 1 {
+		t.Errorf("Close failed, server still has %d clients, want 1", n)
+	}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Errorf("Publish after Close failed, not expecting err: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close failed, not expecting err: %v", err)
+	}
+
+	// recorded in outboxPublication.sink, another server must not inherit the publications
+	other := &NATSSink{Url: "nats://other:4222", Subject: sink.Subject}
+	if name := sink.Name(); len(name) > 64 || strings.Contains(name, "secret") {
+		t.Errorf("Name failed, got %q", name)
+	}
+	if same := (&NATSSink{Url: sink.Url, Subject: sink.Subject}); same.Name() != sink.Name() || other.Name() == sink.Name() {
+		t.Errorf("Name failed, expecting a stable name per URL and subject")
+	}
+}
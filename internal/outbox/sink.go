@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	webhook "todo/internal/webhook"
+)
+
+// Writes every event to the server log
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+func (LogSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	slog.Info("outbox event", "event", string(body))
+	return nil
+}
+
+// Names a sink after its destination. The name is recorded with every publication, and
+// shows in the health checks, so it's kept short and without the tokens a URL can carry.
+func sinkName(kind string, destination ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(destination, " ")))
+	return kind + ":" + hex.EncodeToString(hash[:8])
+}
+
+// POSTs every event as JSON to a fixed URL, signed like the webhooks users subscribe to.
+// The Idempotency-Key header carries the event id.
+type WebhookSink struct {
+	Url    string
+	Secret string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Name() string {
+	return sinkName("webhook", s.Url)
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.Id)
+	req.Header.Set(webhook.HeaderEvent, event.Type)
+	req.Header.Set(webhook.HeaderDelivery, event.Id)
+	req.Header.Set(webhook.HeaderTimestamp, timestamp)
+	if s.Secret != "" {
+		req.Header.Set(webhook.HeaderSignature, webhook.Sign(s.Secret, timestamp, body))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New("unexpected status " + res.Status)
+	}
+	return nil
+}
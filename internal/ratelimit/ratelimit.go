@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Token bucket given to each caller
+type Limit struct {
+	// tokens added per second, 0 for no limit
+	Rate float64
+	// most tokens a bucket holds, i.e. how many calls can be made at once
+	Burst int
+}
+
+// Settings of Configure, read from the rateLimit section of config.yaml
+type Config struct {
+	Default Limit
+	// overrides keyed by lower-cased RPC name e.g. "importtodos", or HTTP route e.g. "caldav"
+	Methods map[string]Limit
+	// buckets unused for this long are dropped, they are full again by then anyway
+	IdleTimeout time.Duration
+}
+
+var DefaultConfig = Config{
+	Default:     Limit{Rate: 10, Burst: 20},
+	Methods:     map[string]Limit{},
+	IdleTimeout: 10 * time.Minute,
+}
+
+type bucketKey struct {
+	method string
+	caller string
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+var (
+	mu sync.Mutex
+	// nil until Configure is called, every call is allowed
+	config    *Config
+	buckets   = map[bucketKey]*bucket{}
+	lastSweep time.Time
+)
+
+// Starts limiting calls as configured
+func Configure(c Config) {
+	methods := map[string]Limit{}
+	for method, limit := range c.Methods {
+		methods[strings.ToLower(method)] = limit
+	}
+	c.Methods = methods
+
+	mu.Lock()
+	defer mu.Unlock()
+	config = &c
+	buckets = map[bucketKey]*bucket{}
+}
+
+// Takes a token from the bucket of caller for method, which is a full gRPC method name
+// or an HTTP route. When the bucket is empty, returns false and how long until the next
+// token is added.
+func Allow(method string, caller string) (bool, time.Duration) {
+	method = strings.ToLower(path.Base(method))
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if config == nil {
+		return true, 0
+	}
+
+	limit, ok := config.Methods[method]
+	if !ok {
+		limit = config.Default
+	}
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	sweep(now)
+
+	key := bucketKey{method: method, caller: caller}
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), max(limit.Burst, 1))}
+		buckets[key] = b
+	}
+	b.lastUsed = now
+
+	reservation := b.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// Drops idle buckets, at most once per IdleTimeout. mu must be held.
+func sweep(now time.Time) {
+	if now.Sub(lastSweep) < config.IdleTimeout {
+		return
+	}
+	for key, b := range buckets {
+		if now.Sub(b.lastUsed) >= config.IdleTimeout {
+			delete(buckets, key)
+		}
+	}
+	lastSweep = now
+}
+
+// Builds the RESOURCE_EXHAUSTED error of a limited call. The RetryInfo detail lets the
+// HTTP bridges answer with a Retry-After header, see SetRetryAfter.
+func Error(retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "too many requests, retry in "+RetryAfter(retryAfter)+"s")
+	st, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "too many requests, retry in "+RetryAfter(retryAfter)+"s")
+	}
+	return st.Err()
+}
+
+// Formats a delay as the seconds of a Retry-After header, rounded up
+func RetryAfter(delay time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(delay.Seconds())))
+}
+
+// Sets the Retry-After header of the HTTP answer to a rate limited call, for the
+// HTTP bridges in front of the gRPC server
+func SetRetryAfter(header http.Header, st *status.Status) {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			header.Set("Retry-After", RetryAfter(info.RetryDelay.AsDuration()))
+		}
+	}
+}
+
+// Limits the requests of an HTTP route by client IP address, answering
+// 429 Too Many Requests with a Retry-After header.
+func Middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, delay := Allow(route, "ip:"+hostOf(r.RemoteAddr)); !ok {
+			w.Header().Set("Retry-After", RetryAfter(delay))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the IP address of the client of a gRPC call. Calls relayed by the HTTP
+// gateway on this host come from the address the gateway added to X-Forwarded-For.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	ip := hostOf(p.Addr.String())
+
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.IsLoopback() {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if fwd := md.Get("x-forwarded-for"); len(fwd) > 0 {
+				// the gateway appends the address it was called from
+				hops := strings.Split(fwd[len(fwd)-1], ",")
+				return strings.TrimSpace(hops[len(hops)-1])
+			}
+		}
+	}
+	return ip
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Allow(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		configured      bool
+		method          string
+		caller          string
+		calls           int
+		expectedAllowed int
+	}{
+		{
+			testName:        "Not configured",
+			method:          "/pb.Todo/ListTodo",
+			caller:          "user:a@email.com",
+			calls:           10,
+			expectedAllowed: 10,
+		},
+		{
+			testName:        "Default limit",
+			configured:      true,
+			method:          "/pb.Todo/ListTodo",
+			caller:          "user:a@email.com",
+			calls:           5,
+			expectedAllowed: 3,
+		},
+		{
+			testName:        "Another caller has its own bucket",
+			configured:      true,
+			method:          "/pb.Todo/ListTodo",
+			caller:          "user:b@email.com",
+			calls:           5,
+			expectedAllowed: 3,
+		},
+		{
+			testName:        "Method override",
+			configured:      true,
+			method:          "/pb.Todo/ImportTodos",
+			caller:          "user:a@email.com",
+			calls:           5,
+			expectedAllowed: 1,
+		},
+		{
+			testName:        "Unlimited method",
+			configured:      true,
+			method:          "/pb.Todo/Ping",
+			caller:          "user:a@email.com",
+			calls:           5,
+			expectedAllowed: 5,
+		},
+	}
+
+	// preserve original config
+	oriConfig := config
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			// buckets are kept from one configured case to the next
+			if !tc.configured {
+				config = nil
+			} else if config == nil {
+				Configure(Config{
+					Default: Limit{Rate: 0.001, Burst: 3},
+					Methods: map[string]Limit{
+						"ImportTodos": {Rate: 0.001, Burst: 1},
+						"ping":        {},
+					},
+					IdleTimeout: DefaultConfig.IdleTimeout,
+				})
+			}
+
+			allowed := 0
+			for i := 0; i < tc.calls; i++ {
+				ok, retryAfter := Allow(tc.method, tc.caller)
+				if ok {
+					allowed++
+				} else if retryAfter <= 0 {
+					tt.Errorf("Allow() failed, got retry after %v for a limited call", retryAfter)
+				}
+			}
+			if allowed != tc.expectedAllowed {
+				tt.Errorf("Allow() failed, got %d allowed calls, want %d", allowed, tc.expectedAllowed)
+			}
+		})
+	}
+
+	// reset
+	config = oriConfig
+}
+
+func Test_Error(t *testing.T) {
+	st := status.Convert(Error(1500 * time.Millisecond))
+	if st.Code() != codes.ResourceExhausted {
+		t.Errorf("Error() failed, got code %v", st.Code())
+	}
+
+	header := http.Header{}
+	SetRetryAfter(header, st)
+	if got := header.Get("Retry-After"); got != "2" {
+		t.Errorf("SetRetryAfter() failed, got Retry-After %q, want 2", got)
+	}
+	if _, ok := st.Details()[0].(*errdetails.RetryInfo); !ok {
+		t.Errorf("Error() failed, got details %v", st.Details())
+	}
+}
+
+func Test_Middleware(t *testing.T) {
+	// preserve original config
+	oriConfig := config
+	Configure(Config{Default: Limit{Rate: 0.001, Burst: 1}, IdleTimeout: DefaultConfig.IdleTimeout})
+
+	handler := Middleware("caldav", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	got := []int{}
+	for _, remote := range []string{"10.0.0.1:1234", "10.0.0.1:5678", "10.0.0.2:1234"} {
+		req := httptest.NewRequest(http.MethodGet, "/caldav/", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		got = append(got, rec.Code)
+
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("Middleware() failed, 429 without Retry-After")
+		}
+	}
+
+	expected := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Middleware() failed, got codes %v, want %v", got, expected)
+			break
+		}
+	}
+
+	// reset
+	config = oriConfig
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata key (and HTTP header) carrying the request id
+const MetadataKey = "x-request-id"
+
+type requestIdKey struct{}
+
+func NewContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// Returns the id of the request ctx belongs to, or "" outside of a request
+func FromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// Takes the request id from incoming metadata, or makes a new one, and echoes it back
+// in the response header
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	requestId := fromMetadata(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, requestId))
+	return handler(NewContext(ctx, requestId), req)
+}
+
+// Streaming version of UnaryServerInterceptor
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	requestId := fromMetadata(ss.Context())
+	ss.SetHeader(metadata.Pairs(MetadataKey, requestId))
+	return handler(srv, &serverStream{ServerStream: ss, ctx: NewContext(ss.Context(), requestId)})
+}
+
+// Takes the request id from the X-Request-Id header, or makes a new one, and echoes it
+// back. The header is set on the request too, so the gateway and the SSE, WebSocket and
+// upload bridges forward the same id to the gRPC server.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(MetadataKey)
+		if !valid(requestId) {
+			requestId = uuid.NewString()
+		}
+		r.Header.Set(MetadataKey, requestId)
+		w.Header().Set(MetadataKey, requestId)
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), requestId)))
+	})
+}
+
+// grpc.ServerStream with a replaced context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func fromMetadata(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(MetadataKey); len(ids) > 0 && valid(ids[0]) {
+			return ids[0]
+		}
+	}
+	return uuid.NewString()
+}
+
+// Ids sent by clients end up in logs and metadata, so they must be short and printable
+func valid(requestId string) bool {
+	if requestId == "" || len(requestId) > 64 {
+		return false
+	}
+	for i := 0; i < len(requestId); i++ {
+		if requestId[i] < 0x21 || requestId[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	certs "todo/internal/certs"
+	data "todo/internal/data"
+	g "todo/internal/google"
+	health "todo/internal/health"
+	metrics "todo/internal/metrics"
+	ratelimit "todo/internal/ratelimit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fails calls fast with codes.Unavailable while a dependency such as the database is down.
+// Health checks are let through, they report the outage themselves.
+func ReadinessInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !health.Ready() && !health.IsHealthMethod(info.FullMethod) {
+		return nil, status.Error(codes.Unavailable, "server is not ready, please retry later")
+	}
+	return handler(ctx, req)
+}
+
+// Streaming version of ReadinessInterceptor
+func ReadinessStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !health.Ready() && !health.IsHealthMethod(info.FullMethod) {
+		return status.Error(codes.Unavailable, "server is not ready, please retry later")
+	}
+	return handler(srv, ss)
+}
+
+// Calls authenticated by something else than the login, limited by client IP address
+var unauthenticatedMethods = map[string]bool{
+	"/pb.Todo/GetCalendarFeed": true,
+}
+
+// Fails calls with codes.ResourceExhausted once the caller used up its rate limit.
+// Callers are the logged in user, or the client IP address for unauthenticated calls.
+func RateLimitInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := rateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Streaming version of RateLimitInterceptor, a stream takes one token when it starts
+func RateLimitStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := rateLimit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func rateLimit(ctx context.Context, method string) error {
+	if health.IsHealthMethod(method) {
+		return nil
+	}
+
+	caller := "user:" + callerEmail(ctx)
+	if callerEmail(ctx) == "" || unauthenticatedMethods[method] {
+		caller = "ip:" + ratelimit.PeerIP(ctx)
+	}
+	if ok, retryAfter := ratelimit.Allow(method, caller); !ok {
+		return ratelimit.Error(retryAfter)
+	}
+	return nil
+}
+
+// Tags the call with the logged in user, so the data layer can route the user's reads
+// to the primary right after they wrote something
+func CallerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	metrics.SeenUser(callerEmail(ctx))
+	return handler(data.WithCaller(ctx, callerEmail(ctx)), req)
+}
+
+// Returns the email of the user making the call: the principal of a service calling
+// with a client certificate, otherwise the user logged in with Google
+func callerEmail(ctx context.Context) string {
+	if principal := certs.FromContext(ctx); principal != "" {
+		return principal
+	}
+	return g.UserDetails.Email
+}
+
+// Converts cancelled and timed out calls into their gRPC status codes.
+// Errors that already carry a status are passed through untouched.
+func ErrorInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatus(err)
+}
+
+// Streaming version of ErrorInterceptor
+func ErrorStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toStatus(handler(srv, ss))
+}
+
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return err
+}
@@ -3,76 +3,262 @@ package internal
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log/slog"
+	"strings"
 	b "todo/internal/business"
-	g "todo/internal/google"
 	pb "todo/proto/todo"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type TodoServer struct{
 	pb.UnimplementedTodoServer
-}
 
-var email string
+	// done when the server shuts down, ending the long lived WatchTodos streams
+	ctx context.Context
+}
 
 func NewTodoServer(ctx context.Context) pb.TodoServer {
-	return &TodoServer{}
+	return &TodoServer{ctx: ctx}
 }
 
 // Adds a new item into todolist
-func (s *TodoServer) AddTodo(ctx context.Context, in *pb.AddTodoRequest) (*pb.EmptyReply, error) {
-	if err := s.CheckLogin(ctx); err != nil {return nil, err}
+func (s *TodoServer) AddTodo(ctx context.Context, in *pb.AddTodoRequest) (*pb.TodoItem, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
 	return b.AddTodo(ctx, email, in)
 }
 
 // Soft deletes an item in the todolist
 func (s *TodoServer) DeleteTodo(ctx context.Context, in *pb.UpdateTodoRequest) (*pb.EmptyReply, error) {
-	if err := s.CheckLogin(ctx); err != nil {return nil, err}
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	if in.Etag == "" {
+		in.Etag = ifMatch(ctx)
+	}
 	return b.DeleteTodo(ctx, email, in)
 }
 
 // Lists all items of the todolist
 func (s *TodoServer) ListTodo(ctx context.Context, in *pb.EmptyRequest) (*pb.ListTodoReply, error) {
-	if err := s.CheckLogin(ctx); err != nil {return nil, err}
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
 	return b.ListTodo(ctx, email)
 }
 
 // Mark an item as true or completed
 func (s *TodoServer) MarkTodo(ctx context.Context, in *pb.UpdateTodoRequest) (*pb.EmptyReply, error) {
-	if err := s.CheckLogin(ctx); err != nil {return nil, err}
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	if in.Etag == "" {
+		in.Etag = ifMatch(ctx)
+	}
 	return b.MarkTodo(ctx, email, in)
 }
 
+// Lists the revisions of an item in the todolist
+func (s *TodoServer) ListTodoRevisions(ctx context.Context, in *pb.ListTodoRevisionsRequest) (*pb.ListTodoRevisionsReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ListTodoRevisions(ctx, email, in)
+}
+
+// Rolls an item in the todolist back to an earlier revision
+func (s *TodoServer) RevertTodo(ctx context.Context, in *pb.RevertTodoRequest) (*pb.TodoItem, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	if in.Etag == "" {
+		in.Etag = ifMatch(ctx)
+	}
+	return b.RevertTodo(ctx, email, in)
+}
+
+// Reverts the most recent changes to the todolist
+func (s *TodoServer) Undo(ctx context.Context, in *pb.UndoRequest) (*pb.UndoReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.Undo(ctx, email, in)
+}
+
+// Streams changes to the todolist
+func (s *TodoServer) WatchTodos(in *pb.WatchTodosRequest, stream pb.Todo_WatchTodosServer) error {
+	ctx := stream.Context()
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return err}
+	// headers tell the SSE and WebSocket bridges the watch is established, errors before
+	// them are answered with an HTTP status
+	start := func() error {
+		return stream.SendHeader(metadata.MD{})
+	}
+
+	// GracefulStop waits for streams, so watches end when the server shuts down
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+	err = b.WatchTodos(ctx, email, in, start, stream.Send)
+	if s.ctx.Err() != nil {
+		return status.Error(codes.Unavailable, "server is shutting down, please reconnect")
+	}
+	return err
+}
+
+// Returns the settings of the todolist
+func (s *TodoServer) GetListSettings(ctx context.Context, in *pb.EmptyRequest) (*pb.ListSettings, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.GetListSettings(ctx, email)
+}
+
+// Changes the settings of the todolist
+func (s *TodoServer) UpdateListSettings(ctx context.Context, in *pb.ListSettings) (*pb.ListSettings, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.UpdateListSettings(ctx, email, in)
+}
+
+// Lists the audit trail of the todolist
+func (s *TodoServer) ListAuditEvents(ctx context.Context, in *pb.ListAuditEventsRequest) (*pb.ListAuditEventsReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ListAuditEvents(ctx, email, in)
+}
+
+// Imports items from a CSV, JSON, todo.txt or iCalendar file
+func (s *TodoServer) ImportTodos(ctx context.Context, in *pb.ImportTodosRequest) (*pb.ImportTodosReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ImportTodos(ctx, email, in)
+}
+
+// Streams the items of the todolist as a CSV, JSON, Markdown or todo.txt file
+func (s *TodoServer) ExportTodos(in *pb.ExportTodosRequest, stream pb.Todo_ExportTodosServer) error {
+	ctx := stream.Context()
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return err}
+	start := func(filename string) error {
+		return stream.SendHeader(metadata.Pairs("content-disposition", `attachment; filename="`+filename+`"`))
+	}
+	return b.ExportTodos(ctx, email, in, start, stream.Send)
+}
+
+// Creates or replaces the iCalendar feed of the todolist
+func (s *TodoServer) CreateCalendarFeed(ctx context.Context, in *pb.EmptyRequest) (*pb.CalendarFeed, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.CreateCalendarFeed(ctx, email)
+}
+
+// Removes the iCalendar feed of the todolist
+func (s *TodoServer) DeleteCalendarFeed(ctx context.Context, in *pb.EmptyRequest) (*pb.EmptyReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.DeleteCalendarFeed(ctx, email)
+}
+
+// Serves an iCalendar feed, authenticated by the token in its URL instead of a login
+func (s *TodoServer) GetCalendarFeed(ctx context.Context, in *pb.GetCalendarFeedRequest) (*httpbody.HttpBody, error) {
+	return b.GetCalendarFeed(ctx, in)
+}
+
+// Creates a token apps can log in with, e.g. CalDAV clients
+func (s *TodoServer) CreateAppToken(ctx context.Context, in *pb.CreateAppTokenRequest) (*pb.AppToken, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.CreateAppToken(ctx, email, in)
+}
+
+// Lists the app tokens of the user
+func (s *TodoServer) ListAppTokens(ctx context.Context, in *pb.EmptyRequest) (*pb.ListAppTokensReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ListAppTokens(ctx, email)
+}
+
+// Revokes an app token
+func (s *TodoServer) DeleteAppToken(ctx context.Context, in *pb.DeleteAppTokenRequest) (*pb.EmptyReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.DeleteAppToken(ctx, email, in)
+}
+
+// Subscribes a URL to the changes of the todolist
+func (s *TodoServer) CreateWebhook(ctx context.Context, in *pb.CreateWebhookRequest) (*pb.Webhook, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.CreateWebhook(ctx, email, in)
+}
+
+// Lists the webhooks of the todolist
+func (s *TodoServer) ListWebhooks(ctx context.Context, in *pb.EmptyRequest) (*pb.ListWebhooksReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ListWebhooks(ctx, email)
+}
+
+// Stops calling a webhook
+func (s *TodoServer) DeleteWebhook(ctx context.Context, in *pb.DeleteWebhookRequest) (*pb.EmptyReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.DeleteWebhook(ctx, email, in)
+}
+
+// Lists the deliveries of a webhook with their attempts
+func (s *TodoServer) ListWebhookDeliveries(ctx context.Context, in *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesReply, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.ListWebhookDeliveries(ctx, email, in)
+}
+
+// Queues a webhook delivery again
+func (s *TodoServer) RedeliverWebhook(ctx context.Context, in *pb.RedeliverWebhookRequest) (*pb.WebhookDelivery, error) {
+	email, err := s.CheckLogin(ctx)
+	if err != nil {return nil, err}
+	return b.RedeliverWebhook(ctx, email, in)
+}
+
 // Pong!
 func (s *TodoServer) Ping(ctx context.Context, in *pb.EmptyRequest) (*pb.PingReply, error) {
-	if err := s.CheckLogin(ctx); err != nil {return nil, err}
+	if _, err := s.CheckLogin(ctx); err != nil {return nil, err}
 	return b.Ping(ctx, in)
 }
 
-// Checks if user is logged in using Gmail.
-// If user is a new user, then create a new user automatically.
-func (s *TodoServer) CheckLogin(ctx context.Context) error {
-	email = g.UserDetails.Email
+// Checks if user is logged in using Gmail, or calls with a client certificate mapped to a user.
+// If user is a new user, then create a new user automatically. Returns the email of the user.
+func (s *TodoServer) CheckLogin(ctx context.Context) (string, error) {
+	email := callerEmail(ctx)
 	// user is not logged in
 	if email == "" {
-		return errors.New("user not logged in. Please log in using http://localhost:8081")
+		return "", errors.New("user not logged in. Please log in using http://localhost:8081")
 	}
 
 	// user is logged in, check if new user
 	userExists, err :=  b.CheckUserExists(ctx, email)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// new user
 	if !userExists {
 		_, err = b.AddNewUser(ctx, email)
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		fmt.Println("Added new user with email: " + email)
+		slog.InfoContext(ctx, "added new user", "email", email)
 	}
 
-	return nil
-}
\ No newline at end of file
+	return email, nil
+}
+
+// Reads the If-Match precondition forwarded by the HTTP gateway
+func ifMatch(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	return strings.Join(md.Get("if-match"), ",")
+}
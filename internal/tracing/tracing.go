@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Where spans are exported
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Settings of Start, read from the tracing section of config.yaml
+type Config struct {
+	// ExporterNone, ExporterStdout or ExporterOTLP
+	Exporter    string
+	ServiceName string
+	// fraction of traces started here that are sampled, traces started by a caller
+	// follow the caller's decision
+	SampleRatio float64
+	// host:port of an OTLP/gRPC collector
+	Endpoint string
+	Insecure bool
+}
+
+var DefaultConfig = Config{
+	Exporter:    ExporterNone,
+	ServiceName: "todo",
+	SampleRatio: 1,
+	Endpoint:    "localhost:4317",
+}
+
+// Installs the global tracer provider and the W3C trace context propagator.
+// The returned func flushes pending spans and stops the exporter.
+func Start(ctx context.Context, config Config) (func(ctx context.Context) error, error) {
+	// callers' trace context is propagated even when nothing is exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, errors.New("unknown tracing exporter " + config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Traces the requests of handler, which serves mux, continuing the caller's trace.
+// Spans are named after the pattern the request matched in mux, or the gateway route
+// when GatewayRoute is registered on the gateway.
+func Instrument(server string, mux *http.ServeMux, handler http.Handler) http.Handler {
+	return otelhttp.NewHandler(handler, server,
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			_, pattern := mux.Handler(r)
+			return r.Method + " " + pattern
+		}),
+	)
+}
+
+// Names gateway spans after their route, e.g. "GET /v1/todo/calendar/{token}".
+// Register it with runtime.WithMetadata, it adds no metadata.
+func GatewayRoute(ctx context.Context, r *http.Request) metadata.MD {
+	if pattern, ok := runtime.HTTPPathPattern(ctx); ok {
+		span := trace.SpanFromContext(ctx)
+		span.SetName(r.Method + " " + pattern)
+		span.SetAttributes(semconv.HTTPRoute(pattern))
+	}
+	return nil
+}
+
+// Traces the calls of a gRPC server, continuing the trace context sent by clients
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// Traces the calls of a gRPC client, sending the trace context of ctx with every call
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
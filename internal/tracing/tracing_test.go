@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_Start(t *testing.T) {
+	testCases := []struct {
+		testName string
+		config   Config
+		wantErr  bool
+	}{
+		{
+			testName: "Disabled",
+			config:   Config{Exporter: ExporterNone},
+		},
+		{
+			testName: "Stdout",
+			config:   Config{Exporter: ExporterStdout, ServiceName: "todo", SampleRatio: 1},
+		},
+		{
+			testName: "Fail - unknown exporter",
+			config:   Config{Exporter: "zipkin"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			shutdown, err := Start(context.Background(), tc.config)
+			if (err != nil) != tc.wantErr {
+				tt.Fatalf("Start() failed, got error %v, wantErr %v", err, tc.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					tt.Errorf("shutdown failed, %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_Instrument(t *testing.T) {
+	// preserve original provider
+	oriProvider := otel.GetTracerProvider()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if _, err := Start(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/todo/export", func(w http.ResponseWriter, r *http.Request) {})
+	handler := Instrument("test", mux, mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/todo/export?format=csv", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Instrument() failed, got %d spans, want 1", len(spans))
+	}
+	if spans[0].Name() != "GET /v1/todo/export" {
+		t.Errorf("Instrument() failed, got span %q, want %q", spans[0].Name(), "GET /v1/todo/export")
+	}
+	if spans[0].SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Instrument() failed, the caller's trace wasn't continued, got trace %s", spans[0].SpanContext().TraceID())
+	}
+
+	// reset
+	otel.SetTracerProvider(oriProvider)
+}
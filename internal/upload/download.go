@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	ratelimit "todo/internal/ratelimit"
+	pb "todo/proto/todo"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Serves GET /?format= as a file download from ExportTodos. Unlike the gateway, which
+// writes a newline after every message of a stream, the chunks are written as they are
+// so the download is the exact file. An error after the first chunk aborts the
+// response, a partial file is never passed off as complete.
+func ExportHandler(client pb.TodoClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, codes.Unimplemented, "use GET")
+			return
+		}
+
+		ctx := outgoingContext(r)
+		stream, err := client.ExportTodos(ctx, &pb.ExportTodosRequest{Format: r.URL.Query().Get("format")})
+		if err != nil {
+			writeStatus(w, err)
+			return
+		}
+
+		// the header carries the file name, the first chunk the content type
+		header, err := stream.Header()
+		if err != nil {
+			// the status of a call that failed before any header comes with Recv
+			_, err = stream.Recv()
+			writeStatus(w, err)
+			return
+		}
+		chunk, err := stream.Recv()
+		if err != nil && err != io.EOF {
+			writeStatus(w, err)
+			return
+		}
+
+		if values := header.Get("content-disposition"); len(values) > 0 {
+			w.Header().Set("Content-Disposition", values[0])
+		}
+		if chunk != nil {
+			w.Header().Set("Content-Type", chunk.ContentType)
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		for chunk != nil {
+			if _, err := w.Write(chunk.Data); err != nil {
+				return
+			}
+
+			chunk, err = stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				panic(http.ErrAbortHandler)
+			}
+		}
+	})
+}
+
+func writeStatus(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	ratelimit.SetRetryAfter(w.Header(), st)
+	writeMessage(w, runtime.HTTPStatusFromCode(st.Code()), st.Proto())
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	requestid "todo/internal/requestid"
+	pb "todo/proto/todo"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// room for the multipart boundaries and the other form fields
+const formOverhead = 64 << 10
+
+var marshaler = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// formats by file extension, used when the format field is missing
+var extensions = map[string]pb.ImportFormat{
+	".csv":  pb.ImportFormat_IMPORT_FORMAT_CSV,
+	".json": pb.ImportFormat_IMPORT_FORMAT_JSON,
+	".txt":  pb.ImportFormat_IMPORT_FORMAT_TODOTXT,
+	".ics":  pb.ImportFormat_IMPORT_FORMAT_ICS,
+}
+
+// formats by name, as accepted in the format field
+var formats = map[string]pb.ImportFormat{
+	"csv":      pb.ImportFormat_IMPORT_FORMAT_CSV,
+	"json":     pb.ImportFormat_IMPORT_FORMAT_JSON,
+	"todotxt":  pb.ImportFormat_IMPORT_FORMAT_TODOTXT,
+	"todo.txt": pb.ImportFormat_IMPORT_FORMAT_TODOTXT,
+	"ics":      pb.ImportFormat_IMPORT_FORMAT_ICS,
+}
+
+// Accepts a multipart/form-data upload and passes it on to ImportTodos, so it is
+// authenticated and validated like the JSON endpoint. Form fields:
+//
+//	file            the file to import
+//	format          csv, json, todotxt or ics, guessed from the file name when missing
+//	dryRun          true to only report what would be imported
+//	columns.<field> the column or key holding a TodoItem field, e.g. columns.itemName=Title
+func ImportHandler(client pb.TodoClient, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, codes.Unimplemented, "use POST with a multipart/form-data body")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+formOverhead)
+		if err := r.ParseMultipartForm(maxBytes + formOverhead); err != nil {
+			writeError(w, http.StatusBadRequest, codes.InvalidArgument, "invalid multipart upload: "+err.Error())
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codes.InvalidArgument, "missing file")
+			return
+		}
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codes.InvalidArgument, "failed to read file: "+err.Error())
+			return
+		}
+		if int64(len(content)) > maxBytes {
+			writeError(w, http.StatusRequestEntityTooLarge, codes.InvalidArgument, "file is larger than "+strconv.FormatInt(maxBytes, 10)+" bytes")
+			return
+		}
+
+		in := &pb.ImportTodosRequest{
+			Content: string(content),
+			Columns: map[string]string{},
+		}
+
+		if name := r.FormValue("format"); name != "" {
+			format, ok := formats[strings.ToLower(name)]
+			if !ok {
+				writeError(w, http.StatusBadRequest, codes.InvalidArgument, "unknown format "+name)
+				return
+			}
+			in.Format = format
+		} else {
+			in.Format = extensions[strings.ToLower(path.Ext(header.Filename))]
+		}
+
+		if dryRun := r.FormValue("dryRun"); dryRun != "" {
+			if in.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+				writeError(w, http.StatusBadRequest, codes.InvalidArgument, "invalid dryRun "+dryRun)
+				return
+			}
+		}
+
+		for key, values := range r.MultipartForm.Value {
+			if field, ok := strings.CutPrefix(key, "columns."); ok && len(values) > 0 {
+				in.Columns[field] = values[0]
+			}
+		}
+
+		res, err := client.ImportTodos(outgoingContext(r), in)
+		if err != nil {
+			writeStatus(w, err)
+			return
+		}
+		writeMessage(w, http.StatusOK, res)
+	})
+}
+
+// Forwards the same metadata the gateway forwards for the REST routes
+func outgoingContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+	}
+	if id := r.Header.Get(requestid.MetadataKey); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id)
+	}
+	return ctx
+}
+
+func writeMessage(w http.ResponseWriter, code int, message proto.Message) {
+	body, _ := marshaler.Marshal(message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// Answers errors raised before reaching ImportTodos in the same shape as gateway errors
+func writeError(w http.ResponseWriter, httpCode int, code codes.Code, message string) {
+	writeMessage(w, httpCode, status.New(code, message).Proto())
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	pb "todo/proto/todo"
+
+	"google.golang.org/grpc"
+)
+
+type testClient struct {
+	pb.TodoClient
+	in *pb.ImportTodosRequest
+}
+
+func (c *testClient) ImportTodos(ctx context.Context, in *pb.ImportTodosRequest, opts ...grpc.CallOption) (*pb.ImportTodosReply, error) {
+	c.in = in
+	return &pb.ImportTodosReply{Total: 1, Imported: 1, DryRun: in.DryRun}, nil
+}
+
+func Test_ImportHandler(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		filename       string
+		content        string
+		fields         map[string]string
+		expectedCode   int
+		expectedFormat pb.ImportFormat
+	}{
+		{
+			testName:       "Format from extension",
+			filename:       "list.csv",
+			content:        "name,description\nitem1,desc1\n",
+			fields:         map[string]string{"dryRun": "true", "columns.itemName": "name"},
+			expectedCode:   http.StatusOK,
+			expectedFormat: pb.ImportFormat_IMPORT_FORMAT_CSV,
+		},
+		{
+			testName:       "Format field wins",
+			filename:       "todo.txt",
+			content:        `[{"name":"item1"}]`,
+			fields:         map[string]string{"format": "json"},
+			expectedCode:   http.StatusOK,
+			expectedFormat: pb.ImportFormat_IMPORT_FORMAT_JSON,
+		},
+		{
+			testName:     "Unknown format",
+			filename:     "list.csv",
+			content:      "name\nitem1\n",
+			fields:       map[string]string{"format": "xlsx"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			testName:     "File too large",
+			filename:     "list.csv",
+			content:      string(bytes.Repeat([]byte("a"), 101)),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, _ := form.CreateFormFile("file", tc.filename)
+			part.Write([]byte(tc.content))
+			for key, value := range tc.fields {
+				form.WriteField(key, value)
+			}
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/todo/import/upload", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rec := httptest.NewRecorder()
+
+			client := &testClient{}
+			ImportHandler(client, 100).ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedCode {
+				tt.Fatalf("ImportHandler failed, got status %d, want %d: %s", rec.Code, tc.expectedCode, rec.Body.String())
+			}
+			if tc.expectedCode != http.StatusOK {
+				if client.in != nil {
+					tt.Errorf("ImportHandler failed, not expecting ImportTodos to be called")
+				}
+				return
+			}
+			if client.in.Format != tc.expectedFormat || client.in.Content != tc.content {
+				tt.Errorf("ImportHandler failed, got request %v", client.in)
+			}
+			if client.in.DryRun != (tc.fields["dryRun"] == "true") || client.in.Columns["itemName"] != tc.fields["columns.itemName"] {
+				tt.Errorf("ImportHandler failed, got request %v", client.in)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Webhooks are refused destinations in private and reserved networks, so users can't
+// make the server call localhost, internal services or cloud metadata endpoints.
+// Overridden from config.yaml at startup, e.g. to test webhooks locally.
+var AllowPrivateDestinations = false
+
+var ErrForbiddenDestination = errors.New("webhook url points to a private or reserved address")
+
+// Resolves webhook hosts, replaced in tests
+var LookupNetIP = net.DefaultResolver.LookupNetIP
+
+// reserved ranges the netip.Addr methods don't cover
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Tells whether deliveries may connect to addr
+func allowedDestination(addr netip.Addr) bool {
+	if AllowPrivateDestinations {
+		return true
+	}
+
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks the host of a webhook URL is a public address, or a name resolving to public
+// addresses only. A name that doesn't resolve yet is accepted, deliveries check the
+// address they connect to anyway.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !allowedDestination(addr) {
+			return ErrForbiddenDestination
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	addrs, err := LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !allowedDestination(addr) {
+			return ErrForbiddenDestination
+		}
+	}
+	return nil
+}
+
+// Refuses connections to addresses deliveries aren't allowed to reach. It runs on the
+// resolved address of every connection, redirects included, so a name that resolves
+// differently after CheckURL can't get around it.
+func dialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !allowedDestination(addr) {
+		return ErrForbiddenDestination
+	}
+	return nil
+}
+
+// HTTP client of the deliveries, see dialControl. It connects directly, a proxy would
+// hide the destination from the check.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
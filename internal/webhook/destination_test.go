@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func Test_CheckURL(t *testing.T) {
+	testCases := []struct {
+		testName string
+		url      string
+		resolved []string
+		wantErr  bool
+	}{
+		{
+			testName: "Public address",
+			url:      "https://93.184.216.34/hook",
+		},
+		{
+			testName: "Public name",
+			url:      "https://example.com/hook",
+			resolved: []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		},
+		{
+			testName: "Fail - loopback",
+			url:      "http://127.0.0.1:8090/v1/todo/list",
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - private network",
+			url:      "http://10.0.0.5/hook",
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - cloud metadata",
+			url:      "http://169.254.169.254/latest/meta-data/",
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - IPv6 loopback",
+			url:      "http://[::1]/hook",
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - IPv4-mapped private address",
+			url:      "http://[::ffff:192.168.1.1]/hook",
+			wantErr:  true,
+		},
+		{
+			testName: "Fail - name resolving to a private address",
+			url:      "https://internal.example.com/hook",
+			resolved: []string{"93.184.216.34", "172.16.0.1"},
+			wantErr:  true,
+		},
+	}
+
+	// preserve original function
+	oriLookupNetIP := LookupNetIP
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			LookupNetIP = func(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+				var addrs []netip.Addr
+				for _, addr := range tc.resolved {
+					addrs = append(addrs, netip.MustParseAddr(addr))
+				}
+				return addrs, nil
+			}
+
+			err := CheckURL(context.Background(), tc.url)
+			if tc.wantErr && !errors.Is(err, ErrForbiddenDestination) {
+				tt.Errorf("CheckURL failed, got err: %v, want err: %v", err, ErrForbiddenDestination)
+			}
+			if !tc.wantErr && err != nil {
+				tt.Errorf("CheckURL failed, not expecting err: %v", err)
+			}
+		})
+	}
+
+	// reset
+	LookupNetIP = oriLookupNetIP
+}
+
+func Test_newClient(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	// the receiver listens on loopback, like an internal service would
+	client := newClient(time.Second)
+	if _, err := client.Get(receiver.URL); !errors.Is(err, ErrForbiddenDestination) {
+		t.Errorf("newClient failed, got err: %v, want err: %v", err, ErrForbiddenDestination)
+	}
+
+	AllowPrivateDestinations = true
+	defer func() { AllowPrivateDestinations = false }()
+	res, err := client.Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("newClient failed, not expecting err: %v", err)
+	}
+	res.Body.Close()
+}
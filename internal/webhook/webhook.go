@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	data "todo/internal/data"
+	health "todo/internal/health"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Todo-Event"
+	HeaderDelivery  = "X-Todo-Delivery"
+	HeaderTimestamp = "X-Todo-Timestamp"
+	HeaderSignature = "X-Todo-Signature"
+)
+
+// Settings of the delivery worker, overridden from config.yaml at startup
+type Config struct {
+	// how often the queue is checked for due deliveries
+	PollInterval time.Duration
+	// deliveries sent per poll
+	BatchSize int
+	// timeout of a single HTTP call
+	Timeout time.Duration
+	// a delivery is given up after this many attempts
+	MaxAttempts int
+	// delay before the first retry, doubled for every further attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultConfig = Config{
+	PollInterval: time.Second,
+	BatchSize:    20,
+	Timeout:      10 * time.Second,
+	MaxAttempts:  8,
+	Backoff:      30 * time.Second,
+	MaxBackoff:   6 * time.Hour,
+}
+
+// Signs a payload the way receivers are expected to verify it:
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook's secret, prefixed with "sha256=".
+// Including the timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delay before retrying after the given number of failed attempts
+func backoff(config Config, attempts int) time.Duration {
+	delay := config.Backoff
+	for i := 1; i < attempts && delay < config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > config.MaxBackoff {
+		delay = config.MaxBackoff
+	}
+	return delay
+}
+
+// Sends due deliveries until ctx is done. Every server instance can run a worker,
+// deliveries are claimed so each is sent by one of them at a time.
+// The returned channel is closed once the worker stopped.
+func Start(ctx context.Context, config Config) <-chan struct{} {
+	client := newClient(config.Timeout)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// keep going while the queue is full
+			for {
+				n, err := deliverDue(ctx, client, config)
+				if ctx.Err() == nil {
+					if err != nil {
+						slog.Error("webhook deliveries failed", "error", err)
+					}
+					health.SetOptional("webhooks", err, "")
+				}
+				if err != nil || n < config.BatchSize {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// Claims and sends one batch of deliveries, returns how many were claimed
+func deliverDue(ctx context.Context, client *http.Client, config Config) (int, error) {
+	// claimed deliveries are not retried by others before the calls could have timed out
+	lease := config.Timeout*time.Duration(config.BatchSize) + config.PollInterval
+	deliveries, err := data.ClaimWebhookDeliveries(ctx, config.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		if err := deliver(ctx, client, config, delivery); err != nil {
+			return len(deliveries), err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// Makes one attempt at a delivery and records its outcome
+func deliver(ctx context.Context, client *http.Client, config Config, delivery data.WebhookDelivery) error {
+	attempt := data.WebhookAttempt{
+		DeliveryId: delivery.Id,
+		Attempt:    delivery.Attempts + 1,
+	}
+
+	start := time.Now()
+	statusCode, err := send(ctx, client, delivery)
+	attempt.StatusCode = statusCode
+	attempt.Duration = time.Since(start)
+	if ctx.Err() != nil {
+		// shutting down, the delivery is retried once its claim runs out
+		return ctx.Err()
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	status := data.WebhookDeliverySucceeded
+	nextAttemptOn := time.Now()
+	if err != nil || attempt.StatusCode < 200 || attempt.StatusCode > 299 {
+		status = data.WebhookDeliveryPending
+		nextAttemptOn = nextAttemptOn.Add(backoff(config, attempt.Attempt))
+		if attempt.Attempt >= config.MaxAttempts {
+			status = data.WebhookDeliveryFailed
+		}
+	}
+
+	return data.RecordWebhookAttempt(ctx, attempt, status, nextAttemptOn)
+}
+
+// POSTs the signed payload, returns the response status code
+func send(ctx context.Context, client *http.Client, delivery data.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.Id.String())
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	return res.StatusCode, nil
+}
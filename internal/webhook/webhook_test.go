@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	data "todo/internal/data"
+
+	"github.com/google/uuid"
+)
+
+func Test_Sign(t *testing.T) {
+	// printf '1700000000.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	if got := Sign("secret", "1700000000", []byte(`{"id":"1"}`)); got != want {
+		t.Errorf("Sign failed, got %q, want %q", got, want)
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	config := Config{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		if got := backoff(config, tc.attempts); got != tc.expected {
+			t.Errorf("backoff(%d) failed, got %v, want %v", tc.attempts, got, tc.expected)
+		}
+	}
+}
+
+func Test_deliverDue(t *testing.T) {
+	config := Config{
+		BatchSize:   10,
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+	}
+
+	type received struct {
+		header http.Header
+		body   string
+	}
+
+	// the receiver fails the first call of every delivery
+	var calls []received
+	failed := map[string]bool{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, received{r.Header, string(body)})
+
+		delivery := r.Header.Get(HeaderDelivery)
+		if !failed[delivery] {
+			failed[delivery] = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	testCases := []struct {
+		testName       string
+		delivery       data.WebhookDelivery
+		expectedStatus string
+		expectedCode   int
+		expectedDelay  time.Duration
+	}{
+		{
+			testName: "First attempt fails and is retried",
+			delivery: data.WebhookDelivery{
+				Id:        uuid.New(),
+				EventType: "item.added",
+				Payload:   []byte(`{"id":"1"}`),
+				Url:       receiver.URL,
+				Secret:    "secret",
+			},
+			expectedStatus: data.WebhookDeliveryPending,
+			expectedCode:   http.StatusInternalServerError,
+			expectedDelay:  time.Minute,
+		},
+		{
+			testName: "Last attempt fails and is given up",
+			delivery: data.WebhookDelivery{
+				Id:        uuid.New(),
+				EventType: "item.marked",
+				Payload:   []byte(`{"id":"2"}`),
+				Attempts:  2,
+				Url:       receiver.URL,
+				Secret:    "secret",
+			},
+			expectedStatus: data.WebhookDeliveryFailed,
+			expectedCode:   http.StatusInternalServerError,
+		},
+		{
+			testName: "Retry succeeds",
+			delivery: data.WebhookDelivery{
+				Id:        uuid.Nil,
+				EventType: "item.added",
+				Payload:   []byte(`{"id":"1"}`),
+				Attempts:  1,
+				Url:       receiver.URL,
+				Secret:    "secret",
+			},
+			expectedStatus: data.WebhookDeliverySucceeded,
+			expectedCode:   http.StatusNoContent,
+		},
+		{
+			testName: "Unreachable receiver",
+			delivery: data.WebhookDelivery{
+				Id:        uuid.New(),
+				EventType: "item.deleted",
+				Payload:   []byte(`{"id":"3"}`),
+				Url:       "http://127.0.0.1:1/hook",
+				Secret:    "secret",
+			},
+			expectedStatus: data.WebhookDeliveryPending,
+			expectedCode:   0,
+			expectedDelay:  time.Minute,
+		},
+	}
+	// retries the first delivery
+	testCases[2].delivery.Id = testCases[0].delivery.Id
+
+	// preserve original function
+	oriClaimWebhookDeliveries := data.ClaimWebhookDeliveries
+	oriRecordWebhookAttempt := data.RecordWebhookAttempt
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(tt *testing.T) {
+			calls = nil
+			data.ClaimWebhookDeliveries = func(ctx context.Context, limit int, lease time.Duration) ([]data.WebhookDelivery, error) {
+				return []data.WebhookDelivery{tc.delivery}, nil
+			}
+			var attempt data.WebhookAttempt
+			var status string
+			var nextAttemptOn time.Time
+			data.RecordWebhookAttempt = func(ctx context.Context, a data.WebhookAttempt, s string, next time.Time) error {
+				attempt, status, nextAttemptOn = a, s, next
+				return nil
+			}
+
+			start := time.Now()
+			n, err := deliverDue(context.Background(), http.DefaultClient, config)
+			if err != nil || n != 1 {
+				tt.Fatalf("deliverDue failed, got %d, err: %v", n, err)
+			}
+
+			if status != tc.expectedStatus || attempt.StatusCode != tc.expectedCode || attempt.Attempt != tc.delivery.Attempts+1 {
+				tt.Errorf("deliverDue failed, got status %s, code %d, attempt %d", status, attempt.StatusCode, attempt.Attempt)
+			}
+			if tc.expectedCode == 0 && attempt.Error == "" {
+				tt.Errorf("deliverDue failed, expecting the connection error to be logged")
+			}
+			if delay := nextAttemptOn.Sub(start); tc.expectedDelay > 0 && (delay < tc.expectedDelay || delay > tc.expectedDelay+time.Second) {
+				tt.Errorf("deliverDue failed, next attempt in %v, want %v", delay, tc.expectedDelay)
+			}
+
+			if tc.expectedCode == 0 {
+				return
+			}
+			if len(calls) != 1 {
+				tt.Fatalf("deliverDue failed, receiver got %d calls", len(calls))
+			}
+			call := calls[0]
+			if call.body != string(tc.delivery.Payload) || call.header.Get(HeaderEvent) != tc.delivery.EventType || call.header.Get(HeaderDelivery) != tc.delivery.Id.String() {
+				tt.Errorf("deliverDue failed, receiver got %v %s", call.header, call.body)
+			}
+			if want := Sign("secret", call.header.Get(HeaderTimestamp), []byte(call.body)); call.header.Get(HeaderSignature) != want {
+				tt.Errorf("deliverDue failed, got signature %q, want %q", call.header.Get(HeaderSignature), want)
+			}
+		})
+	}
+
+	// reset
+	data.ClaimWebhookDeliveries = oriClaimWebhookDeliveries
+	data.RecordWebhookAttempt = oriRecordWebhookAttempt
+}
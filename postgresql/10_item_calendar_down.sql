@@ -0,0 +1,9 @@
+drop index if exists main.todolist_calendartokenhash_unique;
+
+alter table main.todolist drop column if exists calendarTokenHash;
+
+alter table main.item drop column if exists categories;
+alter table main.item drop column if exists priority;
+alter table main.item drop column if exists due;
+
+delete from main.migration where version = 10;
@@ -0,0 +1,10 @@
+-- calendar fields of an item, as in an iCalendar VTODO
+alter table main.item add column if not exists due timestamp with time zone;
+-- 1 is the highest priority and 9 the lowest, 0 means undefined
+alter table main.item add column if not exists priority smallint not null default 0 check (priority between 0 and 9);
+alter table main.item add column if not exists categories text[] not null default '{}';
+
+-- sha256 of the secret token in the list's .ics feed URL, null while there is no feed
+alter table main.todolist add column if not exists calendarTokenHash varchar(64);
+
+create unique index if not exists todolist_calendartokenhash_unique on main.todolist (calendarTokenHash) where calendarTokenHash is not null;
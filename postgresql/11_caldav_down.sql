@@ -0,0 +1,8 @@
+drop index if exists main.item_calendarname_unique;
+
+alter table main.item drop column if exists calendarName;
+alter table main.item drop column if exists calendarUid;
+
+drop table if exists main.appToken;
+
+delete from main.migration where version = 11;
@@ -0,0 +1,20 @@
+-- tokens apps such as CalDAV clients log in with, in place of the Google login
+create table if not exists main.appToken(
+    id varchar(36) primary key,
+    userId varchar(36),
+    name varchar(64),
+    -- sha256 of the token, the token itself is only shown once
+    tokenHash varchar(64) unique,
+    active boolean default true,
+    lastUsedOn timestamp with time zone,
+    createdOn timestamp with time zone default current_timestamp,
+    constraint fk_userId_appToken foreign key(userId) references main.user(id)
+);
+
+create index if not exists appToken_userId on main.appToken (userId) where active;
+
+-- UID and resource name given by the CalDAV client that created the item, empty otherwise
+alter table main.item add column if not exists calendarUid varchar(255) not null default '';
+alter table main.item add column if not exists calendarName varchar(255) not null default '';
+
+create unique index if not exists item_calendarname_unique on main.item (todoListId, calendarName) where active and calendarName <> '';
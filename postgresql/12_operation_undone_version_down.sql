@@ -0,0 +1,5 @@
+drop index if exists main.operation_itemId_afterVersion;
+
+alter table main.operation drop column if exists undoneVersion;
+
+delete from main.migration where version = 12;
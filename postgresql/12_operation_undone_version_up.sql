@@ -0,0 +1,4 @@
+-- version an undo left the item at, the next older operation on the item is undone from it
+alter table main.operation add column if not exists undoneVersion integer;
+
+create index if not exists operation_itemId_afterVersion on main.operation (itemId, afterVersion desc);
@@ -0,0 +1,5 @@
+drop index if exists main.itemEvent_todoListId_txId_seq;
+
+alter table main.itemEvent drop column if exists txId;
+
+delete from main.migration where version = 13;
@@ -0,0 +1,7 @@
+-- transaction that recorded the event. seq is taken at insert time, so events can commit
+-- out of seq order: watchers read events in (txId, seq) order, and only those of
+-- transactions older than every running one, see ListItemEvents
+alter table main.itemEvent add column if not exists txId xid8 not null default '0';
+alter table main.itemEvent alter column txId set default pg_current_xact_id();
+
+create index if not exists itemEvent_todoListId_txId_seq on main.itemEvent (todoListId, txId, seq);
@@ -0,0 +1,3 @@
+alter table main.item drop column if exists version;
+
+delete from main.migration where version = 2;
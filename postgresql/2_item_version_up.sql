@@ -0,0 +1 @@
+alter table main.item add column if not exists version integer not null default 1;
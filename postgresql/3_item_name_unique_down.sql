@@ -0,0 +1,7 @@
+drop index if exists main.item_todolistid_name_unique;
+
+alter table main.item drop column if exists uniqueName;
+
+alter table main.todolist drop column if exists duplicatePolicy;
+
+delete from main.migration where version = 3;
@@ -0,0 +1,14 @@
+alter table main.todolist add column if not exists duplicatePolicy varchar(16) not null default 'reject';
+
+-- items added while the list allowed duplicates are left out of the unique index
+alter table main.item add column if not exists uniqueName boolean not null default true;
+
+-- keep the oldest of any existing duplicates unique
+update main.item i set uniqueName = false
+where i.active and exists (
+    select 1 from main.item o
+    where o.todoListId = i.todoListId and o.active and lower(o.name) = lower(i.name)
+    and (o.createdOn, o.id) < (i.createdOn, i.id)
+);
+
+create unique index if not exists item_todolistid_name_unique on main.item (todoListId, lower(name)) where active and uniqueName;
@@ -0,0 +1,5 @@
+drop table if exists main.auditEvent;
+
+drop function if exists main.auditEvent_append_only();
+
+delete from main.migration where version = 4;
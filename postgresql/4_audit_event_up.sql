@@ -0,0 +1,25 @@
+create table if not exists main.auditEvent(
+    id varchar(36) primary key,
+    actorId varchar(36),
+    action varchar(32),
+    entityType varchar(16),
+    entityId varchar(36),
+    todoListId varchar(36),
+    itemId varchar(36),
+    before jsonb,
+    after jsonb,
+    requestId varchar(64),
+    createdOn timestamp with time zone default current_timestamp
+);
+
+create index if not exists auditEvent_todoListId_createdOn on main.auditEvent (todoListId, createdOn);
+
+-- the audit trail is append-only
+create or replace function main.auditEvent_append_only() returns trigger as $$
+begin
+    raise exception 'main.auditEvent is append-only';
+end;
+$$ language plpgsql;
+
+create trigger auditEvent_append_only before update or delete on main.auditEvent
+    for each row execute function main.auditEvent_append_only();
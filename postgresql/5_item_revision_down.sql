@@ -0,0 +1,3 @@
+drop table if exists main.itemRevision;
+
+delete from main.migration where version = 5;
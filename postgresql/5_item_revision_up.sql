@@ -0,0 +1,16 @@
+create table if not exists main.itemRevision(
+    itemId varchar(36),
+    revision integer,
+    name varchar(64),
+    description varchar(128),
+    markDone boolean,
+    active boolean,
+    createdOn timestamp with time zone default current_timestamp,
+    constraint pk_itemRevision primary key(itemId, revision),
+    constraint fk_itemId_itemRevision foreign key(itemId) references main.item(id)
+);
+
+-- the current state of existing items becomes their first known revision
+insert into main.itemRevision(itemId, revision, name, description, markDone, active, createdOn)
+select id, version, name, description, markDone, active, updatedOn from main.item
+on conflict do nothing;
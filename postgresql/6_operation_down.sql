@@ -0,0 +1,3 @@
+drop table if exists main.operation;
+
+delete from main.migration where version = 6;
@@ -0,0 +1,16 @@
+-- journal of item mutations per user, used to undo them
+create table if not exists main.operation(
+    id varchar(36) primary key,
+    groupId varchar(36),
+    userId varchar(36),
+    kind varchar(16),
+    itemId varchar(36),
+    before jsonb,
+    afterVersion integer,
+    undone boolean default false,
+    createdOn timestamp with time zone default current_timestamp,
+    constraint fk_userId_operation foreign key(userId) references main.user(id),
+    constraint fk_itemId_operation foreign key(itemId) references main.item(id)
+);
+
+create index if not exists operation_userId_createdOn on main.operation (userId, createdOn desc) where not undone;
@@ -0,0 +1,7 @@
+drop trigger if exists itemEvent_record on main.item;
+
+drop function if exists main.itemEvent_record();
+
+drop table if exists main.itemEvent;
+
+delete from main.migration where version = 7;
@@ -0,0 +1,44 @@
+-- every change to an item, in order, so watchers can resume from a cursor (seq)
+create table if not exists main.itemEvent(
+    seq bigserial primary key,
+    todoListId varchar(36),
+    itemId varchar(36),
+    kind varchar(16),
+    name varchar(64),
+    description varchar(128),
+    markDone boolean,
+    active boolean,
+    version integer,
+    createdOn timestamp with time zone default current_timestamp
+);
+
+create index if not exists itemEvent_todoListId_seq on main.itemEvent (todoListId, seq);
+
+-- records the event and wakes up listeners of the item_events channel on every server
+create or replace function main.itemEvent_record() returns trigger as $$
+declare
+    eventKind varchar(16);
+    eventSeq bigint;
+begin
+    if TG_OP = 'INSERT' or (not old.active and new.active) then
+        eventKind := 'created';
+    elsif old.active and not new.active then
+        eventKind := 'deleted';
+    elsif new.active then
+        eventKind := 'updated';
+    else
+        -- changes to deleted items are not visible to watchers
+        return new;
+    end if;
+
+    insert into main.itemEvent(todoListId, itemId, kind, name, description, markDone, active, version)
+    values (new.todoListId, new.id, eventKind, new.name, new.description, new.markDone, new.active, new.version)
+    returning seq into eventSeq;
+
+    perform pg_notify('item_events', json_build_object('seq', eventSeq, 'todoListId', new.todoListId)::text);
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger itemEvent_record after insert or update on main.item
+    for each row execute function main.itemEvent_record();
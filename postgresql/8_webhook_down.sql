@@ -0,0 +1,11 @@
+drop trigger if exists webhookDelivery_enqueue on main.auditEvent;
+
+drop function if exists main.webhookDelivery_enqueue();
+
+drop table if exists main.webhookAttempt;
+
+drop table if exists main.webhookDelivery;
+
+drop table if exists main.webhook;
+
+delete from main.migration where version = 8;
@@ -0,0 +1,76 @@
+-- endpoints called with the audited changes of a todolist
+create table if not exists main.webhook(
+    id varchar(36) primary key,
+    userId varchar(36),
+    todoListId varchar(36),
+    url varchar(2048),
+    secret varchar(128),
+    -- audit actions to send, every action when empty
+    eventTypes varchar(32)[] default '{}',
+    active boolean default true,
+    createdOn timestamp with time zone default current_timestamp,
+    updatedOn timestamp with time zone default current_timestamp,
+    constraint fk_userId_webhook foreign key(userId) references main.user(id)
+);
+
+create index if not exists webhook_todoListId on main.webhook (todoListId) where active;
+
+-- delivery queue, a delivery is retried with backoff until it succeeds or runs out of attempts
+create table if not exists main.webhookDelivery(
+    id varchar(36) primary key,
+    webhookId varchar(36),
+    eventId varchar(36),
+    eventType varchar(32),
+    payload jsonb,
+    status varchar(16) default 'pending',
+    attempts integer default 0,
+    nextAttemptOn timestamp with time zone default current_timestamp,
+    deliveredOn timestamp with time zone,
+    createdOn timestamp with time zone default current_timestamp,
+    constraint fk_webhookId_webhookDelivery foreign key(webhookId) references main.webhook(id)
+);
+
+create index if not exists webhookDelivery_pending on main.webhookDelivery (nextAttemptOn) where status = 'pending';
+create index if not exists webhookDelivery_webhookId_createdOn on main.webhookDelivery (webhookId, createdOn desc);
+
+-- every HTTP call made for a delivery
+create table if not exists main.webhookAttempt(
+    id bigserial primary key,
+    deliveryId varchar(36),
+    attempt integer,
+    statusCode integer,
+    error text,
+    durationMs bigint,
+    createdOn timestamp with time zone default current_timestamp,
+    constraint fk_deliveryId_webhookAttempt foreign key(deliveryId) references main.webhookDelivery(id)
+);
+
+create index if not exists webhookAttempt_deliveryId on main.webhookAttempt (deliveryId, attempt);
+
+-- queues a delivery for every webhook subscribed to the audited action, in the same
+-- transaction as the change so no event is lost or sent for a rolled back change
+create or replace function main.webhookDelivery_enqueue() returns trigger as $$
+begin
+    insert into main.webhookDelivery(id, webhookId, eventId, eventType, payload)
+    select gen_random_uuid()::varchar, w.id, new.id, new.action, json_build_object(
+        'id', new.id,
+        'type', new.action,
+        'todoListId', new.todoListId,
+        'actorId', new.actorId,
+        'entityType', new.entityType,
+        'entityId', new.entityId,
+        'itemId', new.itemId,
+        'before', new.before,
+        'after', new.after,
+        'requestId', new.requestId,
+        'occurredOn', new.createdOn
+    )
+    from main.webhook w
+    where w.todoListId = new.todoListId and w.active
+        and (cardinality(w.eventTypes) = 0 or new.action = any(w.eventTypes));
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger webhookDelivery_enqueue after insert on main.auditEvent
+    for each row execute function main.webhookDelivery_enqueue();
@@ -0,0 +1,5 @@
+drop table if exists main.outboxPublication;
+
+drop table if exists main.outboxEvent;
+
+delete from main.migration where version = 9;
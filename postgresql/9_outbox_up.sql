@@ -0,0 +1,26 @@
+-- domain events written in the same transaction as the change, published by the relay
+create table if not exists main.outboxEvent(
+    id varchar(36) primary key,
+    seq bigserial,
+    type varchar(32),
+    aggregateType varchar(16),
+    aggregateId varchar(36),
+    todoListId varchar(36),
+    payload jsonb,
+    requestId varchar(64),
+    attempts integer default 0,
+    nextAttemptOn timestamp with time zone default current_timestamp,
+    publishedOn timestamp with time zone,
+    createdOn timestamp with time zone default current_timestamp
+);
+
+create index if not exists outboxEvent_unpublished on main.outboxEvent (nextAttemptOn, seq) where publishedOn is null;
+
+-- sinks an event was published to, so a retry only goes to the sinks that failed
+create table if not exists main.outboxPublication(
+    eventId varchar(36),
+    sink varchar(64),
+    publishedOn timestamp with time zone default current_timestamp,
+    primary key (eventId, sink),
+    constraint fk_eventId_outboxPublication foreign key(eventId) references main.outboxEvent(id)
+);
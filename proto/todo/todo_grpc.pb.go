@@ -8,6 +8,7 @@ package todo
 
 import (
 	context "context"
+	httpbody "google.golang.org/genproto/googleapis/api/httpbody"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -19,21 +20,70 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Todo_AddTodo_FullMethodName    = "/pb.Todo/AddTodo"
-	Todo_DeleteTodo_FullMethodName = "/pb.Todo/DeleteTodo"
-	Todo_ListTodo_FullMethodName   = "/pb.Todo/ListTodo"
-	Todo_MarkTodo_FullMethodName   = "/pb.Todo/MarkTodo"
-	Todo_Ping_FullMethodName       = "/pb.Todo/Ping"
+	Todo_AddTodo_FullMethodName               = "/pb.Todo/AddTodo"
+	Todo_DeleteTodo_FullMethodName            = "/pb.Todo/DeleteTodo"
+	Todo_ListTodo_FullMethodName              = "/pb.Todo/ListTodo"
+	Todo_MarkTodo_FullMethodName              = "/pb.Todo/MarkTodo"
+	Todo_ListTodoRevisions_FullMethodName     = "/pb.Todo/ListTodoRevisions"
+	Todo_RevertTodo_FullMethodName            = "/pb.Todo/RevertTodo"
+	Todo_Undo_FullMethodName                  = "/pb.Todo/Undo"
+	Todo_WatchTodos_FullMethodName            = "/pb.Todo/WatchTodos"
+	Todo_GetListSettings_FullMethodName       = "/pb.Todo/GetListSettings"
+	Todo_UpdateListSettings_FullMethodName    = "/pb.Todo/UpdateListSettings"
+	Todo_ListAuditEvents_FullMethodName       = "/pb.Todo/ListAuditEvents"
+	Todo_ImportTodos_FullMethodName           = "/pb.Todo/ImportTodos"
+	Todo_ExportTodos_FullMethodName           = "/pb.Todo/ExportTodos"
+	Todo_CreateCalendarFeed_FullMethodName    = "/pb.Todo/CreateCalendarFeed"
+	Todo_DeleteCalendarFeed_FullMethodName    = "/pb.Todo/DeleteCalendarFeed"
+	Todo_GetCalendarFeed_FullMethodName       = "/pb.Todo/GetCalendarFeed"
+	Todo_CreateAppToken_FullMethodName        = "/pb.Todo/CreateAppToken"
+	Todo_ListAppTokens_FullMethodName         = "/pb.Todo/ListAppTokens"
+	Todo_DeleteAppToken_FullMethodName        = "/pb.Todo/DeleteAppToken"
+	Todo_CreateWebhook_FullMethodName         = "/pb.Todo/CreateWebhook"
+	Todo_ListWebhooks_FullMethodName          = "/pb.Todo/ListWebhooks"
+	Todo_DeleteWebhook_FullMethodName         = "/pb.Todo/DeleteWebhook"
+	Todo_ListWebhookDeliveries_FullMethodName = "/pb.Todo/ListWebhookDeliveries"
+	Todo_RedeliverWebhook_FullMethodName      = "/pb.Todo/RedeliverWebhook"
+	Todo_Ping_FullMethodName                  = "/pb.Todo/Ping"
 )
 
 // TodoClient is the client API for Todo service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TodoClient interface {
-	AddTodo(ctx context.Context, in *AddTodoRequest, opts ...grpc.CallOption) (*EmptyReply, error)
+	AddTodo(ctx context.Context, in *AddTodoRequest, opts ...grpc.CallOption) (*TodoItem, error)
 	DeleteTodo(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*EmptyReply, error)
 	ListTodo(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListTodoReply, error)
 	MarkTodo(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*EmptyReply, error)
+	ListTodoRevisions(ctx context.Context, in *ListTodoRevisionsRequest, opts ...grpc.CallOption) (*ListTodoRevisionsReply, error)
+	RevertTodo(ctx context.Context, in *RevertTodoRequest, opts ...grpc.CallOption) (*TodoItem, error)
+	Undo(ctx context.Context, in *UndoRequest, opts ...grpc.CallOption) (*UndoReply, error)
+	// streams changes to the todolist as they happen
+	WatchTodos(ctx context.Context, in *WatchTodosRequest, opts ...grpc.CallOption) (Todo_WatchTodosClient, error)
+	GetListSettings(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListSettings, error)
+	UpdateListSettings(ctx context.Context, in *ListSettings, opts ...grpc.CallOption) (*ListSettings, error)
+	ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsReply, error)
+	// imports items from a CSV, JSON or todo.txt file, also available as a multipart
+	// upload on /v1/todo/import/upload
+	ImportTodos(ctx context.Context, in *ImportTodosRequest, opts ...grpc.CallOption) (*ImportTodosReply, error)
+	// streams the todolist as a file download, see ExportTodosRequest for the formats
+	ExportTodos(ctx context.Context, in *ExportTodosRequest, opts ...grpc.CallOption) (Todo_ExportTodosClient, error)
+	// the todolist as an iCalendar feed of VTODOs, authenticated by the secret token in
+	// the URL so calendar apps can subscribe. Creating a feed again replaces its token.
+	CreateCalendarFeed(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*CalendarFeed, error)
+	DeleteCalendarFeed(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyReply, error)
+	GetCalendarFeed(ctx context.Context, in *GetCalendarFeedRequest, opts ...grpc.CallOption) (*httpbody.HttpBody, error)
+	// app tokens let apps such as CalDAV clients log in as the user, they are sent as
+	// the password of HTTP basic authentication with the user's email
+	CreateAppToken(ctx context.Context, in *CreateAppTokenRequest, opts ...grpc.CallOption) (*AppToken, error)
+	ListAppTokens(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListAppTokensReply, error)
+	DeleteAppToken(ctx context.Context, in *DeleteAppTokenRequest, opts ...grpc.CallOption) (*EmptyReply, error)
+	// webhooks are called with every audited change of the todolist
+	CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*Webhook, error)
+	ListWebhooks(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListWebhooksReply, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*EmptyReply, error)
+	ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesReply, error)
+	RedeliverWebhook(ctx context.Context, in *RedeliverWebhookRequest, opts ...grpc.CallOption) (*WebhookDelivery, error)
 	Ping(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*PingReply, error)
 }
 
@@ -45,8 +95,8 @@ func NewTodoClient(cc grpc.ClientConnInterface) TodoClient {
 	return &todoClient{cc}
 }
 
-func (c *todoClient) AddTodo(ctx context.Context, in *AddTodoRequest, opts ...grpc.CallOption) (*EmptyReply, error) {
-	out := new(EmptyReply)
+func (c *todoClient) AddTodo(ctx context.Context, in *AddTodoRequest, opts ...grpc.CallOption) (*TodoItem, error) {
+	out := new(TodoItem)
 	err := c.cc.Invoke(ctx, Todo_AddTodo_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -81,6 +131,232 @@ func (c *todoClient) MarkTodo(ctx context.Context, in *UpdateTodoRequest, opts .
 	return out, nil
 }
 
+func (c *todoClient) ListTodoRevisions(ctx context.Context, in *ListTodoRevisionsRequest, opts ...grpc.CallOption) (*ListTodoRevisionsReply, error) {
+	out := new(ListTodoRevisionsReply)
+	err := c.cc.Invoke(ctx, Todo_ListTodoRevisions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) RevertTodo(ctx context.Context, in *RevertTodoRequest, opts ...grpc.CallOption) (*TodoItem, error) {
+	out := new(TodoItem)
+	err := c.cc.Invoke(ctx, Todo_RevertTodo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) Undo(ctx context.Context, in *UndoRequest, opts ...grpc.CallOption) (*UndoReply, error) {
+	out := new(UndoReply)
+	err := c.cc.Invoke(ctx, Todo_Undo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) WatchTodos(ctx context.Context, in *WatchTodosRequest, opts ...grpc.CallOption) (Todo_WatchTodosClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todo_ServiceDesc.Streams[0], Todo_WatchTodos_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoWatchTodosClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Todo_WatchTodosClient interface {
+	Recv() (*TodoEvent, error)
+	grpc.ClientStream
+}
+
+type todoWatchTodosClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoWatchTodosClient) Recv() (*TodoEvent, error) {
+	m := new(TodoEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoClient) GetListSettings(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListSettings, error) {
+	out := new(ListSettings)
+	err := c.cc.Invoke(ctx, Todo_GetListSettings_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) UpdateListSettings(ctx context.Context, in *ListSettings, opts ...grpc.CallOption) (*ListSettings, error) {
+	out := new(ListSettings)
+	err := c.cc.Invoke(ctx, Todo_UpdateListSettings_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsReply, error) {
+	out := new(ListAuditEventsReply)
+	err := c.cc.Invoke(ctx, Todo_ListAuditEvents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ImportTodos(ctx context.Context, in *ImportTodosRequest, opts ...grpc.CallOption) (*ImportTodosReply, error) {
+	out := new(ImportTodosReply)
+	err := c.cc.Invoke(ctx, Todo_ImportTodos_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ExportTodos(ctx context.Context, in *ExportTodosRequest, opts ...grpc.CallOption) (Todo_ExportTodosClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todo_ServiceDesc.Streams[1], Todo_ExportTodos_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoExportTodosClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Todo_ExportTodosClient interface {
+	Recv() (*httpbody.HttpBody, error)
+	grpc.ClientStream
+}
+
+type todoExportTodosClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoExportTodosClient) Recv() (*httpbody.HttpBody, error) {
+	m := new(httpbody.HttpBody)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoClient) CreateCalendarFeed(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*CalendarFeed, error) {
+	out := new(CalendarFeed)
+	err := c.cc.Invoke(ctx, Todo_CreateCalendarFeed_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) DeleteCalendarFeed(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*EmptyReply, error) {
+	out := new(EmptyReply)
+	err := c.cc.Invoke(ctx, Todo_DeleteCalendarFeed_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) GetCalendarFeed(ctx context.Context, in *GetCalendarFeedRequest, opts ...grpc.CallOption) (*httpbody.HttpBody, error) {
+	out := new(httpbody.HttpBody)
+	err := c.cc.Invoke(ctx, Todo_GetCalendarFeed_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) CreateAppToken(ctx context.Context, in *CreateAppTokenRequest, opts ...grpc.CallOption) (*AppToken, error) {
+	out := new(AppToken)
+	err := c.cc.Invoke(ctx, Todo_CreateAppToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ListAppTokens(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListAppTokensReply, error) {
+	out := new(ListAppTokensReply)
+	err := c.cc.Invoke(ctx, Todo_ListAppTokens_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) DeleteAppToken(ctx context.Context, in *DeleteAppTokenRequest, opts ...grpc.CallOption) (*EmptyReply, error) {
+	out := new(EmptyReply)
+	err := c.cc.Invoke(ctx, Todo_DeleteAppToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...grpc.CallOption) (*Webhook, error) {
+	out := new(Webhook)
+	err := c.cc.Invoke(ctx, Todo_CreateWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ListWebhooks(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*ListWebhooksReply, error) {
+	out := new(ListWebhooksReply)
+	err := c.cc.Invoke(ctx, Todo_ListWebhooks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*EmptyReply, error) {
+	out := new(EmptyReply)
+	err := c.cc.Invoke(ctx, Todo_DeleteWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) ListWebhookDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesReply, error) {
+	out := new(ListWebhookDeliveriesReply)
+	err := c.cc.Invoke(ctx, Todo_ListWebhookDeliveries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoClient) RedeliverWebhook(ctx context.Context, in *RedeliverWebhookRequest, opts ...grpc.CallOption) (*WebhookDelivery, error) {
+	out := new(WebhookDelivery)
+	err := c.cc.Invoke(ctx, Todo_RedeliverWebhook_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *todoClient) Ping(ctx context.Context, in *EmptyRequest, opts ...grpc.CallOption) (*PingReply, error) {
 	out := new(PingReply)
 	err := c.cc.Invoke(ctx, Todo_Ping_FullMethodName, in, out, opts...)
@@ -94,10 +370,39 @@ func (c *todoClient) Ping(ctx context.Context, in *EmptyRequest, opts ...grpc.Ca
 // All implementations must embed UnimplementedTodoServer
 // for forward compatibility
 type TodoServer interface {
-	AddTodo(context.Context, *AddTodoRequest) (*EmptyReply, error)
+	AddTodo(context.Context, *AddTodoRequest) (*TodoItem, error)
 	DeleteTodo(context.Context, *UpdateTodoRequest) (*EmptyReply, error)
 	ListTodo(context.Context, *EmptyRequest) (*ListTodoReply, error)
 	MarkTodo(context.Context, *UpdateTodoRequest) (*EmptyReply, error)
+	ListTodoRevisions(context.Context, *ListTodoRevisionsRequest) (*ListTodoRevisionsReply, error)
+	RevertTodo(context.Context, *RevertTodoRequest) (*TodoItem, error)
+	Undo(context.Context, *UndoRequest) (*UndoReply, error)
+	// streams changes to the todolist as they happen
+	WatchTodos(*WatchTodosRequest, Todo_WatchTodosServer) error
+	GetListSettings(context.Context, *EmptyRequest) (*ListSettings, error)
+	UpdateListSettings(context.Context, *ListSettings) (*ListSettings, error)
+	ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsReply, error)
+	// imports items from a CSV, JSON or todo.txt file, also available as a multipart
+	// upload on /v1/todo/import/upload
+	ImportTodos(context.Context, *ImportTodosRequest) (*ImportTodosReply, error)
+	// streams the todolist as a file download, see ExportTodosRequest for the formats
+	ExportTodos(*ExportTodosRequest, Todo_ExportTodosServer) error
+	// the todolist as an iCalendar feed of VTODOs, authenticated by the secret token in
+	// the URL so calendar apps can subscribe. Creating a feed again replaces its token.
+	CreateCalendarFeed(context.Context, *EmptyRequest) (*CalendarFeed, error)
+	DeleteCalendarFeed(context.Context, *EmptyRequest) (*EmptyReply, error)
+	GetCalendarFeed(context.Context, *GetCalendarFeedRequest) (*httpbody.HttpBody, error)
+	// app tokens let apps such as CalDAV clients log in as the user, they are sent as
+	// the password of HTTP basic authentication with the user's email
+	CreateAppToken(context.Context, *CreateAppTokenRequest) (*AppToken, error)
+	ListAppTokens(context.Context, *EmptyRequest) (*ListAppTokensReply, error)
+	DeleteAppToken(context.Context, *DeleteAppTokenRequest) (*EmptyReply, error)
+	// webhooks are called with every audited change of the todolist
+	CreateWebhook(context.Context, *CreateWebhookRequest) (*Webhook, error)
+	ListWebhooks(context.Context, *EmptyRequest) (*ListWebhooksReply, error)
+	DeleteWebhook(context.Context, *DeleteWebhookRequest) (*EmptyReply, error)
+	ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error)
+	RedeliverWebhook(context.Context, *RedeliverWebhookRequest) (*WebhookDelivery, error)
 	Ping(context.Context, *EmptyRequest) (*PingReply, error)
 	mustEmbedUnimplementedTodoServer()
 }
@@ -106,7 +411,7 @@ type TodoServer interface {
 type UnimplementedTodoServer struct {
 }
 
-func (UnimplementedTodoServer) AddTodo(context.Context, *AddTodoRequest) (*EmptyReply, error) {
+func (UnimplementedTodoServer) AddTodo(context.Context, *AddTodoRequest) (*TodoItem, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AddTodo not implemented")
 }
 func (UnimplementedTodoServer) DeleteTodo(context.Context, *UpdateTodoRequest) (*EmptyReply, error) {
@@ -118,6 +423,66 @@ func (UnimplementedTodoServer) ListTodo(context.Context, *EmptyRequest) (*ListTo
 func (UnimplementedTodoServer) MarkTodo(context.Context, *UpdateTodoRequest) (*EmptyReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method MarkTodo not implemented")
 }
+func (UnimplementedTodoServer) ListTodoRevisions(context.Context, *ListTodoRevisionsRequest) (*ListTodoRevisionsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTodoRevisions not implemented")
+}
+func (UnimplementedTodoServer) RevertTodo(context.Context, *RevertTodoRequest) (*TodoItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevertTodo not implemented")
+}
+func (UnimplementedTodoServer) Undo(context.Context, *UndoRequest) (*UndoReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Undo not implemented")
+}
+func (UnimplementedTodoServer) WatchTodos(*WatchTodosRequest, Todo_WatchTodosServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTodos not implemented")
+}
+func (UnimplementedTodoServer) GetListSettings(context.Context, *EmptyRequest) (*ListSettings, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetListSettings not implemented")
+}
+func (UnimplementedTodoServer) UpdateListSettings(context.Context, *ListSettings) (*ListSettings, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateListSettings not implemented")
+}
+func (UnimplementedTodoServer) ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
+func (UnimplementedTodoServer) ImportTodos(context.Context, *ImportTodosRequest) (*ImportTodosReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportTodos not implemented")
+}
+func (UnimplementedTodoServer) ExportTodos(*ExportTodosRequest, Todo_ExportTodosServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportTodos not implemented")
+}
+func (UnimplementedTodoServer) CreateCalendarFeed(context.Context, *EmptyRequest) (*CalendarFeed, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCalendarFeed not implemented")
+}
+func (UnimplementedTodoServer) DeleteCalendarFeed(context.Context, *EmptyRequest) (*EmptyReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCalendarFeed not implemented")
+}
+func (UnimplementedTodoServer) GetCalendarFeed(context.Context, *GetCalendarFeedRequest) (*httpbody.HttpBody, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCalendarFeed not implemented")
+}
+func (UnimplementedTodoServer) CreateAppToken(context.Context, *CreateAppTokenRequest) (*AppToken, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAppToken not implemented")
+}
+func (UnimplementedTodoServer) ListAppTokens(context.Context, *EmptyRequest) (*ListAppTokensReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAppTokens not implemented")
+}
+func (UnimplementedTodoServer) DeleteAppToken(context.Context, *DeleteAppTokenRequest) (*EmptyReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAppToken not implemented")
+}
+func (UnimplementedTodoServer) CreateWebhook(context.Context, *CreateWebhookRequest) (*Webhook, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhook not implemented")
+}
+func (UnimplementedTodoServer) ListWebhooks(context.Context, *EmptyRequest) (*ListWebhooksReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhooks not implemented")
+}
+func (UnimplementedTodoServer) DeleteWebhook(context.Context, *DeleteWebhookRequest) (*EmptyReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedTodoServer) ListWebhookDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeliveries not implemented")
+}
+func (UnimplementedTodoServer) RedeliverWebhook(context.Context, *RedeliverWebhookRequest) (*WebhookDelivery, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RedeliverWebhook not implemented")
+}
 func (UnimplementedTodoServer) Ping(context.Context, *EmptyRequest) (*PingReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
@@ -206,6 +571,372 @@ func _Todo_MarkTodo_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Todo_ListTodoRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTodoRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ListTodoRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ListTodoRevisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ListTodoRevisions(ctx, req.(*ListTodoRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_RevertTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevertTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).RevertTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_RevertTodo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).RevertTodo(ctx, req.(*RevertTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_Undo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).Undo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_Undo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).Undo(ctx, req.(*UndoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_WatchTodos_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTodosRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServer).WatchTodos(m, &todoWatchTodosServer{stream})
+}
+
+type Todo_WatchTodosServer interface {
+	Send(*TodoEvent) error
+	grpc.ServerStream
+}
+
+type todoWatchTodosServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoWatchTodosServer) Send(m *TodoEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Todo_GetListSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).GetListSettings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_GetListSettings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).GetListSettings(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_UpdateListSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSettings)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).UpdateListSettings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_UpdateListSettings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).UpdateListSettings(ctx, req.(*ListSettings))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ListAuditEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ListAuditEvents(ctx, req.(*ListAuditEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ImportTodos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportTodosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ImportTodos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ImportTodos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ImportTodos(ctx, req.(*ImportTodosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ExportTodos_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportTodosRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServer).ExportTodos(m, &todoExportTodosServer{stream})
+}
+
+type Todo_ExportTodosServer interface {
+	Send(*httpbody.HttpBody) error
+	grpc.ServerStream
+}
+
+type todoExportTodosServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoExportTodosServer) Send(m *httpbody.HttpBody) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Todo_CreateCalendarFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).CreateCalendarFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_CreateCalendarFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).CreateCalendarFeed(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_DeleteCalendarFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).DeleteCalendarFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_DeleteCalendarFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).DeleteCalendarFeed(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_GetCalendarFeed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCalendarFeedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).GetCalendarFeed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_GetCalendarFeed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).GetCalendarFeed(ctx, req.(*GetCalendarFeedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_CreateAppToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAppTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).CreateAppToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_CreateAppToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).CreateAppToken(ctx, req.(*CreateAppTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ListAppTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ListAppTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ListAppTokens_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ListAppTokens(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_DeleteAppToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAppTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).DeleteAppToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_DeleteAppToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).DeleteAppToken(ctx, req.(*DeleteAppTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_CreateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).CreateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_CreateWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).CreateWebhook(ctx, req.(*CreateWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ListWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ListWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ListWebhooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ListWebhooks(ctx, req.(*EmptyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_DeleteWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).DeleteWebhook(ctx, req.(*DeleteWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_ListWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).ListWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_ListWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).ListWebhookDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todo_RedeliverWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RedeliverWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServer).RedeliverWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Todo_RedeliverWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServer).RedeliverWebhook(ctx, req.(*RedeliverWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Todo_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(EmptyRequest)
 	if err := dec(in); err != nil {
@@ -247,11 +978,94 @@ var Todo_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "MarkTodo",
 			Handler:    _Todo_MarkTodo_Handler,
 		},
+		{
+			MethodName: "ListTodoRevisions",
+			Handler:    _Todo_ListTodoRevisions_Handler,
+		},
+		{
+			MethodName: "RevertTodo",
+			Handler:    _Todo_RevertTodo_Handler,
+		},
+		{
+			MethodName: "Undo",
+			Handler:    _Todo_Undo_Handler,
+		},
+		{
+			MethodName: "GetListSettings",
+			Handler:    _Todo_GetListSettings_Handler,
+		},
+		{
+			MethodName: "UpdateListSettings",
+			Handler:    _Todo_UpdateListSettings_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _Todo_ListAuditEvents_Handler,
+		},
+		{
+			MethodName: "ImportTodos",
+			Handler:    _Todo_ImportTodos_Handler,
+		},
+		{
+			MethodName: "CreateCalendarFeed",
+			Handler:    _Todo_CreateCalendarFeed_Handler,
+		},
+		{
+			MethodName: "DeleteCalendarFeed",
+			Handler:    _Todo_DeleteCalendarFeed_Handler,
+		},
+		{
+			MethodName: "GetCalendarFeed",
+			Handler:    _Todo_GetCalendarFeed_Handler,
+		},
+		{
+			MethodName: "CreateAppToken",
+			Handler:    _Todo_CreateAppToken_Handler,
+		},
+		{
+			MethodName: "ListAppTokens",
+			Handler:    _Todo_ListAppTokens_Handler,
+		},
+		{
+			MethodName: "DeleteAppToken",
+			Handler:    _Todo_DeleteAppToken_Handler,
+		},
+		{
+			MethodName: "CreateWebhook",
+			Handler:    _Todo_CreateWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhooks",
+			Handler:    _Todo_ListWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _Todo_DeleteWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeliveries",
+			Handler:    _Todo_ListWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "RedeliverWebhook",
+			Handler:    _Todo_RedeliverWebhook_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _Todo_Ping_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTodos",
+			Handler:       _Todo_WatchTodos_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportTodos",
+			Handler:       _Todo_ExportTodos_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "todo/todo.proto",
 }